@@ -5,10 +5,16 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
+	"github.com/Gmacem/wasmorph/internal/audit"
 	"github.com/Gmacem/wasmorph/internal/auth"
 	"github.com/Gmacem/wasmorph/internal/handlers"
+	"github.com/Gmacem/wasmorph/internal/oidc"
 	"github.com/Gmacem/wasmorph/internal/wasm"
+	"github.com/Gmacem/wasmorph/internal/workspace"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -22,8 +28,9 @@ func main() {
 	slog.SetDefault(logger)
 
 	config := auth.Config{
-		DatabaseURL: os.Getenv("DATABASE_URL"),
-		JWTSecret:   os.Getenv("JWT_SECRET"),
+		DatabaseURL:         os.Getenv("DATABASE_URL"),
+		JWTSecret:           os.Getenv("JWT_SECRET"),
+		DisableRegistration: !envBool("REGISTRATION_ENABLED", true),
 	}
 	if config.DatabaseURL == "" {
 		logger.Error("DATABASE_URL is not set")
@@ -33,6 +40,23 @@ func main() {
 		logger.Error("JWT_SECRET is not set")
 		os.Exit(1)
 	}
+	if issuerURL := os.Getenv("OIDC_ISSUER_URL"); issuerURL != "" {
+		provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+			IssuerURL:    issuerURL,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		})
+		if err != nil {
+			logger.Error("Failed to set up OIDC provider", "error", err)
+			os.Exit(1)
+		}
+		config.OIDC = auth.OIDCConfig{
+			Provider:      provider,
+			AutoProvision: envBool("OIDC_AUTO_PROVISION", false),
+			LinkByEmail:   envBool("OIDC_LINK_BY_EMAIL", false),
+		}
+	}
 
 	// Create connection pool instead of single connection
 	pool, err := pgxpool.New(context.Background(), config.DatabaseURL)
@@ -49,15 +73,40 @@ func main() {
 		NumCounters: 1000,
 		BufferItems: 64,
 	})
-	wasmService := wasm.NewService(pool, cache)
+	moduleCache, err := wasm.NewModuleCache(os.Getenv("MODULE_CACHE_DIR"))
+	if err != nil {
+		logger.Error("Failed to create module cache", "error", err)
+		os.Exit(1)
+	}
+	defer moduleCache.Close(context.Background())
+
+	wasmService := wasm.NewService(pool, cache, &wasm.ServiceConfig{
+		BuildWorkers:         envInt("BUILD_WORKERS", 2),
+		BuildQueueSize:       envInt("BUILD_QUEUE_SIZE", 100),
+		CompileCacheDir:      envString("COMPILE_CACHE_DIR", filepath.Join(os.TempDir(), "wasmorph-compile-cache")),
+		CompileCacheMaxBytes: int64(envInt("COMPILE_CACHE_MAX_BYTES", 1<<30)),
+		ModuleCache:          moduleCache,
+	})
+	go wasmService.ListenForRuleChanges(context.Background())
+	if err := wasmService.FailAbandonedBuilds(context.Background()); err != nil {
+		logger.Error("Failed to recover builds", "error", err)
+		os.Exit(1)
+	}
+	if retention := envDuration("DELETED_RULE_RETENTION", 30*24*time.Hour); retention > 0 {
+		go wasmService.PurgeExpiredRules(context.Background(), retention)
+	}
 	rulesHandler := handlers.NewRulesHandler(wasmService)
+	workspacesHandler := handlers.NewWorkspacesHandler(workspace.NewService(pool))
+	auditService := audit.NewService(pool)
+	auditHandler := handlers.NewAuditHandler(auditService)
 
 	r := chi.NewRouter()
+	r.Use(handlers.RequestID)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"*"},
 	}))
 
@@ -68,16 +117,73 @@ func main() {
 
 	r.Post("/api/v1/auth/login", authService.LoginHandler)
 	r.Post("/api/v1/auth/register", authService.RegisterHandler)
+	r.Post("/api/v1/auth/refresh", authService.RefreshHandler)
+	r.Get("/api/v1/auth/oidc/login", authService.OIDCLoginHandler)
+	r.Get("/api/v1/auth/oidc/callback", authService.OIDCCallbackHandler)
 
 	r.Route("/api/v1", func(r chi.Router) {
 		r.Use(authService.AuthMiddleware)
 
 		r.Get("/auth/me", authService.MeHandler)
-		r.Post("/rules", rulesHandler.CreateRule)
-		r.Get("/rules", rulesHandler.ListRules)
-		r.Get("/rules/{name}", rulesHandler.GetRule)
-		r.Post("/rules/{name}/execute", rulesHandler.ExecuteRule)
-		r.Delete("/rules/{name}", rulesHandler.DeleteRule)
+		r.Post("/auth/logout", authService.LogoutHandler)
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireScope(auth.ScopeKeysManage))
+			r.Post("/api-keys", authService.CreateAPIKeyHandler)
+			r.Get("/api-keys", authService.ListAPIKeysHandler)
+			r.Delete("/api-keys/{id}", authService.RevokeAPIKeyHandler)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireScope(auth.ScopeWorkspacesManage))
+			r.Post("/workspaces", workspacesHandler.CreateWorkspace)
+			r.Put("/workspaces/{id}/members/{username}", workspacesHandler.SetMember)
+			r.Delete("/workspaces/{id}/members/{username}", workspacesHandler.RemoveMember)
+		})
+
+		r.With(auth.RequireScope(auth.ScopeAuditRead)).Get("/audit", auditHandler.ListEvents)
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(auth.RequireScope(auth.ScopeUsersManage))
+			r.Use(authService.RequireAdmin)
+			r.Get("/users", authService.ListUsersHandler)
+			r.Post("/users", authService.CreateUserHandler)
+			r.Patch("/users/{id}", authService.UpdateUserHandler)
+			r.Post("/users/{id}/reset-credentials", authService.ResetCredentialsHandler)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireScope(auth.ScopeRulesRead))
+			r.Get("/rules", rulesHandler.ListRules)
+			r.Get("/rules/{name}", rulesHandler.GetRule)
+			r.Get("/rules/{name}/versions", rulesHandler.ListRuleVersions)
+			r.Get("/rules/{name}/limits", rulesHandler.GetRuleLimits)
+			r.Get("/rules/{name}/aliases", rulesHandler.ListRuleAliases)
+			r.Get("/builds/{id}", rulesHandler.GetBuild)
+			r.Get("/workspaces", workspacesHandler.ListWorkspaces)
+			r.Get("/workspaces/{id}/members", workspacesHandler.ListMembers)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireScope(auth.ScopeRulesWrite))
+			r.Post("/rules", rulesHandler.CreateRule)
+			r.Put("/rules/{name}", rulesHandler.ReplaceRule)
+			r.Patch("/rules/{name}", rulesHandler.PatchRule)
+			r.Post("/rules/{name}/rename", rulesHandler.RenameRule)
+			r.Post("/rules/{name}/rollback/{version}", rulesHandler.RollbackRule)
+			r.Patch("/rules/{name}/limits", rulesHandler.UpdateRuleLimits)
+			r.Put("/rules/{name}/aliases/{alias}", rulesHandler.SetRuleAlias)
+			r.Delete("/rules/{name}/aliases/{alias}", rulesHandler.DeleteRuleAlias)
+			r.Delete("/rules/{name}", rulesHandler.DeleteRule)
+			r.Post("/rules/{name}/restore", rulesHandler.RestoreRule)
+			r.Post("/rules/{name}/purge", rulesHandler.PurgeRule)
+			r.Post("/rules/{name}/transfer", rulesHandler.TransferRule)
+		})
+
+		r.With(
+			handlers.RecordDenied(auditService, audit.ActionRuleExecuteDenied),
+			auth.RequireScope(auth.ScopeRulesExecute),
+		).Post("/rules/{name}/execute", rulesHandler.ExecuteRule)
 	})
 
 	fileServer := http.FileServer(http.Dir("web/static"))
@@ -91,3 +197,49 @@ func main() {
 	slog.Info("Starting server", "port", port)
 	slog.Error("Server stopped", "error", http.ListenAndServe(":"+port, r))
 }
+
+func envString(name, fallback string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return fallback
+}
+
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Invalid integer environment variable, using default", "name", name, "value", value, "default", fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func envBool(name string, fallback bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Warn("Invalid boolean environment variable, using default", "name", name, "value", value, "default", fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Invalid duration environment variable, using default", "name", name, "value", value, "default", fallback)
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,109 @@
+// Package audit records who changed rules and credentials, and when, in the
+// append-only wasmorph.audit_log table.
+package audit
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Action is what an audit event records.
+type Action string
+
+const (
+	ActionRuleCreate        Action = "rule.create"
+	ActionRuleUpdate        Action = "rule.update"
+	ActionRuleRollback      Action = "rule.rollback"
+	ActionRuleDelete        Action = "rule.delete"
+	ActionRuleRename        Action = "rule.rename"
+	ActionRuleRestore       Action = "rule.restore"
+	ActionRulePurge         Action = "rule.purge"
+	ActionRuleTransfer      Action = "rule.transfer"
+	ActionRuleLimitsUpdate  Action = "rule.limits_update"
+	ActionRuleAliasSet      Action = "rule.alias_set"
+	ActionRuleAliasDelete   Action = "rule.alias_delete"
+	ActionRuleExecuteDenied Action = "rule.execute_denied"
+
+	ActionAPIKeyCreate Action = "api_key.create"
+	ActionAPIKeyRevoke Action = "api_key.revoke"
+
+	ActionUserLogin            Action = "user.login"
+	ActionUserRegister         Action = "user.register"
+	ActionUserCreate           Action = "user.create"
+	ActionUserUpdate           Action = "user.update"
+	ActionUserResetCredentials Action = "user.reset_credentials"
+)
+
+// Actor is who caused the events recorded with a context.
+type Actor struct {
+	UserID int32
+	// APIKeyID is set when the actor authenticated with an API key.
+	APIKeyID int32
+	SourceIP string
+}
+
+type contextKey int
+
+const actorContextKey contextKey = iota
+
+// WithActor returns a copy of ctx whose events are attributed to actor.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey, actor)
+}
+
+// ActorFromContext returns the actor stored by WithActor.
+func ActorFromContext(ctx context.Context) (Actor, bool) {
+	actor, ok := ctx.Value(actorContextKey).(Actor)
+	return actor, ok
+}
+
+// SourceIP returns the address the request came from. Forwarding headers are
+// ignored since any client can set them.
+func SourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Event is a change to record. Zero values are stored as null.
+type Event struct {
+	Action      Action
+	WorkspaceID int32
+	// Target names what was acted on, such as a rule name or a username.
+	Target string
+	// Detail adds what Target leaves out, such as the name of an alias.
+	Detail        string
+	VersionBefore int32
+	VersionAfter  int32
+}
+
+// Record stores event as caused by the actor of ctx. Pass the queries of a
+// transaction to record the event together with the change.
+func Record(ctx context.Context, queries *sql.Queries, event Event) error {
+	actor, _ := ActorFromContext(ctx)
+	return queries.CreateAuditEvent(ctx, sql.CreateAuditEventParams{
+		ActorUserID:   optionalInt(actor.UserID),
+		ActorApiKeyID: optionalInt(actor.APIKeyID),
+		SourceIp:      optionalText(actor.SourceIP),
+		WorkspaceID:   optionalInt(event.WorkspaceID),
+		Action:        string(event.Action),
+		Target:        event.Target,
+		Detail:        optionalText(event.Detail),
+		VersionBefore: optionalInt(event.VersionBefore),
+		VersionAfter:  optionalInt(event.VersionAfter),
+	})
+}
+
+func optionalInt(value int32) pgtype.Int4 {
+	return pgtype.Int4{Int32: value, Valid: value != 0}
+}
+
+func optionalText(value string) pgtype.Text {
+	return pgtype.Text{String: value, Valid: value != ""}
+}
@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Filter selects audit events. Zero values match every event.
+type Filter struct {
+	Actor       string
+	WorkspaceID int32
+	Action      Action
+	Target      string
+	Since       time.Time
+	Until       time.Time
+	// BeforeID continues a listing after its last event.
+	BeforeID int64
+	Limit    int32
+}
+
+type Service struct {
+	queries *sql.Queries
+}
+
+func NewService(pool *pgxpool.Pool) *Service {
+	return &Service{
+		queries: sql.New(pool),
+	}
+}
+
+// Record is the package-level Record for changes made outside a transaction.
+// Failures are logged rather than returned, since the change already happened.
+func (s *Service) Record(ctx context.Context, event Event) {
+	if err := Record(ctx, s.queries, event); err != nil {
+		slog.Error("Failed to record audit event", "action", event.Action, "target", event.Target, "error", err)
+	}
+}
+
+// List returns the events matching filter, newest first. Admins see every
+// event; other users see the events in their workspaces and the ones they
+// caused themselves.
+func (s *Service) List(ctx context.Context, viewerID int32, filter Filter) ([]sql.ListAuditEventsRow, error) {
+	isAdmin, err := s.queries.IsUserAdmin(ctx, viewerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check admin access: %w", err)
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultLimit
+	}
+	if filter.Limit > MaxLimit {
+		filter.Limit = MaxLimit
+	}
+
+	params := sql.ListAuditEventsParams{
+		Actor:       optionalText(filter.Actor),
+		WorkspaceID: optionalInt(filter.WorkspaceID),
+		Action:      optionalText(string(filter.Action)),
+		Target:      optionalText(filter.Target),
+		Since:       optionalTime(filter.Since),
+		Until:       optionalTime(filter.Until),
+		BeforeID:    pgtype.Int8{Int64: filter.BeforeID, Valid: filter.BeforeID != 0},
+		MaxResults:  filter.Limit,
+	}
+	if !isAdmin {
+		params.VisibleTo = optionalInt(viewerID)
+	}
+
+	events, err := s.queries.ListAuditEvents(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	return events, nil
+}
+
+// optionalTime compares in UTC, the time zone created_at is stored in with
+// the default server configuration.
+func optionalTime(value time.Time) pgtype.Timestamp {
+	return pgtype.Timestamp{Time: value.UTC(), Valid: !value.IsZero()}
+}
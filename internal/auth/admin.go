@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Gmacem/wasmorph/internal/audit"
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// AdminUser is a user as shown to admins. RuleCount counts the active rules
+// the user created and APIKeyCount their usable API keys.
+type AdminUser struct {
+	ID          int32            `json:"id"`
+	Username    string           `json:"username"`
+	Email       string           `json:"email"`
+	IsActive    bool             `json:"is_active"`
+	IsAdmin     bool             `json:"is_admin"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	RuleCount   int64            `json:"rule_count"`
+	APIKeyCount int64            `json:"api_key_count"`
+}
+
+// RequireAdmin refuses requests from users who are not admins.
+func (a *AuthService) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requestUserID(r)
+		if !ok {
+			writeJSONError(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		isAdmin, err := a.queries.IsUserAdmin(r.Context(), userID)
+		if err != nil {
+			writeJSONError(w, r, http.StatusInternalServerError, "Failed to check admin access")
+			return
+		}
+		if !isAdmin {
+			Deny(r.Context())
+			writeJSONError(w, r, http.StatusForbidden, "Admin access required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *AuthService) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.queries.ListUserSummaries(r.Context())
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to list users")
+		return
+	}
+
+	users := make([]AdminUser, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, newAdminUser(sql.GetUserSummaryRow(row)))
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (a *AuthService) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		IsAdmin  bool   `json:"is_admin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if req.Username == "" || req.Password == "" {
+		writeJSONError(w, r, http.StatusBadRequest, "Username and password required")
+		return
+	}
+
+	passwordHash, err := HashPassword(req.Password)
+	if errors.Is(err, ErrPasswordTooLong) {
+		writeJSONError(w, r, http.StatusBadRequest, "Password must be at most 72 bytes")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to hash password")
+		return
+	}
+
+	user, err := a.queries.CreateUser(r.Context(), sql.CreateUserParams{
+		Username:     req.Username,
+		Email:        pgtype.Text{String: req.Email, Valid: req.Email != ""},
+		PasswordHash: passwordHash,
+		IsActive:     pgtype.Bool{Bool: true, Valid: true},
+		IsAdmin:      req.IsAdmin,
+	})
+	if err != nil {
+		writeJSONError(w, r, http.StatusConflict, "User already exists")
+		return
+	}
+	a.recordEvent(r.Context(), audit.Event{
+		Action: audit.ActionUserCreate,
+		Target: user.Username,
+		Detail: fmt.Sprintf("is_admin=%t", user.IsAdmin),
+	})
+
+	a.writeAdminUser(w, r, user.ID, http.StatusCreated)
+}
+
+// UpdateUserHandler deactivates or reactivates a user, or grants or takes
+// away admin rights. Deactivating a user ends their sessions and suspends
+// their API keys until they are reactivated.
+func (a *AuthService) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		IsActive *bool `json:"is_active"`
+		IsAdmin  *bool `json:"is_admin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	// An admin cannot lock themselves out; another admin has to do it.
+	if self, _ := requestUserID(r); self == userID &&
+		((req.IsActive != nil && !*req.IsActive) || (req.IsAdmin != nil && !*req.IsAdmin)) {
+		writeJSONError(w, r, http.StatusBadRequest, "Admins cannot deactivate or demote themselves")
+		return
+	}
+
+	params := sql.UpdateUserStatusParams{ID: userID}
+	if req.IsActive != nil {
+		params.IsActive = pgtype.Bool{Bool: *req.IsActive, Valid: true}
+	}
+	if req.IsAdmin != nil {
+		params.IsAdmin = pgtype.Bool{Bool: *req.IsAdmin, Valid: true}
+	}
+	updated, err := a.queries.UpdateUserStatus(r.Context(), params)
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to update user")
+		return
+	}
+	if updated == 0 {
+		writeJSONError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if req.IsActive != nil && !*req.IsActive {
+		if err := a.queries.RevokeUserSessions(r.Context(), userID); err != nil {
+			slog.Error("Failed to revoke sessions of deactivated user", "user_id", userID, "error", err)
+		}
+	}
+
+	var changes []string
+	if req.IsActive != nil {
+		changes = append(changes, fmt.Sprintf("is_active=%t", *req.IsActive))
+	}
+	if req.IsAdmin != nil {
+		changes = append(changes, fmt.Sprintf("is_admin=%t", *req.IsAdmin))
+	}
+	a.recordUserEvent(r, userID, audit.ActionUserUpdate, strings.Join(changes, " "))
+
+	a.writeAdminUser(w, r, userID, http.StatusOK)
+}
+
+// ResetCredentialsHandler sets a new password for a user and revokes all of
+// their sessions and API keys, for example after their account was
+// compromised.
+func (a *AuthService) ResetCredentialsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := adminUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if req.Password == "" {
+		writeJSONError(w, r, http.StatusBadRequest, "Password required")
+		return
+	}
+
+	passwordHash, err := HashPassword(req.Password)
+	if errors.Is(err, ErrPasswordTooLong) {
+		writeJSONError(w, r, http.StatusBadRequest, "Password must be at most 72 bytes")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to hash password")
+		return
+	}
+
+	if _, err := a.queries.GetUserSummary(r.Context(), userID); errors.Is(err, pgx.ErrNoRows) {
+		writeJSONError(w, r, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to reset credentials")
+		return
+	}
+
+	err = a.queries.UpdateUserPassword(r.Context(), sql.UpdateUserPasswordParams{
+		ID:           userID,
+		PasswordHash: passwordHash,
+	})
+	if err == nil {
+		err = a.queries.RevokeUserSessions(r.Context(), userID)
+	}
+	if err == nil {
+		err = a.queries.RevokeUserAPIKeys(r.Context(), userID)
+	}
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to reset credentials")
+		return
+	}
+	a.recordUserEvent(r, userID, audit.ActionUserResetCredentials, "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *AuthService) writeAdminUser(w http.ResponseWriter, r *http.Request, userID int32, status int) {
+	row, err := a.queries.GetUserSummary(r.Context(), userID)
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to load user")
+		return
+	}
+	writeJSON(w, status, newAdminUser(row))
+}
+
+// recordUserEvent records an admin's change to the user with the given ID.
+func (a *AuthService) recordUserEvent(r *http.Request, userID int32, action audit.Action, detail string) {
+	target := strconv.Itoa(int(userID))
+	if user, err := a.queries.GetUserSummary(r.Context(), userID); err == nil {
+		target = user.Username
+	}
+	a.recordEvent(r.Context(), audit.Event{Action: action, Target: target, Detail: detail})
+}
+
+func newAdminUser(row sql.GetUserSummaryRow) AdminUser {
+	return AdminUser{
+		ID:          row.ID,
+		Username:    row.Username,
+		Email:       row.Email.String,
+		IsActive:    row.IsActive.Bool,
+		IsAdmin:     row.IsAdmin,
+		CreatedAt:   row.CreatedAt,
+		RuleCount:   row.RuleCount,
+		APIKeyCount: row.ApiKeyCount,
+	}
+}
+
+// adminUserID parses the {id} route parameter of the admin user routes.
+func adminUserID(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+	return int32(userID), true
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	a := &AuthService{queries: sql.New(existsDB{1: true})}
+	handler := a.RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		want      int
+	}{
+		{"admin", &Principal{UserID: 1, Method: AuthMethodSession}, http.StatusNoContent},
+		{"other user", &Principal{UserID: 2, Method: AuthMethodSession}, http.StatusForbidden},
+		{"unauthenticated", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/users", nil)
+			if tt.principal != nil {
+				req = req.WithContext(WithPrincipal(req.Context(), tt.principal))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestRegisterDisabled(t *testing.T) {
+	a := &AuthService{config: Config{DisableRegistration: true}}
+
+	form := url.Values{"username": {"alice"}, "email": {"alice@example.com"}, "password": {"secret"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/register", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	a.RegisterHandler(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Gmacem/wasmorph/internal/audit"
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/Gmacem/wasmorph/internal/wasm"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// API keys look like "wsm_<id>_<secret>". The "wsm_<id>" part is random but
+// not secret: it is stored in clear so that users can tell their keys apart.
+// Only a SHA-256 hash of the whole key is stored, which is enough since the
+// key itself is random.
+const (
+	apiKeyPrefix      = "wsm_"
+	apiKeyIDBytes     = 4
+	apiKeySecretBytes = 24
+)
+
+const maxAPIKeyLabel = 255
+
+// APIKey describes an API key without its secret. Key is only set in the
+// response that creates the key; it cannot be retrieved afterwards.
+type APIKey struct {
+	ID           int32            `json:"id"`
+	Label        string           `json:"label"`
+	Key          string           `json:"key,omitempty"`
+	Prefix       string           `json:"prefix"`
+	Scopes       []string         `json:"scopes"`
+	RulePatterns []string         `json:"rule_patterns"`
+	CreatedAt    pgtype.Timestamp `json:"created_at"`
+	LastUsedAt   pgtype.Timestamp `json:"last_used_at"`
+	ExpiresAt    pgtype.Timestamp `json:"expires_at"`
+}
+
+// generateAPIKey returns a new key and its public prefix.
+func generateAPIKey() (key, prefix string, err error) {
+	buf := make([]byte, apiKeyIDBytes+apiKeySecretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	prefix = apiKeyPrefix + hex.EncodeToString(buf[:apiKeyIDBytes])
+	return prefix + "_" + hex.EncodeToString(buf[apiKeyIDBytes:]), prefix, nil
+}
+
+// hashToken hashes a random secret such as an API key or a refresh token for
+// storage. A fast hash is enough since the secrets cannot be guessed.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *AuthService) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req struct {
+		Label        string     `json:"label"`
+		ExpiresAt    *time.Time `json:"expires_at"`
+		Scopes       []string   `json:"scopes"`
+		RulePatterns []string   `json:"rule_patterns"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if len(req.Label) > maxAPIKeyLabel {
+		writeJSONError(w, r, http.StatusBadRequest, "Label must be at most 255 characters")
+		return
+	}
+	if req.Scopes == nil {
+		req.Scopes = defaultAPIKeyScopes
+	}
+	if err := validateScopes(req.Scopes); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.RulePatterns == nil {
+		req.RulePatterns = []string{}
+	}
+	if err := validateRulePatterns(req.RulePatterns); err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var expiresAt pgtype.Timestamptz
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			writeJSONError(w, r, http.StatusBadRequest, "expires_at must be in the future")
+			return
+		}
+		expiresAt = pgtype.Timestamptz{Time: *req.ExpiresAt, Valid: true}
+	}
+
+	secret, prefix, err := generateAPIKey()
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to generate API key")
+		return
+	}
+	key, err := a.queries.CreateAPIKey(r.Context(), sql.CreateAPIKeyParams{
+		KeyHash:      hashToken(secret),
+		KeyPrefix:    prefix,
+		UserID:       userID,
+		Label:        req.Label,
+		ExpiresAt:    expiresAt,
+		Scopes:       req.Scopes,
+		RulePatterns: req.RulePatterns,
+	})
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+	a.recordEvent(r.Context(), audit.Event{
+		Action: audit.ActionAPIKeyCreate,
+		Target: strconv.Itoa(int(key.ID)),
+		Detail: key.KeyPrefix,
+	})
+
+	writeJSON(w, http.StatusCreated, APIKey{
+		ID:           key.ID,
+		Label:        key.Label,
+		Key:          secret,
+		Prefix:       key.KeyPrefix,
+		Scopes:       key.Scopes,
+		RulePatterns: key.RulePatterns,
+		CreatedAt:    key.CreatedAt,
+		LastUsedAt:   key.LastUsedAt,
+		ExpiresAt:    key.ExpiresAt,
+	})
+}
+
+func (a *AuthService) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	rows, err := a.queries.ListAPIKeysByUser(r.Context(), userID)
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to list API keys")
+		return
+	}
+
+	keys := make([]APIKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, APIKey{
+			ID:           row.ID,
+			Label:        row.Label,
+			Prefix:       row.KeyPrefix,
+			Scopes:       row.Scopes,
+			RulePatterns: row.RulePatterns,
+			CreatedAt:    row.CreatedAt,
+			LastUsedAt:   row.LastUsedAt,
+			ExpiresAt:    row.ExpiresAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+func (a *AuthService) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requestUserID(r)
+	if !ok {
+		writeJSONError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	keyID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	revoked, err := a.queries.RevokeAPIKey(r.Context(), sql.RevokeAPIKeyParams{
+		ID:     int32(keyID),
+		UserID: userID,
+	})
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+	if revoked == 0 {
+		writeJSONError(w, r, http.StatusNotFound, "API key not found")
+		return
+	}
+	a.recordEvent(r.Context(), audit.Event{Action: audit.ActionAPIKeyRevoke, Target: strconv.Itoa(int(keyID))})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestUserID returns the user that AuthMiddleware authenticated.
+func requestUserID(r *http.Request) (int32, bool) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		return 0, false
+	}
+	return principal.UserID, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// errorResponse has the shape of the rules API's error responses, so that
+// clients handle authentication failures like any other error.
+type errorResponse struct {
+	Error     string         `json:"error"`
+	Code      wasm.ErrorCode `json:"code"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+func writeJSONError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeJSON(w, status, errorResponse{
+		Error:     message,
+		Code:      statusErrorCode(status),
+		RequestID: middleware.GetReqID(r.Context()),
+	})
+}
+
+func statusErrorCode(status int) wasm.ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return wasm.CodeValidation
+	case http.StatusUnauthorized:
+		return wasm.CodeUnauthorized
+	case http.StatusForbidden:
+		return wasm.CodeForbidden
+	case http.StatusNotFound:
+		return wasm.CodeNotFound
+	case http.StatusConflict:
+		return wasm.CodeConflict
+	default:
+		return wasm.CodeInternal
+	}
+}
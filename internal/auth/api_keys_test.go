@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, err := generateAPIKey()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(prefix, apiKeyPrefix))
+	assert.True(t, strings.HasPrefix(key, prefix+"_"))
+	assert.Len(t, key, len(prefix)+1+2*apiKeySecretBytes)
+
+	other, _, err := generateAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+func TestHashToken(t *testing.T) {
+	// Must match encode(sha256(convert_to(key, 'UTF8')), 'hex'), which the
+	// migration used to hash existing keys.
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", hashToken("abc"))
+}
@@ -2,59 +2,59 @@ package auth
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Gmacem/wasmorph/internal/audit"
 	"github.com/Gmacem/wasmorph/internal/sql"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Config struct {
 	DatabaseURL string
 	JWTSecret   string
+	OIDC        OIDCConfig
+	// DisableRegistration refuses sign-ups, so that only admins create users.
+	DisableRegistration bool
 }
 
 type AuthService struct {
-	config       Config
-	userSessions map[string]string
-	queries      *sql.Queries
+	config  Config
+	queries *sql.Queries
 }
 
 func NewAuthService(pool *pgxpool.Pool, config Config) *AuthService {
 	return &AuthService{
-		config:       config,
-		userSessions: make(map[string]string),
-		queries:      sql.New(pool),
+		config:  config,
+		queries: sql.New(pool),
 	}
 }
 
-func (a *AuthService) GenerateAPIKey(userID string) string {
-	bytes := make([]byte, 16)
-	rand.Read(bytes)
-	apiKey := hex.EncodeToString(bytes)
-	return apiKey
-}
-
-func (a *AuthService) GenerateJWT(userID string) (string, error) {
+// GenerateJWT issues a short-lived access token for the session.
+func (a *AuthService) GenerateJWT(userID, sessionID int32) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"user_id": strconv.Itoa(int(userID)),
+		"sid":     sessionID,
+		"exp":     time.Now().Add(accessTokenTTL).Unix(),
 		"iat":     time.Now().Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(a.config.JWTSecret))
 }
 
-func (a *AuthService) ValidateJWT(tokenString string) (string, error) {
+// ValidateJWT checks the signature and expiry of an access token. Whether its
+// session was revoked is checked separately.
+func (a *AuthService) ValidateJWT(tokenString string) (userID, sessionID int32, err error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -62,144 +62,185 @@ func (a *AuthService) ValidateJWT(tokenString string) (string, error) {
 		return []byte(a.config.JWTSecret), nil
 	})
 	if err != nil {
-		return "", err
+		return 0, 0, err
 	}
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if userID, ok := claims["user_id"].(string); ok {
-			return userID, nil
+		subject, _ := claims["user_id"].(string)
+		sid, hasSession := claims["sid"].(float64)
+		if id, err := strconv.ParseInt(subject, 10, 32); err == nil && hasSession {
+			return int32(id), int32(sid), nil
 		}
 	}
-	return "", fmt.Errorf("invalid token")
+	return 0, 0, fmt.Errorf("invalid token")
 }
 
-func (a *AuthService) ValidateAPIKey(apiKey string) (int32, bool) {
-	userID, err := a.queries.ValidateAPIKey(context.Background(), apiKey)
+func (a *AuthService) ValidateAPIKey(apiKey string) (sql.ValidateAPIKeyRow, bool) {
+	key, err := a.queries.ValidateAPIKey(context.Background(), hashToken(apiKey))
 	if err != nil {
-		return 0, false
+		return sql.ValidateAPIKeyRow{}, false
 	}
 
-	return userID, true
+	// last_used_at is only advanced once a minute, so most requests skip the write.
+	if err := a.queries.TouchAPIKey(context.Background(), key.ID); err != nil {
+		slog.Warn("Failed to record API key use", "api_key_id", key.ID, "error", err)
+	}
+	return key, true
 }
 
+// AuthMiddleware authenticates the request with an API key or a session
+// cookie and stores the resulting Principal in the request context.
 func (a *AuthService) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if auth := r.Header.Get("Authorization"); auth != "" {
-			if after, ok := strings.CutPrefix(auth, "Bearer "); ok {
-				apiKey := after
-				if userID, exists := a.ValidateAPIKey(apiKey); exists {
-					r.Header.Set("X-User-ID", fmt.Sprintf("%d", userID))
-					next.ServeHTTP(w, r)
-					return
-				}
-			}
+		principal, ok := a.authenticate(r)
+		if !ok {
+			writeJSONError(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
 		}
-		if cookie, err := r.Cookie("session"); err == nil {
-			if userID, err := a.ValidateJWT(cookie.Value); err == nil {
-				r.Header.Set("X-User-ID", userID)
-				next.ServeHTTP(w, r)
-				return
-			}
+
+		principal.WorkspaceID, ok = selectedWorkspace(r)
+		if !ok {
+			writeJSONError(w, r, http.StatusBadRequest, "Invalid workspace ID")
+			return
 		}
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		ctx := WithPrincipal(r.Context(), principal)
+		ctx = audit.WithActor(ctx, audit.Actor{
+			UserID:   principal.UserID,
+			APIKeyID: principal.APIKeyID,
+			SourceIP: audit.SourceIP(r),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+func (a *AuthService) authenticate(r *http.Request) (*Principal, bool) {
+	if apiKey, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if key, exists := a.ValidateAPIKey(apiKey); exists {
+			return &Principal{
+				UserID:       key.UserID,
+				Method:       AuthMethodAPIKey,
+				APIKeyID:     key.ID,
+				Scopes:       key.Scopes,
+				RulePatterns: key.RulePatterns,
+			}, true
+		}
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		userID, sessionID, err := a.ValidateJWT(cookie.Value)
+		if err == nil && a.sessionActive(r.Context(), userID, sessionID) {
+			return &Principal{UserID: userID, Method: AuthMethodSession, SessionID: sessionID}, true
+		}
+	}
+	return nil, false
+}
+
 func (a *AuthService) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	username := r.FormValue("username")
 	password := r.FormValue("password")
 	if username == "" || password == "" {
-		http.Error(w, "Username and password required", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "Username and password required")
 		return
 	}
 
 	user, err := a.queries.GetUserByUsername(r.Context(), username)
 	if err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		writeJSONError(w, r, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
 
-	if user.PasswordHash != password {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	ok, needsRehash := VerifyPassword(user.PasswordHash, password)
+	if !ok {
+		writeJSONError(w, r, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
+	if needsRehash {
+		a.rehashPassword(r.Context(), user.ID, password)
+	}
+
+	a.recordEvent(loginContext(r, user.ID), audit.Event{Action: audit.ActionUserLogin, Target: user.Username, Detail: "password"})
+	a.startSession(w, r, user.ID)
+}
 
-	userID := fmt.Sprintf("%d", user.ID)
-	jwtToken, err := a.GenerateJWT(userID)
+// rehashPassword replaces a plaintext or outdated password hash after the
+// user proved they know the password. Failing to do so does not fail the
+// login; it is retried on the next one.
+func (a *AuthService) rehashPassword(ctx context.Context, userID int32, password string) {
+	passwordHash, err := HashPassword(password)
+	if err == nil {
+		err = a.queries.UpdateUserPassword(ctx, sql.UpdateUserPasswordParams{
+			ID:           userID,
+			PasswordHash: passwordHash,
+		})
+	}
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-		return
+		slog.Error("Failed to rehash password", "user_id", userID, "error", err)
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    jwtToken,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteLaxMode,
-		MaxAge:   86400,
-	})
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"access_token": "%s"}`, jwtToken)
 }
 
 func (a *AuthService) RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if a.config.DisableRegistration {
+		writeJSONError(w, r, http.StatusForbidden, "Registration is disabled")
+		return
+	}
+
 	username := r.FormValue("username")
 	email := r.FormValue("email")
 	password := r.FormValue("password")
 
 	if username == "" || email == "" || password == "" {
-		http.Error(w, "Username, email and password required", http.StatusBadRequest)
+		writeJSONError(w, r, http.StatusBadRequest, "Username, email and password required")
+		return
+	}
+
+	passwordHash, err := HashPassword(password)
+	if errors.Is(err, ErrPasswordTooLong) {
+		writeJSONError(w, r, http.StatusBadRequest, "Password must be at most 72 bytes")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to hash password")
 		return
 	}
 
 	user, err := a.queries.CreateUser(r.Context(), sql.CreateUserParams{
 		Username:     username,
 		Email:        pgtype.Text{String: email, Valid: true},
-		PasswordHash: password,
+		PasswordHash: passwordHash,
 		IsActive:     pgtype.Bool{Bool: true, Valid: true},
 	})
 	if err != nil {
-		http.Error(w, "User already exists", http.StatusConflict)
+		writeJSONError(w, r, http.StatusConflict, "User already exists")
 		return
 	}
 
-	userID := fmt.Sprintf("%d", user.ID)
-	jwtToken, err := a.GenerateJWT(userID)
-	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-		return
-	}
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    jwtToken,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteLaxMode,
-		MaxAge:   86400,
-	})
+	a.recordEvent(loginContext(r, user.ID), audit.Event{Action: audit.ActionUserRegister, Target: user.Username})
+	a.startSession(w, r, user.ID)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"access_token": "%s"}`, jwtToken)
+// loginContext attributes the events of a request to the user who is logging
+// in with it, since it carries no Principal yet.
+func loginContext(r *http.Request, userID int32) context.Context {
+	return audit.WithActor(r.Context(), audit.Actor{UserID: userID, SourceIP: audit.SourceIP(r)})
 }
 
-func (a *AuthService) MeHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.Header.Get("X-User-ID")
-	if userID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+// recordEvent records an audit event for a change that already happened, so
+// failures are only logged.
+func (a *AuthService) recordEvent(ctx context.Context, event audit.Event) {
+	if err := audit.Record(ctx, a.queries, event); err != nil {
+		slog.Error("Failed to record audit event", "action", event.Action, "target", event.Target, "error", err)
 	}
+}
 
-	userIDInt, err := strconv.ParseInt(userID, 10, 32)
-	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+func (a *AuthService) MeHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, r, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	row, err := a.queries.GetUserByID(r.Context(), int32(userIDInt))
+	row, err := a.queries.GetUserByID(r.Context(), principal.UserID)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		writeJSONError(w, r, http.StatusNotFound, "User not found")
 		return
 	}
 
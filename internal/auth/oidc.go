@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Gmacem/wasmorph/internal/audit"
+	"github.com/Gmacem/wasmorph/internal/oidc"
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// The login handler keeps the state, nonce and PKCE verifier of a login in a
+// cookie that only the callback receives, so that the callback can tell that
+// the browser which started the login is the one finishing it.
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/api/v1/auth/oidc"
+	oidcStateTTL        = 10 * time.Minute
+)
+
+var (
+	errNoOIDCUser    = errors.New("no user matches the identity")
+	errUsernameTaken = errors.New("username or email is already taken")
+)
+
+// OIDCConfig enables logging in through an OpenID provider. Provider is nil
+// when single sign-on is disabled.
+type OIDCConfig struct {
+	Provider *oidc.Provider
+	// AutoProvision creates a user for a provider account that matches no
+	// existing one. Without it, or while registration is disabled, such
+	// logins are refused.
+	AutoProvision bool
+	// LinkByEmail links a provider account on its first login to the user
+	// with the email the provider verified. Local emails are not verified,
+	// so this is only safe when the provider and wasmorph agree on who owns
+	// an address; otherwise anyone could claim another's account by
+	// registering their email first.
+	LinkByEmail bool
+}
+
+// OIDCLoginHandler sends the browser to the provider to log in.
+func (a *AuthService) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider := a.config.OIDC.Provider
+	if provider == nil {
+		writeJSONError(w, r, http.StatusNotFound, "Single sign-on is not configured")
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		value, err := oidc.RandomString()
+		if err != nil {
+			writeJSONError(w, r, http.StatusInternalServerError, "Failed to start login")
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    strings.Join(values[:], "."),
+		Path:     oidcStateCookiePath,
+		HttpOnly: true,
+		Secure:   false,
+		// The provider redirects back with a top-level GET, which Lax allows.
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(oidcStateTTL.Seconds()),
+	})
+	http.Redirect(w, r, provider.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+}
+
+// OIDCCallbackHandler finishes a login started by OIDCLoginHandler. It starts
+// a session for the user the provider vouched for and redirects to the UI.
+func (a *AuthService) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider := a.config.OIDC.Provider
+	if provider == nil {
+		writeJSONError(w, r, http.StatusNotFound, "Single sign-on is not configured")
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oidcStateCookiePath, HttpOnly: true, MaxAge: -1})
+	if err != nil {
+		writeJSONError(w, r, http.StatusBadRequest, "Login expired, please try again")
+		return
+	}
+	values := strings.Split(cookie.Value, ".")
+	state := r.URL.Query().Get("state")
+	if len(values) != 3 || subtle.ConstantTimeCompare([]byte(values[0]), []byte(state)) != 1 {
+		writeJSONError(w, r, http.StatusBadRequest, "Invalid login state")
+		return
+	}
+	nonce, verifier := values[1], values[2]
+
+	if reason := r.URL.Query().Get("error"); reason != "" {
+		writeJSONError(w, r, http.StatusUnauthorized, "Login failed: "+reason)
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), r.URL.Query().Get("code"), verifier, nonce)
+	if err != nil {
+		slog.Warn("OIDC login failed", "error", err)
+		writeJSONError(w, r, http.StatusUnauthorized, "Login failed")
+		return
+	}
+
+	userID, err := a.oidcUser(r.Context(), provider.Issuer(), claims)
+	switch {
+	case errors.Is(err, errNoOIDCUser):
+		writeJSONError(w, r, http.StatusForbidden, "No wasmorph account is linked to this identity")
+		return
+	case errors.Is(err, errUsernameTaken):
+		writeJSONError(w, r, http.StatusConflict, "Cannot create an account: "+err.Error())
+		return
+	case err != nil:
+		slog.Error("Failed to find OIDC user", "subject", claims.Subject, "error", err)
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+
+	if user, err := a.queries.GetUserByID(r.Context(), userID); err == nil {
+		a.recordEvent(loginContext(r, userID), audit.Event{Action: audit.ActionUserLogin, Target: user.Username, Detail: "oidc"})
+	}
+
+	sessionID, refreshToken, err := a.createSession(r.Context(), userID)
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+	if _, err := a.setSessionCookies(w, userID, sessionID, refreshToken); err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// oidcUser returns the user that the provider account logs in as. An account
+// logs in as the user it was linked to on its first login. Until then it is
+// linked to the user with its email, if the provider verified it and linking
+// by email is enabled, or to a new user if auto-provisioning is enabled and
+// registration is not disabled.
+func (a *AuthService) oidcUser(ctx context.Context, issuer string, claims oidc.Claims) (int32, error) {
+	userID, err := a.queries.GetUserIDByIdentity(ctx, sql.GetUserIDByIdentityParams{
+		Issuer:  issuer,
+		Subject: claims.Subject,
+	})
+	if err == nil {
+		return userID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+
+	var email pgtype.Text
+	if claims.Email != "" && claims.EmailVerified {
+		email = pgtype.Text{String: claims.Email, Valid: true}
+	}
+	if email.Valid && a.config.OIDC.LinkByEmail {
+		user, err := a.queries.GetUserByEmail(ctx, email)
+		if err == nil {
+			userID = user.ID
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return 0, err
+		}
+	}
+
+	if userID == 0 {
+		if !a.config.OIDC.AutoProvision || a.config.DisableRegistration {
+			return 0, errNoOIDCUser
+		}
+		userID, err = a.provisionUser(ctx, claims, email)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = a.queries.CreateUserIdentity(ctx, sql.CreateUserIdentityParams{
+		Issuer:  issuer,
+		Subject: claims.Subject,
+		UserID:  userID,
+		Email:   pgtype.Text{String: claims.Email, Valid: claims.Email != ""},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to link identity: %w", err)
+	}
+	return userID, nil
+}
+
+// provisionUser creates a user named after the provider account. It gets a
+// random password that nobody knows, so it can only log in through the
+// provider.
+func (a *AuthService) provisionUser(ctx context.Context, claims oidc.Claims, email pgtype.Text) (int32, error) {
+	username := claims.PreferredUsername
+	if username == "" {
+		username, _, _ = strings.Cut(claims.Email, "@")
+	}
+	if username == "" {
+		return 0, fmt.Errorf("%w: the provider sent no username or email", errNoOIDCUser)
+	}
+
+	password, err := oidc.RandomString()
+	if err != nil {
+		return 0, err
+	}
+	passwordHash, err := HashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	user, err := a.queries.CreateUser(ctx, sql.CreateUserParams{
+		Username:     username,
+		Email:        email,
+		PasswordHash: passwordHash,
+		IsActive:     pgtype.Bool{Bool: true, Valid: true},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", errUsernameTaken, username)
+	}
+	return user.ID, nil
+}
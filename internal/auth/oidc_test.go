@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Gmacem/wasmorph/internal/oidc"
+	"github.com/Gmacem/wasmorph/internal/oidc/oidctest"
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// identitiesDB links the identity "alice-id" to identityUserID, if it is set,
+// has emailUserID registered with alice@example.com, if it is set, and gives
+// every new session the ID 3.
+type identitiesDB struct {
+	identityUserID int32
+	emailUserID    int32
+}
+
+func (db identitiesDB) Exec(_ context.Context, query string, _ ...interface{}) (pgconn.CommandTag, error) {
+	if strings.HasPrefix(query, "-- name: CreateUserIdentity ") {
+		return pgconn.CommandTag{}, nil
+	}
+	return pgconn.CommandTag{}, errors.New("not implemented")
+}
+
+func (db identitiesDB) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (db identitiesDB) QueryRow(_ context.Context, query string, args ...interface{}) pgx.Row {
+	switch {
+	case strings.HasPrefix(query, "-- name: GetUserIDByIdentity "):
+		if db.identityUserID == 0 || args[1] != "alice-id" {
+			return idRow(0)
+		}
+		return idRow(db.identityUserID)
+	case strings.HasPrefix(query, "-- name: GetUserByEmail "):
+		if args[0].(pgtype.Text).String != "alice@example.com" {
+			return idRow(0)
+		}
+		return idRow(db.emailUserID)
+	case strings.HasPrefix(query, "-- name: CreateSession "):
+		return idRow(3)
+	}
+	return idRow(0)
+}
+
+// idRow scans into a single int32; zero means no rows.
+type idRow int32
+
+func (r idRow) Scan(dest ...any) error {
+	if r == 0 {
+		return pgx.ErrNoRows
+	}
+	*dest[0].(*int32) = int32(r)
+	return nil
+}
+
+func newTestOIDCService(t *testing.T, db identitiesDB) (*AuthService, *oidctest.Issuer) {
+	issuer := oidctest.NewIssuer("wasmorph", "secret")
+	t.Cleanup(issuer.Close)
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		IssuerURL:    issuer.URL,
+		ClientID:     "wasmorph",
+		ClientSecret: "secret",
+		RedirectURL:  "http://wasmorph.test/api/v1/auth/oidc/callback",
+	})
+	require.NoError(t, err)
+
+	return &AuthService{
+		config:  Config{JWTSecret: "test-secret", OIDC: OIDCConfig{Provider: provider}},
+		queries: sql.New(db),
+	}, issuer
+}
+
+// startOIDCLogin runs the login handler and follows its redirect to the
+// issuer, returning the state cookie and the callback request the issuer
+// redirects back with.
+func startOIDCLogin(t *testing.T, a *AuthService) (*http.Cookie, *http.Request) {
+	rec := httptest.NewRecorder()
+	a.OIDCLoginHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil))
+	require.Equal(t, http.StatusFound, rec.Code)
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, oidcStateCookie, cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	return cookies[0], httptest.NewRequest(http.MethodGet, callback.String(), nil)
+}
+
+// finishOIDCLogin runs a login for the issuer's current user and returns
+// the response of the callback.
+func finishOIDCLogin(t *testing.T, a *AuthService) *httptest.ResponseRecorder {
+	stateCookie, callback := startOIDCLogin(t, a)
+	callback.AddCookie(stateCookie)
+	rec := httptest.NewRecorder()
+	a.OIDCCallbackHandler(rec, callback)
+	return rec
+}
+
+// sessionUserID returns the user of the session the response started.
+func sessionUserID(t *testing.T, a *AuthService, rec *httptest.ResponseRecorder) int32 {
+	var session string
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == sessionCookie {
+			session = cookie.Value
+		}
+	}
+	userID, sessionID, err := a.ValidateJWT(session)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), sessionID)
+	return userID
+}
+
+func TestOIDCLoginStartsSession(t *testing.T) {
+	a, issuer := newTestOIDCService(t, identitiesDB{identityUserID: 42})
+	issuer.SetUser(map[string]any{"sub": "alice-id"})
+
+	rec := finishOIDCLogin(t, a)
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+	assert.Equal(t, "/", rec.Header().Get("Location"))
+	assert.Equal(t, int32(42), sessionUserID(t, a, rec))
+}
+
+func TestOIDCLinkByEmail(t *testing.T) {
+	a, issuer := newTestOIDCService(t, identitiesDB{emailUserID: 7})
+	issuer.SetUser(map[string]any{"sub": "other-id", "email": "alice@example.com", "email_verified": true})
+
+	rec := finishOIDCLogin(t, a)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "accounts must not be linked by email unless enabled")
+
+	a.config.OIDC.LinkByEmail = true
+	rec = finishOIDCLogin(t, a)
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+	assert.Equal(t, int32(7), sessionUserID(t, a, rec))
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	a, issuer := newTestOIDCService(t, identitiesDB{})
+
+	_, callback := startOIDCLogin(t, a)
+	rec := httptest.NewRecorder()
+	a.OIDCCallbackHandler(rec, callback)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "a callback without the state cookie must be refused")
+
+	_, callback = startOIDCLogin(t, a)
+	otherCookie, _ := startOIDCLogin(t, a)
+	callback.AddCookie(otherCookie)
+	rec = httptest.NewRecorder()
+	a.OIDCCallbackHandler(rec, callback)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "a callback for another login must be refused")
+
+	issuer.SetUser(map[string]any{"sub": "mallory-id", "email": "alice@example.com", "email_verified": false})
+	stateCookie, callback := startOIDCLogin(t, a)
+	callback.AddCookie(stateCookie)
+	rec = httptest.NewRecorder()
+	a.OIDCCallbackHandler(rec, callback)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "unknown identities must not log in without auto-provisioning")
+
+	a.config.OIDC.AutoProvision = true
+	a.config.DisableRegistration = true
+	stateCookie, callback = startOIDCLogin(t, a)
+	callback.AddCookie(stateCookie)
+	rec = httptest.NewRecorder()
+	a.OIDCCallbackHandler(rec, callback)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "auto-provisioning must not create users while registration is disabled")
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordCost is the bcrypt cost of newly hashed passwords. Hashes made with
+// a lower cost are upgraded on the next successful login.
+const passwordCost = bcrypt.DefaultCost
+
+// maxPasswordBytes is the longest password bcrypt accepts.
+const maxPasswordBytes = 72
+
+var ErrPasswordTooLong = errors.New("password must be at most 72 bytes")
+
+// dummyPasswordHash is checked against when a login names an unknown user, so
+// that the response takes as long as for a wrong password.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("wasmorph"), passwordCost)
+
+// HashPassword returns the bcrypt hash of password to store in the database.
+func HashPassword(password string) (string, error) {
+	if len(password) > maxPasswordBytes {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// VerifyPassword reports whether password matches the stored hash, and
+// whether the stored value should be replaced by a fresh HashPassword.
+// Accounts created before passwords were hashed store them in plaintext;
+// those still verify, in constant time, and always need a rehash.
+func VerifyPassword(stored, password string) (ok, needsRehash bool) {
+	if !isBcryptHash(stored) {
+		// Comparing digests keeps the time independent of both lengths.
+		storedSum := sha256.Sum256([]byte(stored))
+		passwordSum := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare(storedSum[:], passwordSum[:]) == 1, true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(stored))
+	return true, err != nil || cost < passwordCost
+}
+
+func isBcryptHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") ||
+		strings.HasPrefix(stored, "$2b$") ||
+		strings.HasPrefix(stored, "$2y$")
+}
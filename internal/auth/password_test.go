@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, "secret", hash)
+
+	ok, needsRehash := VerifyPassword(hash, "secret")
+	assert.True(t, ok)
+	assert.False(t, needsRehash)
+
+	ok, _ = VerifyPassword(hash, "wrong")
+	assert.False(t, ok)
+
+	_, err = HashPassword(strings.Repeat("x", maxPasswordBytes+1))
+	assert.ErrorIs(t, err, ErrPasswordTooLong)
+}
+
+func TestVerifyPlaintextPassword(t *testing.T) {
+	ok, needsRehash := VerifyPassword("secret", "secret")
+	assert.True(t, ok)
+	assert.True(t, needsRehash)
+
+	ok, _ = VerifyPassword("secret", "wrong")
+	assert.False(t, ok)
+
+	ok, _ = VerifyPassword("secret", "")
+	assert.False(t, ok)
+}
+
+func TestVerifyPasswordLowCost(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	ok, needsRehash := VerifyPassword(string(hash), "secret")
+	assert.True(t, ok)
+	assert.True(t, needsRehash)
+}
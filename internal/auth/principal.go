@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+)
+
+// AuthMethod is how the user of a request proved who they are.
+type AuthMethod string
+
+const (
+	AuthMethodSession AuthMethod = "session"
+	AuthMethodAPIKey  AuthMethod = "api_key"
+)
+
+// Principal is who a request acts for, as established by AuthMiddleware.
+// Handlers must take the user from here and never from request headers.
+type Principal struct {
+	UserID int32
+	// WorkspaceID is the workspace selected with the X-Workspace-ID header or
+	// the workspace query parameter. Zero selects the user's personal
+	// workspace.
+	WorkspaceID int32
+	Method      AuthMethod
+	// SessionID is only set for sessions.
+	SessionID int32
+	// APIKeyID, Scopes and RulePatterns are only set for API keys.
+	// RulePatterns are path.Match patterns on rule names; none means every
+	// rule.
+	APIKeyID     int32
+	Scopes       []string
+	RulePatterns []string
+}
+
+type contextKey int
+
+const (
+	principalContextKey contextKey = iota
+	denialContextKey
+)
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey, principal)
+}
+
+// PrincipalFromContext returns the principal of an authenticated request.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// WithDenial returns a context in which Deny marks the request as refused,
+// and a function that reports whether it was.
+func WithDenial(ctx context.Context) (context.Context, func() bool) {
+	denied := new(bool)
+	return context.WithValue(ctx, denialContextKey, denied), func() bool { return *denied }
+}
+
+// Deny marks the request of ctx as refused by an authorization check. The
+// status it is answered with does not tell: workspaces the caller is not a
+// member of are reported as not found.
+func Deny(ctx context.Context) {
+	if denied, ok := ctx.Value(denialContextKey).(*bool); ok {
+		*denied = true
+	}
+}
+
+// HasScope reports whether the principal may do what requires scope. Only
+// API keys are limited by scopes.
+func (p *Principal) HasScope(scope string) bool {
+	return p.Method != AuthMethodAPIKey || slices.Contains(p.Scopes, scope)
+}
+
+// AllowsRule reports whether the principal may access the rule with the given
+// name.
+func (p *Principal) AllowsRule(name string) bool {
+	if p.Method != AuthMethodAPIKey || len(p.RulePatterns) == 0 {
+		return true
+	}
+	for _, pattern := range p.RulePatterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// selectedWorkspace returns the workspace ID the client asked for, or zero if
+// it did not ask for one. ok is false if the ID is invalid.
+func selectedWorkspace(r *http.Request) (workspaceID int32, ok bool) {
+	selected := r.Header.Get("X-Workspace-ID")
+	if selected == "" {
+		selected = r.URL.Query().Get("workspace")
+	}
+	if selected == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseInt(selected, 10, 32)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return int32(id), true
+}
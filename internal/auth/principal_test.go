@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// existsDB answers queries for whether a row exists, such as IsSessionActive
+// and IsUserAdmin, from the set of IDs that do.
+type existsDB map[int32]bool
+
+func (db existsDB) Exec(context.Context, string, ...interface{}) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errors.New("not implemented")
+}
+
+func (db existsDB) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (db existsDB) QueryRow(_ context.Context, _ string, args ...interface{}) pgx.Row {
+	return activeRow(db[args[0].(int32)])
+}
+
+type activeRow bool
+
+func (r activeRow) Scan(dest ...any) error {
+	*dest[0].(*bool) = bool(r)
+	return nil
+}
+
+func newTestAuthService(activeSessions ...int32) *AuthService {
+	db := existsDB{}
+	for _, id := range activeSessions {
+		db[id] = true
+	}
+	return &AuthService{config: Config{JWTSecret: "test-secret"}, queries: sql.New(db)}
+}
+
+func TestAuthMiddlewareSetsPrincipal(t *testing.T) {
+	a := newTestAuthService(3)
+	token, err := a.GenerateJWT(42, 3)
+	require.NoError(t, err)
+
+	var got *Principal
+	handler := a.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/rules?workspace=7", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: token})
+	req.Header.Set("X-User-ID", "1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, got)
+	assert.Equal(t, int32(42), got.UserID, "the X-User-ID header must be ignored")
+	assert.Equal(t, int32(7), got.WorkspaceID)
+	assert.Equal(t, AuthMethodSession, got.Method)
+	assert.Equal(t, int32(3), got.SessionID)
+	assert.True(t, got.HasScope(ScopeKeysManage))
+}
+
+func TestAuthMiddlewareRejects(t *testing.T) {
+	a := newTestAuthService(3)
+	token, err := a.GenerateJWT(42, 3)
+	require.NoError(t, err)
+	revoked, err := a.GenerateJWT(42, 4)
+	require.NoError(t, err)
+
+	handler := a.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler must not be called")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/rules", nil)
+	req.Header.Set("X-User-ID", "42")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/rules", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: token})
+	req.Header.Set("X-Workspace-ID", "billing")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/rules", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: revoked})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "tokens of revoked sessions must be refused")
+}
+
+func TestValidateJWT(t *testing.T) {
+	a := newTestAuthService()
+	token, err := a.GenerateJWT(42, 3)
+	require.NoError(t, err)
+
+	userID, sessionID, err := a.ValidateJWT(token)
+	require.NoError(t, err)
+	assert.Equal(t, int32(42), userID)
+	assert.Equal(t, int32(3), sessionID)
+
+	other := &AuthService{config: Config{JWTSecret: "other-secret"}}
+	_, _, err = other.ValidateJWT(token)
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Gmacem/wasmorph/internal/wasm"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrincipalAllowsRule(t *testing.T) {
+	unrestricted := &Principal{Method: AuthMethodAPIKey}
+	assert.True(t, unrestricted.AllowsRule("anything"))
+
+	restricted := &Principal{Method: AuthMethodAPIKey, RulePatterns: []string{"billing-*", "invoice"}}
+	assert.True(t, restricted.AllowsRule("billing-eu"))
+	assert.True(t, restricted.AllowsRule("invoice"))
+	assert.False(t, restricted.AllowsRule("invoice-v2"))
+	assert.False(t, restricted.AllowsRule("shipping"))
+}
+
+func TestValidateScopes(t *testing.T) {
+	assert.NoError(t, validateScopes([]string{ScopeRulesExecute}))
+	assert.NoError(t, validateScopes(knownScopes))
+	assert.Error(t, validateScopes(nil))
+	assert.Error(t, validateScopes([]string{"rules:admin"}))
+}
+
+func TestValidateRulePatterns(t *testing.T) {
+	assert.NoError(t, validateRulePatterns(nil))
+	assert.NoError(t, validateRulePatterns([]string{"billing-*", "a?c"}))
+	assert.Error(t, validateRulePatterns([]string{""}))
+	assert.Error(t, validateRulePatterns([]string{"[billing"}))
+}
+
+func TestRequireScope(t *testing.T) {
+	r := chi.NewRouter()
+	r.With(RequireScope(ScopeRulesExecute)).Post("/rules/{name}/execute", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		rule      string
+		want      int
+	}{
+		{"session", &Principal{Method: AuthMethodSession}, "billing", http.StatusOK},
+		{"scoped key", &Principal{Method: AuthMethodAPIKey, Scopes: []string{ScopeRulesExecute}}, "billing", http.StatusOK},
+		{"missing scope", &Principal{Method: AuthMethodAPIKey, Scopes: []string{ScopeRulesRead}}, "billing", http.StatusForbidden},
+		{"matching pattern", &Principal{Method: AuthMethodAPIKey, Scopes: []string{ScopeRulesExecute}, RulePatterns: []string{"bill*"}}, "billing", http.StatusOK},
+		{"other rule", &Principal{Method: AuthMethodAPIKey, Scopes: []string{ScopeRulesExecute}, RulePatterns: []string{"bill*"}}, "shipping", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/rules/"+tt.rule+"/execute", nil)
+			ctx, denied := WithDenial(WithPrincipal(req.Context(), tt.principal))
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req.WithContext(ctx))
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Equal(t, tt.want == http.StatusForbidden, denied())
+			if tt.want == http.StatusForbidden {
+				var body errorResponse
+				require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+				assert.Equal(t, wasm.CodeForbidden, body.Code)
+				assert.NotEmpty(t, body.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// A login starts a session. The browser holds a short-lived access token in
+// the session cookie and a refresh token that trades itself for a new pair of
+// tokens. Only a hash of the current refresh token is stored, and revoking the
+// session makes its access tokens fail the check in AuthMiddleware.
+const (
+	accessTokenTTL    = 15 * time.Minute
+	refreshTokenTTL   = 30 * 24 * time.Hour
+	refreshTokenBytes = 32
+
+	sessionCookie = "session"
+	refreshCookie = "refresh_token"
+	// The refresh token is only sent to the endpoints that need it.
+	refreshCookiePath = "/api/v1/auth"
+)
+
+func generateRefreshToken() (string, error) {
+	buf := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// startSession creates a session for a user who just proved who they are and
+// responds with its tokens.
+func (a *AuthService) startSession(w http.ResponseWriter, r *http.Request, userID int32) {
+	sessionID, refreshToken, err := a.createSession(r.Context(), userID)
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+
+	a.writeTokens(w, r, userID, sessionID, refreshToken)
+}
+
+func (a *AuthService) createSession(ctx context.Context, userID int32) (sessionID int32, refreshToken string, err error) {
+	refreshToken, err = generateRefreshToken()
+	if err != nil {
+		return 0, "", err
+	}
+
+	sessionID, err = a.queries.CreateSession(ctx, sql.CreateSessionParams{
+		UserID:           userID,
+		RefreshTokenHash: hashToken(refreshToken),
+		ExpiresAt:        pgtype.Timestamptz{Time: time.Now().Add(refreshTokenTTL), Valid: true},
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	return sessionID, refreshToken, nil
+}
+
+func (a *AuthService) writeTokens(w http.ResponseWriter, r *http.Request, userID, sessionID int32, refreshToken string) {
+	accessToken, err := a.setSessionCookies(w, userID, sessionID, refreshToken)
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": accessToken,
+		"expires_in":   int(accessTokenTTL.Seconds()),
+	})
+}
+
+// setSessionCookies issues an access token for the session and sets it and
+// the refresh token as cookies.
+func (a *AuthService) setSessionCookies(w http.ResponseWriter, userID, sessionID int32, refreshToken string) (string, error) {
+	accessToken, err := a.GenerateJWT(userID, sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    accessToken,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   false,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(accessTokenTTL.Seconds()),
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookie,
+		Value:    refreshToken,
+		Path:     refreshCookiePath,
+		HttpOnly: true,
+		Secure:   false,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(refreshTokenTTL.Seconds()),
+	})
+	return accessToken, nil
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", HttpOnly: true, MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{Name: refreshCookie, Path: refreshCookiePath, HttpOnly: true, MaxAge: -1})
+}
+
+func (a *AuthService) sessionActive(ctx context.Context, userID, sessionID int32) bool {
+	active, err := a.queries.IsSessionActive(ctx, sql.IsSessionActiveParams{
+		ID:     sessionID,
+		UserID: userID,
+	})
+	if err != nil {
+		slog.Error("Failed to check session", "session_id", sessionID, "error", err)
+		return false
+	}
+	return active
+}
+
+// RefreshHandler replaces the refresh token cookie with a new one and issues
+// a new access token for the same session.
+func (a *AuthService) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(refreshCookie)
+	if err != nil || cookie.Value == "" {
+		writeJSONError(w, r, http.StatusUnauthorized, "Refresh token required")
+		return
+	}
+
+	newToken, err := generateRefreshToken()
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	session, err := a.queries.RotateSession(r.Context(), sql.RotateSessionParams{
+		NewTokenHash: hashToken(newToken),
+		TokenHash:    hashToken(cookie.Value),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// A refresh token that was already traded in is being used again, so
+		// it leaked; end the session for whoever holds the current one.
+		if err := a.queries.RevokeSessionByPreviousToken(r.Context(), hashToken(cookie.Value)); err != nil {
+			slog.Error("Failed to revoke session after refresh token reuse", "error", err)
+		}
+		clearSessionCookies(w)
+		writeJSONError(w, r, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, r, http.StatusInternalServerError, "Failed to refresh session")
+		return
+	}
+
+	a.writeTokens(w, r, session.UserID, session.ID, newToken)
+}
+
+// LogoutHandler revokes the session of the request, or with ?all=true every
+// session of the user, such as ones started with a stolen password.
+func (a *AuthService) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if principal.Method != AuthMethodSession {
+		writeJSONError(w, r, http.StatusBadRequest, "Only sessions can log out; revoke the API key instead")
+		return
+	}
+
+	if all, _ := strconv.ParseBool(r.URL.Query().Get("all")); all {
+		err := a.queries.RevokeUserSessions(r.Context(), principal.UserID)
+		if err != nil {
+			writeJSONError(w, r, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+	} else {
+		err := a.queries.RevokeSession(r.Context(), sql.RevokeSessionParams{
+			ID:     principal.SessionID,
+			UserID: principal.UserID,
+		})
+		if err != nil {
+			writeJSONError(w, r, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+	}
+
+	clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
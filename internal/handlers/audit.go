@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Gmacem/wasmorph/internal/audit"
+	"github.com/Gmacem/wasmorph/internal/auth"
+	"github.com/Gmacem/wasmorph/internal/wasm"
+	"github.com/go-chi/chi/v5"
+)
+
+type AuditHandler struct {
+	auditService *audit.Service
+}
+
+func NewAuditHandler(auditService *audit.Service) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// ListEvents lists audit events, newest first. Every query parameter is an
+// optional filter; pass the ID of the last event as before to get the next
+// page.
+func (h *AuditHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Actor:  query.Get("actor"),
+		Action: audit.Action(query.Get("action")),
+		Target: query.Get("target"),
+	}
+
+	var invalid string
+	if v := query.Get("workspace_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || id <= 0 {
+			invalid = "Invalid workspace_id"
+		}
+		filter.WorkspaceID = int32(id)
+	}
+	if v := query.Get("before"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			invalid = "Invalid before"
+		}
+		filter.BeforeID = id
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || limit <= 0 {
+			invalid = "Invalid limit"
+		}
+		filter.Limit = int32(limit)
+	}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := query.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				invalid = "Invalid " + name + ", expected an RFC 3339 time"
+			}
+			*t = parsed
+		}
+	}
+	if invalid != "" {
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, invalid)
+		return
+	}
+
+	events, err := h.auditService.List(r.Context(), caller.UserID, filter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// RecordDenied records action for every request to the wrapped route that an
+// authorization check refuses, whether for a missing scope, a workspace role
+// or a workspace the caller is not a member of, which is answered with 404.
+// The rule is taken from the {name} route parameter.
+func RecordDenied(auditService *audit.Service, action audit.Action) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, denied := auth.WithDenial(r.Context())
+			next.ServeHTTP(w, r.WithContext(ctx))
+			if !denied() {
+				return
+			}
+
+			event := audit.Event{Action: action, Target: chi.URLParam(r, "name")}
+			if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+				event.WorkspaceID = principal.WorkspaceID
+			}
+			auditService.Record(r.Context(), event)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Gmacem/wasmorph/internal/auth"
+	"github.com/Gmacem/wasmorph/internal/wasm"
+	"github.com/Gmacem/wasmorph/internal/workspace"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// errorResponse is the body of every failed API request. Error stays a
+// string so that clients reading only it keep working; Code is what clients
+// should branch on.
+type errorResponse struct {
+	Error       string            `json:"error"`
+	Code        wasm.ErrorCode    `json:"code"`
+	RequestID   string            `json:"request_id,omitempty"`
+	Diagnostics []wasm.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// RequestID gives every request an ID, taken from the X-Request-Id request
+// header when the client sent one, and returns it in the X-Request-Id
+// response header. Error responses carry it too.
+func RequestID(next http.Handler) http.Handler {
+	return middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(middleware.RequestIDHeader, middleware.GetReqID(r.Context()))
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// writeError writes err with the status of its code. Internal errors are
+// logged and their message is not shown to the client. Workspace
+// authorization failures mark the request as denied.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, workspace.ErrNotFound) || errors.Is(err, workspace.ErrForbidden) {
+		auth.Deny(r.Context())
+	}
+	code := errorCode(err)
+	message := err.Error()
+	if code == wasm.CodeInternal {
+		slog.Error("Request failed", "request_id", middleware.GetReqID(r.Context()), "method", r.Method, "path", r.URL.Path, "error", err)
+		message = "Internal error"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(errorStatus(code))
+	json.NewEncoder(w).Encode(errorResponse{
+		Error:       message,
+		Code:        code,
+		RequestID:   middleware.GetReqID(r.Context()),
+		Diagnostics: wasm.DiagnosticsOf(err),
+	})
+}
+
+// writeErrorMessage writes an error found by the handler itself, such as a
+// malformed request.
+func writeErrorMessage(w http.ResponseWriter, r *http.Request, status int, code wasm.ErrorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{
+		Error:     message,
+		Code:      code,
+		RequestID: middleware.GetReqID(r.Context()),
+	})
+}
+
+func errorCode(err error) wasm.ErrorCode {
+	switch {
+	case errors.Is(err, workspace.ErrNotFound), errors.Is(err, workspace.ErrUserNotFound):
+		return wasm.CodeNotFound
+	case errors.Is(err, workspace.ErrForbidden):
+		return wasm.CodeForbidden
+	case errors.Is(err, workspace.ErrInvalid):
+		return wasm.CodeValidation
+	}
+	return wasm.ErrorCodeOf(err)
+}
+
+// statusClientClosedRequest is the nonstandard status, used by nginx among
+// others, of a request the client abandoned. The client seldom sees it, but it
+// keeps such requests apart from server errors in logs.
+const statusClientClosedRequest = 499
+
+func errorStatus(code wasm.ErrorCode) int {
+	switch code {
+	case wasm.CodeNotFound:
+		return http.StatusNotFound
+	case wasm.CodeValidation:
+		return http.StatusBadRequest
+	case wasm.CodeCompileError, wasm.CodeExecutionTrap, wasm.CodeMemoryLimit:
+		return http.StatusUnprocessableEntity
+	case wasm.CodeTimeout:
+		return http.StatusGatewayTimeout
+	case wasm.CodeCancelled:
+		return statusClientClosedRequest
+	case wasm.CodeConflict:
+		return http.StatusConflict
+	case wasm.CodeVersionMismatch:
+		return http.StatusPreconditionFailed
+	case wasm.CodeForbidden:
+		return http.StatusForbidden
+	case wasm.CodeUnauthorized:
+		return http.StatusUnauthorized
+	case wasm.CodeUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -2,9 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Gmacem/wasmorph/internal/auth"
 	"github.com/Gmacem/wasmorph/internal/wasm"
+	"github.com/Gmacem/wasmorph/internal/workspace"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -22,25 +28,45 @@ func (h *RulesHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name string `json:"name"`
 		Code string `json:"code"`
+		// Omitted metadata keeps the rule's current values.
+		Description *string           `json:"description"`
+		Tags        []string          `json:"tags"`
+		Labels      map[string]string `json:"labels"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, "Invalid JSON")
 		return
 	}
 
-	userID := r.Header.Get("X-User-ID")
-	rule, err := h.wasmService.SaveRule(r.Context(), userID, req.Name, req.Code)
+	if !auth.RuleAllowed(r.Context(), req.Name) {
+		auth.Deny(r.Context())
+		writeErrorMessage(w, r, http.StatusForbidden, wasm.CodeForbidden, "API key may not access rule "+req.Name)
+		return
+	}
+
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+	metadata := wasm.RuleMetadata{
+		Description: req.Description,
+		Tags:        req.Tags,
+		Labels:      req.Labels,
+	}
+	if wantsAsync(r) {
+		h.submitRuleBuild(w, r, caller, req.Name, req.Code, metadata)
+		return
+	}
+
+	rule, created, err := h.wasmService.SaveRule(r.Context(), caller, req.Name, req.Code, metadata)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		writeError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if rule.CreatedAt == rule.UpdatedAt {
+	w.Header().Set("ETag", ruleETag(rule.Version))
+	if created {
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(map[string]string{"message": "Rule created"})
 	} else {
@@ -49,37 +75,164 @@ func (h *RulesHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// wantsAsync reports whether the client asked for the build to run in the
+// background, either with ?async=true or a "Prefer: respond-async" header.
+func wantsAsync(r *http.Request) bool {
+	if async, err := strconv.ParseBool(r.URL.Query().Get("async")); err == nil && async {
+		return true
+	}
+	for _, pref := range strings.Split(r.Header.Get("Prefer"), ",") {
+		if strings.TrimSpace(pref) == "respond-async" {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *RulesHandler) submitRuleBuild(w http.ResponseWriter, r *http.Request, caller workspace.Caller, name, code string, metadata wasm.RuleMetadata) {
+	job, err := h.wasmService.SubmitRuleBuild(r.Context(), caller, name, code, metadata)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/builds/%d", job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{
+		"build_id": job.ID,
+		"status":   job.Status,
+	})
+}
+
+func (h *RulesHandler) GetBuild(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	buildID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, "Invalid build ID")
+		return
+	}
+
+	job, err := h.wasmService.GetBuild(r.Context(), caller, int32(buildID))
+	if err == nil && !auth.RuleAllowed(r.Context(), job.RuleName) {
+		auth.Deny(r.Context())
+		err = wasm.ErrBuildNotFound
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// ListRules returns a page of rules as a JSON array. When there are more, the
+// X-Next-Cursor header holds the cursor query parameter for the next page.
 func (h *RulesHandler) ListRules(w http.ResponseWriter, r *http.Request) {
-	userID := r.Header.Get("X-User-ID")
-	rules, err := h.wasmService.ListRules(r.Context(), userID)
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	query, err := ruleQuery(r)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, err.Error())
 		return
 	}
+	query.Allowed = func(name string) bool {
+		return auth.RuleAllowed(r.Context(), name)
+	}
 
+	page, err := h.wasmService.ListRules(r.Context(), caller, query)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(rules)
+	json.NewEncoder(w).Encode(page.Rules)
+}
+
+func ruleQuery(r *http.Request) (wasm.RuleQuery, error) {
+	params := r.URL.Query()
+	sort, err := wasm.ParseRuleSort(params.Get("sort"))
+	if err != nil {
+		return wasm.RuleQuery{}, err
+	}
+
+	query := wasm.RuleQuery{
+		Sort:   sort,
+		Cursor: params.Get("cursor"),
+		Name:   params.Get("q"),
+		Source: params.Get("source"),
+		Tags:   params["tag"],
+	}
+	for _, label := range params["label"] {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok || key == "" {
+			return wasm.RuleQuery{}, fmt.Errorf("label must be given as key=value")
+		}
+		if query.Labels == nil {
+			query.Labels = make(map[string]string)
+		}
+		query.Labels[key] = value
+	}
+	if v := params.Get("deleted"); v != "" {
+		query.Deleted, err = strconv.ParseBool(v)
+		if err != nil {
+			return wasm.RuleQuery{}, fmt.Errorf("deleted must be true or false")
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || limit <= 0 || limit > wasm.MaxRulePageSize {
+			return wasm.RuleQuery{}, fmt.Errorf("limit must be between 1 and %d", wasm.MaxRulePageSize)
+		}
+		query.Limit = int32(limit)
+	}
+	if v := params.Get("updated_since"); v != "" {
+		query.UpdatedSince, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			return wasm.RuleQuery{}, fmt.Errorf("updated_since must be an RFC 3339 time")
+		}
+	}
+	return query, nil
 }
 
 func (h *RulesHandler) ExecuteRule(w http.ResponseWriter, r *http.Request) {
 	name := chi.URLParam(r, "name")
-	userID := r.Header.Get("X-User-ID")
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	ref := wasm.VersionRef{Alias: r.URL.Query().Get("alias")}
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || version <= 0 {
+			writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, "Invalid version")
+			return
+		}
+		ref.Version = int32(version)
+	}
 
 	var input map[string]any
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, "Invalid JSON")
 		return
 	}
 
-	result, err := h.wasmService.ExecuteRule(r.Context(), userID, name, input)
+	result, err := h.wasmService.ExecuteRule(r.Context(), caller, name, ref, input)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		writeError(w, r, err)
 		return
 	}
 
@@ -94,27 +247,162 @@ func (h *RulesHandler) ExecuteRule(w http.ResponseWriter, r *http.Request) {
 
 func (h *RulesHandler) GetRule(w http.ResponseWriter, r *http.Request) {
 	name := chi.URLParam(r, "name")
-	userID := r.Header.Get("X-User-ID")
-	rule, err := h.wasmService.GetRule(r.Context(), userID, name)
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+	rule, err := h.wasmService.GetRule(r.Context(), caller, name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", ruleETag(rule.Version))
+	json.NewEncoder(w).Encode(rule)
+}
+
+type ruleUpdateRequest struct {
+	Code        *string           `json:"code"`
+	Description *string           `json:"description"`
+	Tags        []string          `json:"tags"`
+	Labels      map[string]string `json:"labels"`
+}
+
+// ReplaceRule updates an existing rule's code and the metadata present in the
+// request. It requires an If-Match header with the rule's ETag, or "*" to
+// overwrite whatever version is current.
+func (h *RulesHandler) ReplaceRule(w http.ResponseWriter, r *http.Request) {
+	var req ruleUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == nil {
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, "Invalid JSON: code is required")
+		return
+	}
+	if r.Header.Get("If-Match") == "" {
+		writeErrorMessage(w, r, http.StatusPreconditionRequired, wasm.CodeValidation, "If-Match header with the rule's ETag is required")
+		return
+	}
+	h.updateRule(w, r, req)
+}
+
+// PatchRule updates only the fields present in the request. The If-Match
+// header is optional.
+func (h *RulesHandler) PatchRule(w http.ResponseWriter, r *http.Request) {
+	var req ruleUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, "Invalid JSON")
+		return
+	}
+	h.updateRule(w, r, req)
+}
+
+func (h *RulesHandler) updateRule(w http.ResponseWriter, r *http.Request, req ruleUpdateRequest) {
+	name := chi.URLParam(r, "name")
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		writeErrorMessage(w, r, http.StatusPreconditionFailed, wasm.CodeVersionMismatch, "If-Match does not name a version of the rule")
+		return
+	}
+
+	rule, err := h.wasmService.UpdateRule(r.Context(), caller, name, wasm.RuleUpdate{
+		Version:    version,
+		SourceCode: req.Code,
+		Metadata: wasm.RuleMetadata{
+			Description: req.Description,
+			Tags:        req.Tags,
+			Labels:      req.Labels,
+		},
+	})
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		writeError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", ruleETag(rule.Version))
 	json.NewEncoder(w).Encode(rule)
 }
 
+// RenameRule gives a rule the name in the request body. An If-Match header,
+// when present, must carry the rule's current ETag.
+func (h *RulesHandler) RenameRule(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, "Invalid JSON: name is required")
+		return
+	}
+	if !auth.RuleAllowed(r.Context(), req.Name) {
+		auth.Deny(r.Context())
+		writeErrorMessage(w, r, http.StatusForbidden, wasm.CodeForbidden, "API key may not access rule "+req.Name)
+		return
+	}
+
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		writeErrorMessage(w, r, http.StatusPreconditionFailed, wasm.CodeVersionMismatch, "If-Match does not name a version of the rule")
+		return
+	}
+
+	if err := h.wasmService.RenameRule(r.Context(), caller, name, req.Name, version); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/rules/"+req.Name)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Rule renamed",
+		"name":    req.Name,
+	})
+}
+
+// ruleETag is the entity tag of a rule at version.
+func ruleETag(version int32) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatchVersion returns the rule version named by the If-Match header, or 0
+// when the header is absent or "*". It reports false when the header names no
+// version, which can never match.
+func ifMatchVersion(r *http.Request) (int32, bool) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, true
+	}
+	value = strings.TrimPrefix(value, "W/")
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 32)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return int32(version), true
+}
+
 func (h *RulesHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
 	name := chi.URLParam(r, "name")
-	userID := r.Header.Get("X-User-ID")
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
 
-	if err := h.wasmService.DeleteRule(r.Context(), userID, name); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	if err := h.wasmService.DeleteRule(r.Context(), caller, name); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -122,3 +410,222 @@ func (h *RulesHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Rule deleted"})
 }
+
+// RestoreRule brings back a deleted rule that has not been purged yet.
+func (h *RulesHandler) RestoreRule(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.wasmService.RestoreRule(r.Context(), caller, name); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Rule restored"})
+}
+
+// PurgeRule permanently removes a deleted rule, including its source code and
+// binaries.
+func (h *RulesHandler) PurgeRule(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.wasmService.PurgeRule(r.Context(), caller, name); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Rule purged"})
+}
+
+func (h *RulesHandler) ListRuleVersions(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+	versions, err := h.wasmService.ListRuleVersions(r.Context(), caller, name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+func (h *RulesHandler) RollbackRule(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.ParseInt(chi.URLParam(r, "version"), 10, 32)
+	if err != nil || version <= 0 {
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, "Invalid version")
+		return
+	}
+
+	rule, err := h.wasmService.RollbackRule(r.Context(), caller, name, int32(version))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"message":       "Rule rolled back",
+		"version":       rule.Version,
+		"restored_from": version,
+	})
+}
+
+func (h *RulesHandler) GetRuleLimits(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+	limits, err := h.wasmService.GetRuleLimits(r.Context(), caller, name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limits)
+}
+
+// UpdateRuleLimits changes only the limits present in the request body.
+func (h *RulesHandler) UpdateRuleLimits(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	limits, err := h.wasmService.GetRuleLimits(r.Context(), caller, name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, "Invalid JSON")
+		return
+	}
+
+	limits, err = h.wasmService.SetRuleLimits(r.Context(), caller, name, limits)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limits)
+}
+
+func (h *RulesHandler) ListRuleAliases(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+	aliases, err := h.wasmService.ListRuleAliases(r.Context(), caller, name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(aliases)
+}
+
+func (h *RulesHandler) SetRuleAlias(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	alias := chi.URLParam(r, "alias")
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Version int32 `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Version <= 0 {
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, "Invalid JSON: a positive version is required")
+		return
+	}
+
+	ruleAlias, err := h.wasmService.SetRuleAlias(r.Context(), caller, name, alias, req.Version)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"alias":   ruleAlias.Alias,
+		"version": ruleAlias.Version,
+	})
+}
+
+func (h *RulesHandler) DeleteRuleAlias(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	alias := chi.URLParam(r, "alias")
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.wasmService.DeleteRuleAlias(r.Context(), caller, name, alias); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Alias deleted"})
+}
+
+// TransferRule moves a rule to another workspace, given either by
+// "workspace_id" or by "username" for that user's personal workspace.
+func (h *RulesHandler) TransferRule(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		WorkspaceID int32  `json:"workspace_id"`
+		Username    string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, "Invalid JSON")
+		return
+	}
+
+	workspaceID, err := h.wasmService.TransferRule(r.Context(), caller, name, wasm.TransferTarget{
+		WorkspaceID: req.WorkspaceID,
+		Username:    req.Username,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"message":      "Rule transferred",
+		"workspace_id": workspaceID,
+	})
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Gmacem/wasmorph/internal/auth"
+	"github.com/Gmacem/wasmorph/internal/wasm"
+	"github.com/Gmacem/wasmorph/internal/workspace"
+	"github.com/go-chi/chi/v5"
+)
+
+type WorkspacesHandler struct {
+	workspaceService *workspace.Service
+}
+
+func NewWorkspacesHandler(workspaceService *workspace.Service) *WorkspacesHandler {
+	return &WorkspacesHandler{
+		workspaceService: workspaceService,
+	}
+}
+
+func (h *WorkspacesHandler) ListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	workspaces, err := h.workspaceService.List(r.Context(), caller.UserID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workspaces)
+}
+
+func (h *WorkspacesHandler) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, "Invalid JSON")
+		return
+	}
+
+	created, err := h.workspaceService.Create(r.Context(), caller.UserID, req.Name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (h *WorkspacesHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	caller, ok := workspaceCaller(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := h.workspaceService.ListMembers(r.Context(), caller)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+func (h *WorkspacesHandler) SetMember(w http.ResponseWriter, r *http.Request) {
+	caller, ok := workspaceCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, "Invalid JSON")
+		return
+	}
+	role, err := workspace.ParseRole(req.Role)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	member, err := h.workspaceService.SetMember(r.Context(), caller, chi.URLParam(r, "username"), role)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
+
+func (h *WorkspacesHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	caller, ok := workspaceCaller(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.workspaceService.RemoveMember(r.Context(), caller, chi.URLParam(r, "username")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestCaller returns the user that AuthMiddleware authenticated and the
+// workspace the request selected.
+func requestCaller(w http.ResponseWriter, r *http.Request) (workspace.Caller, bool) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		writeErrorMessage(w, r, http.StatusUnauthorized, wasm.CodeUnauthorized, "Unauthorized")
+		return workspace.Caller{}, false
+	}
+	return workspace.Caller{UserID: principal.UserID, WorkspaceID: principal.WorkspaceID}, true
+}
+
+// workspaceCaller is requestCaller for routes that name the workspace in the
+// {id} route parameter.
+func workspaceCaller(w http.ResponseWriter, r *http.Request) (workspace.Caller, bool) {
+	caller, ok := requestCaller(w, r)
+	if !ok {
+		return workspace.Caller{}, false
+	}
+
+	workspaceID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil || workspaceID <= 0 {
+		writeErrorMessage(w, r, http.StatusBadRequest, wasm.CodeValidation, "Invalid workspace ID")
+		return workspace.Caller{}, false
+	}
+	caller.WorkspaceID = int32(workspaceID)
+	return caller, true
+}
@@ -0,0 +1,123 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Gmacem/wasmorph/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Issuer) {
+	issuer := oidctest.NewIssuer("wasmorph", "secret")
+	t.Cleanup(issuer.Close)
+
+	provider, err := NewProvider(context.Background(), Config{
+		IssuerURL:    issuer.URL,
+		ClientID:     "wasmorph",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/api/v1/auth/oidc/callback",
+	})
+	require.NoError(t, err)
+	return provider, issuer
+}
+
+// authorize follows the login redirect and returns the authorization code.
+func authorize(t *testing.T, authURL, state string) string {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, state, location.Query().Get("state"))
+	return location.Query().Get("code")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	provider, issuer := newTestProvider(t)
+	issuer.SetUser(map[string]any{
+		"sub":                "alice-id",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+	})
+
+	code := authorize(t, provider.AuthCodeURL("state", "nonce", "verifier"), "state")
+
+	claims, err := provider.Exchange(context.Background(), code, "verifier", "nonce")
+	require.NoError(t, err)
+	assert.Equal(t, Claims{
+		Subject:           "alice-id",
+		Email:             "alice@example.com",
+		EmailVerified:     true,
+		PreferredUsername: "alice",
+	}, claims)
+}
+
+func TestExchangeRejectsWrongVerifierAndNonce(t *testing.T) {
+	provider, _ := newTestProvider(t)
+
+	code := authorize(t, provider.AuthCodeURL("state", "nonce", "verifier"), "state")
+	_, err := provider.Exchange(context.Background(), code, "other-verifier", "nonce")
+	assert.Error(t, err)
+
+	code = authorize(t, provider.AuthCodeURL("state", "nonce", "verifier"), "state")
+	_, err = provider.Exchange(context.Background(), code, "verifier", "other-nonce")
+	assert.Error(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	provider, issuer := newTestProvider(t)
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   issuer.URL,
+			"aud":   "wasmorph",
+			"sub":   "alice-id",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": "nonce",
+		}
+	}
+
+	_, err := provider.Verify(context.Background(), issuer.SignIDToken(valid()), "nonce")
+	require.NoError(t, err)
+
+	tests := map[string]func(jwt.MapClaims){
+		"other audience": func(c jwt.MapClaims) { c["aud"] = "other-client" },
+		"other issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"no expiry":      func(c jwt.MapClaims) { delete(c, "exp") },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+	}
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := valid()
+			modify(claims)
+			_, err := provider.Verify(context.Background(), issuer.SignIDToken(claims), "nonce")
+			assert.Error(t, err)
+		})
+	}
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodHS256, valid())
+	token, err := unsigned.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = provider.Verify(context.Background(), token, "nonce")
+	assert.Error(t, err, "only RS256 tokens may be accepted")
+}
+
+func TestNewProviderRejectsIssuerMismatch(t *testing.T) {
+	issuer := oidctest.NewIssuer("wasmorph", "secret")
+	defer issuer.Close()
+
+	_, err := NewProvider(context.Background(), Config{IssuerURL: issuer.URL + "/"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,26 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO wasmorph.audit_log (
+    actor_user_id, actor_api_key_id, source_ip, workspace_id,
+    action, target, detail, version_before, version_after
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+
+-- name: ListAuditEvents :many
+SELECT a.id, a.created_at, a.actor_user_id, u.username AS actor_username, a.actor_api_key_id,
+    a.source_ip, a.workspace_id, a.action, a.target, a.detail, a.version_before, a.version_after
+FROM wasmorph.audit_log a
+LEFT JOIN wasmorph.users u ON u.id = a.actor_user_id
+WHERE (sqlc.narg(visible_to)::int IS NULL
+        OR a.actor_user_id = sqlc.narg(visible_to)
+        OR a.workspace_id IN (
+            SELECT m.workspace_id FROM wasmorph.workspace_members m WHERE m.user_id = sqlc.narg(visible_to)
+        ))
+  AND (sqlc.narg(actor)::text IS NULL OR u.username = sqlc.narg(actor))
+  AND (sqlc.narg(workspace_id)::int IS NULL OR a.workspace_id = sqlc.narg(workspace_id))
+  AND (sqlc.narg(action)::text IS NULL OR a.action = sqlc.narg(action))
+  AND (sqlc.narg(target)::text IS NULL OR a.target = sqlc.narg(target))
+  AND (sqlc.narg(since)::timestamp IS NULL OR a.created_at >= sqlc.narg(since))
+  AND (sqlc.narg(until)::timestamp IS NULL OR a.created_at < sqlc.narg(until))
+  AND (sqlc.narg(before_id)::bigint IS NULL OR a.id < sqlc.narg(before_id))
+ORDER BY a.id DESC
+LIMIT sqlc.arg(max_results);
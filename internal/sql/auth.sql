@@ -1,6 +1,12 @@
 -- name: ValidateAPIKey :one
-SELECT user_id FROM wasmorph.api_keys 
-WHERE api_key = $1 AND is_active = true;
+SELECT k.id, k.user_id, k.scopes, k.rule_patterns FROM wasmorph.api_keys k
+JOIN wasmorph.users u ON u.id = k.user_id
+WHERE k.key_hash = $1 AND k.is_active = true AND u.is_active = true
+  AND (k.expires_at IS NULL OR k.expires_at > NOW());
+
+-- name: TouchAPIKey :exec
+UPDATE wasmorph.api_keys SET last_used_at = NOW()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
 
 -- name: GetUserByUsername :one
 SELECT id, username, password_hash, email, created_at, updated_at, is_active 
@@ -18,44 +24,342 @@ FROM wasmorph.users
 WHERE id = $1 AND is_active = true;
 
 -- name: CreateUser :one
-INSERT INTO wasmorph.users (username, email, password_hash, is_active)
-VALUES ($1, $2, $3, $4)
-RETURNING id, username, email, password_hash, created_at, updated_at, is_active;
+INSERT INTO wasmorph.users (username, email, password_hash, is_active, is_admin)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, username, email, password_hash, created_at, updated_at, is_active, is_admin;
+
+-- name: UpdateUserPassword :exec
+UPDATE wasmorph.users
+SET password_hash = $2, updated_at = NOW()
+WHERE id = $1;
 
 -- name: CreateAPIKey :one
-INSERT INTO wasmorph.api_keys (api_key, user_id, is_active)
-VALUES ($1, $2, $3)
-RETURNING id, api_key, user_id, created_at, is_active;
+INSERT INTO wasmorph.api_keys (key_hash, key_prefix, user_id, label, expires_at, scopes, rule_patterns)
+VALUES ($1, $2, $3, $4, $5::timestamptz, $6, $7)
+RETURNING id, user_id, created_at, is_active, label, last_used_at, expires_at, key_hash, key_prefix, scopes, rule_patterns;
+
+-- name: ListAPIKeysByUser :many
+SELECT id, key_prefix, label, created_at, last_used_at, expires_at, scopes, rule_patterns
+FROM wasmorph.api_keys
+WHERE user_id = $1 AND is_active = true
+ORDER BY id;
+
+-- name: RevokeAPIKey :execrows
+UPDATE wasmorph.api_keys SET is_active = false
+WHERE id = $1 AND user_id = $2 AND is_active = true;
+
+-- name: CreateSession :one
+INSERT INTO wasmorph.sessions (user_id, refresh_token_hash, expires_at)
+VALUES ($1, $2, $3::timestamptz)
+RETURNING id;
+
+-- name: RotateSession :one
+UPDATE wasmorph.sessions
+SET previous_token_hash = refresh_token_hash,
+    refresh_token_hash = sqlc.arg(new_token_hash),
+    refreshed_at = NOW()
+WHERE refresh_token_hash = sqlc.arg(token_hash) AND revoked_at IS NULL AND expires_at > NOW()
+RETURNING id, user_id;
+
+-- name: IsSessionActive :one
+SELECT EXISTS (
+    SELECT 1 FROM wasmorph.sessions s
+    JOIN wasmorph.users u ON u.id = s.user_id
+    WHERE s.id = $1 AND s.user_id = $2 AND s.revoked_at IS NULL AND s.expires_at > NOW()
+      AND u.is_active = true
+);
+
+-- name: RevokeSession :exec
+UPDATE wasmorph.sessions
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeSessionByPreviousToken :exec
+UPDATE wasmorph.sessions
+SET revoked_at = NOW()
+WHERE previous_token_hash = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserSessions :exec
+UPDATE wasmorph.sessions
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
 
 -- name: CreateRule :one
-INSERT INTO wasmorph.rules (name, user_id, source_code, wasm_binary, is_active)
-VALUES ($1, $2, $3, $4, $5)
-ON CONFLICT (name, user_id) 
+INSERT INTO wasmorph.rules (name, workspace_id, user_id, source_code, wasm_binary, is_active, description, tags, labels)
+VALUES (
+    sqlc.arg(name), sqlc.arg(workspace_id), sqlc.arg(user_id), sqlc.arg(source_code), sqlc.arg(wasm_binary), sqlc.arg(is_active),
+    COALESCE(sqlc.narg(description)::text, ''), COALESCE(sqlc.narg(tags)::text[], '{}'), COALESCE(sqlc.narg(labels)::jsonb, '{}')
+)
+ON CONFLICT (name, workspace_id) 
 DO UPDATE SET 
     source_code = EXCLUDED.source_code,
     wasm_binary = EXCLUDED.wasm_binary,
+    version = rules.version + 1,
     updated_at = NOW(),
-    is_active = EXCLUDED.is_active
-RETURNING id, name, user_id, source_code, wasm_binary, created_at, updated_at, is_active;
+    is_active = EXCLUDED.is_active,
+    description = COALESCE(sqlc.narg(description)::text, rules.description),
+    tags = COALESCE(sqlc.narg(tags)::text[], rules.tags),
+    labels = COALESCE(sqlc.narg(labels)::jsonb, rules.labels)
+RETURNING id, name, user_id, source_code, wasm_binary, created_at, updated_at, is_active, version, timeout_ms, max_memory_pages, max_output_bytes, min_instances, max_instances, workspace_id, description, tags, labels, deleted_at;
 
--- name: GetRuleByNameAndUser :one
-SELECT id, name, user_id, source_code, wasm_binary, created_at, updated_at, is_active
+-- name: GetRuleByNameAndWorkspace :one
+SELECT id, name, user_id, source_code, wasm_binary, created_at, updated_at, is_active, version, timeout_ms, max_memory_pages, max_output_bytes, min_instances, max_instances, workspace_id, description, tags, labels, deleted_at
 FROM wasmorph.rules
-WHERE name = $1 AND user_id = $2 AND is_active = true;
+WHERE name = $1 AND workspace_id = $2 AND is_active = true;
 
--- name: ListRulesByUser :many
-SELECT id, name, user_id, created_at, updated_at, is_active
+-- name: ListRulesByWorkspace :many
+SELECT id, name, user_id, created_at, updated_at, is_active, version, workspace_id, description, tags, labels, deleted_at
 FROM wasmorph.rules
-WHERE user_id = $1 AND is_active = true
+WHERE workspace_id = $1 AND is_active = true
 ORDER BY created_at DESC;
 
+-- name: ListRulesPageByCreated :many
+SELECT id, name, user_id, created_at, updated_at, is_active, version, workspace_id, description, tags, labels, deleted_at
+FROM wasmorph.rules
+WHERE workspace_id = sqlc.arg(workspace_id) AND is_active = true
+  AND (sqlc.narg(name_query)::text IS NULL OR name ILIKE '%' || sqlc.narg(name_query) || '%')
+  AND (sqlc.narg(source_query)::text IS NULL OR to_tsvector('simple', source_code) @@ plainto_tsquery('simple', sqlc.narg(source_query)))
+  AND (sqlc.narg(updated_since)::timestamptz IS NULL OR updated_at >= sqlc.narg(updated_since))
+  AND (sqlc.narg(tags)::text[] IS NULL OR tags @> sqlc.narg(tags))
+  AND (sqlc.narg(labels)::jsonb IS NULL OR labels @> sqlc.narg(labels))
+  AND (sqlc.narg(after_id)::int IS NULL OR (created_at, id) < (sqlc.narg(after_time)::timestamp, sqlc.narg(after_id)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: ListRulesPageByUpdated :many
+SELECT id, name, user_id, created_at, updated_at, is_active, version, workspace_id, description, tags, labels, deleted_at
+FROM wasmorph.rules
+WHERE workspace_id = sqlc.arg(workspace_id) AND is_active = true
+  AND (sqlc.narg(name_query)::text IS NULL OR name ILIKE '%' || sqlc.narg(name_query) || '%')
+  AND (sqlc.narg(source_query)::text IS NULL OR to_tsvector('simple', source_code) @@ plainto_tsquery('simple', sqlc.narg(source_query)))
+  AND (sqlc.narg(updated_since)::timestamptz IS NULL OR updated_at >= sqlc.narg(updated_since))
+  AND (sqlc.narg(tags)::text[] IS NULL OR tags @> sqlc.narg(tags))
+  AND (sqlc.narg(labels)::jsonb IS NULL OR labels @> sqlc.narg(labels))
+  AND (sqlc.narg(after_id)::int IS NULL OR (updated_at, id) < (sqlc.narg(after_time)::timestamp, sqlc.narg(after_id)))
+ORDER BY updated_at DESC, id DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: ListRulesPageByName :many
+SELECT id, name, user_id, created_at, updated_at, is_active, version, workspace_id, description, tags, labels, deleted_at
+FROM wasmorph.rules
+WHERE workspace_id = sqlc.arg(workspace_id) AND is_active = true
+  AND (sqlc.narg(name_query)::text IS NULL OR name ILIKE '%' || sqlc.narg(name_query) || '%')
+  AND (sqlc.narg(source_query)::text IS NULL OR to_tsvector('simple', source_code) @@ plainto_tsquery('simple', sqlc.narg(source_query)))
+  AND (sqlc.narg(updated_since)::timestamptz IS NULL OR updated_at >= sqlc.narg(updated_since))
+  AND (sqlc.narg(tags)::text[] IS NULL OR tags @> sqlc.narg(tags))
+  AND (sqlc.narg(labels)::jsonb IS NULL OR labels @> sqlc.narg(labels))
+  AND (sqlc.narg(after_name)::text IS NULL OR name > sqlc.narg(after_name))
+ORDER BY name
+LIMIT sqlc.arg(max_results);
+
 -- name: UpdateRule :one
 UPDATE wasmorph.rules
-SET source_code = $3, wasm_binary = $4, updated_at = NOW()
-WHERE name = $1 AND user_id = $2 AND is_active = true
-RETURNING id, name, user_id, source_code, wasm_binary, created_at, updated_at, is_active;
+SET source_code = COALESCE(sqlc.narg(source_code), source_code),
+    wasm_binary = COALESCE(sqlc.narg(wasm_binary), wasm_binary),
+    description = COALESCE(sqlc.narg(description)::text, description),
+    tags = COALESCE(sqlc.narg(tags)::text[], tags),
+    labels = COALESCE(sqlc.narg(labels)::jsonb, labels),
+    version = CASE WHEN sqlc.narg(source_code)::text IS NULL THEN version ELSE version + 1 END,
+    updated_at = NOW()
+WHERE name = sqlc.arg(name) AND workspace_id = sqlc.arg(workspace_id) AND is_active = true
+  AND version = sqlc.arg(expected_version)
+RETURNING id, name, user_id, source_code, wasm_binary, created_at, updated_at, is_active, version, timeout_ms, max_memory_pages, max_output_bytes, min_instances, max_instances, workspace_id, description, tags, labels, deleted_at;
+
+-- name: GetRuleLimits :one
+SELECT timeout_ms, max_memory_pages, max_output_bytes, min_instances, max_instances FROM wasmorph.rules
+WHERE name = $1 AND workspace_id = $2 AND is_active = true;
+
+-- name: UpdateRuleLimits :execrows
+UPDATE wasmorph.rules
+SET timeout_ms = $3, max_memory_pages = $4, max_output_bytes = $5,
+    min_instances = $6, max_instances = $7, updated_at = NOW()
+WHERE name = $1 AND workspace_id = $2 AND is_active = true;
 
 -- name: DeleteRule :exec
 UPDATE wasmorph.rules
-SET is_active = false, updated_at = NOW()
-WHERE name = $1 AND user_id = $2;
+SET is_active = false, deleted_at = NOW(), updated_at = NOW()
+WHERE name = $1 AND workspace_id = $2 AND is_active = true;
+
+-- name: RestoreRule :one
+UPDATE wasmorph.rules
+SET is_active = true, deleted_at = NULL, updated_at = NOW()
+WHERE name = $1 AND workspace_id = $2 AND is_active = false
+RETURNING version;
+
+-- name: PurgeDeletedRule :one
+DELETE FROM wasmorph.rules
+WHERE name = $1 AND workspace_id = $2 AND is_active = false
+RETURNING version;
+
+-- name: PurgeExpiredRules :many
+DELETE FROM wasmorph.rules
+WHERE is_active = false AND deleted_at < NOW() - sqlc.arg(retention)::interval
+RETURNING workspace_id, name, version;
+
+-- name: DeleteFinishedBuildJobs :exec
+DELETE FROM wasmorph.build_jobs
+WHERE workspace_id = $1 AND rule_name = $2 AND status IN ('succeeded', 'failed');
+
+-- name: ListDeletedRulesPage :many
+SELECT id, name, user_id, created_at, updated_at, is_active, version, workspace_id, description, tags, labels, deleted_at
+FROM wasmorph.rules
+WHERE workspace_id = sqlc.arg(workspace_id) AND is_active = false
+  AND (sqlc.narg(name_query)::text IS NULL OR name ILIKE '%' || sqlc.narg(name_query) || '%')
+  AND (sqlc.narg(source_query)::text IS NULL OR to_tsvector('simple', source_code) @@ plainto_tsquery('simple', sqlc.narg(source_query)))
+  AND (sqlc.narg(updated_since)::timestamptz IS NULL OR updated_at >= sqlc.narg(updated_since))
+  AND (sqlc.narg(tags)::text[] IS NULL OR tags @> sqlc.narg(tags))
+  AND (sqlc.narg(labels)::jsonb IS NULL OR labels @> sqlc.narg(labels))
+  AND (sqlc.narg(after_id)::int IS NULL OR (deleted_at, id) < (sqlc.narg(after_time)::timestamp, sqlc.narg(after_id)))
+ORDER BY deleted_at DESC, id DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: IsRuleDeleted :one
+SELECT EXISTS (
+    SELECT 1 FROM wasmorph.rules
+    WHERE name = $1 AND workspace_id = $2 AND is_active = false
+);
+
+-- name: MoveRule :execrows
+UPDATE wasmorph.rules
+SET workspace_id = sqlc.arg(target_workspace_id), updated_at = NOW()
+WHERE name = sqlc.arg(name) AND workspace_id = sqlc.arg(workspace_id) AND is_active = true;
+
+-- name: RenameRule :execrows
+UPDATE wasmorph.rules
+SET name = sqlc.arg(new_name), updated_at = NOW()
+WHERE name = sqlc.arg(name) AND workspace_id = sqlc.arg(workspace_id) AND is_active = true;
+
+-- name: NotifyRuleChanged :exec
+SELECT pg_notify('wasmorph_rules', sqlc.arg(payload)::text);
+
+-- name: CreateRuleVersion :one
+INSERT INTO wasmorph.rule_versions (rule_id, version, source_code, wasm_binary)
+VALUES ($1, $2, $3, $4)
+RETURNING id, rule_id, version, source_code, wasm_binary, created_at;
+
+-- name: ListRuleVersions :many
+SELECT v.id, v.rule_id, v.version, v.created_at
+FROM wasmorph.rule_versions v
+JOIN wasmorph.rules r ON r.id = v.rule_id
+WHERE r.name = $1 AND r.workspace_id = $2 AND r.is_active = true
+ORDER BY v.version DESC;
+
+-- name: GetRuleVersion :one
+SELECT v.id, v.rule_id, v.version, v.source_code, v.wasm_binary, v.created_at
+FROM wasmorph.rule_versions v
+JOIN wasmorph.rules r ON r.id = v.rule_id
+WHERE r.name = $1 AND r.workspace_id = $2 AND r.is_active = true AND v.version = $3;
+
+-- name: GetRuleHeadVersion :one
+SELECT version FROM wasmorph.rules
+WHERE name = $1 AND workspace_id = $2 AND is_active = true;
+
+-- name: GetRuleAliasVersion :one
+SELECT a.version
+FROM wasmorph.rule_aliases a
+JOIN wasmorph.rules r ON r.id = a.rule_id
+WHERE r.name = $1 AND r.workspace_id = $2 AND r.is_active = true AND a.alias = $3;
+
+-- name: SetRuleAlias :one
+INSERT INTO wasmorph.rule_aliases (rule_id, alias, version)
+VALUES ($1, $2, $3)
+ON CONFLICT (rule_id, alias)
+DO UPDATE SET version = EXCLUDED.version, updated_at = NOW()
+RETURNING rule_id, alias, version, created_at, updated_at;
+
+-- name: ListRuleAliases :many
+SELECT a.alias, a.version, a.created_at, a.updated_at
+FROM wasmorph.rule_aliases a
+JOIN wasmorph.rules r ON r.id = a.rule_id
+WHERE r.name = $1 AND r.workspace_id = $2 AND r.is_active = true
+ORDER BY a.alias;
+
+-- name: DeleteRuleAlias :execrows
+DELETE FROM wasmorph.rule_aliases a
+USING wasmorph.rules r
+WHERE a.rule_id = r.id AND r.name = $1 AND r.workspace_id = $2 AND r.is_active AND a.alias = $3;
+
+-- name: CreateBuildJob :one
+INSERT INTO wasmorph.build_jobs (user_id, workspace_id, rule_name, source_code, instance_id)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, user_id, rule_name, source_code, status, error, rule_version, created_at, started_at, finished_at, workspace_id, instance_id;
+
+-- name: StartBuildJob :exec
+UPDATE wasmorph.build_jobs
+SET status = 'running', started_at = NOW()
+WHERE id = $1;
+
+-- name: CompleteBuildJob :exec
+UPDATE wasmorph.build_jobs
+SET status = 'succeeded', rule_version = $2, finished_at = NOW()
+WHERE id = $1;
+
+-- name: FailBuildJob :exec
+UPDATE wasmorph.build_jobs
+SET status = 'failed', error = $2, finished_at = NOW()
+WHERE id = $1;
+
+-- name: ListUnfinishedBuildInstances :many
+SELECT DISTINCT instance_id FROM wasmorph.build_jobs
+WHERE status IN ('queued', 'running');
+
+-- name: FailInstanceBuildJobs :execrows
+UPDATE wasmorph.build_jobs
+SET status = 'failed', error = $2, finished_at = NOW()
+WHERE instance_id IS NOT DISTINCT FROM $1 AND status IN ('queued', 'running');
+
+-- name: LockInstance :exec
+SELECT pg_advisory_lock(sqlc.arg(instance_id)::bigint);
+
+-- name: TryLockInstance :one
+SELECT pg_try_advisory_lock(sqlc.arg(instance_id)::bigint);
+
+-- name: UnlockInstance :exec
+SELECT pg_advisory_unlock(sqlc.arg(instance_id)::bigint);
+
+-- name: GetBuildJob :one
+SELECT id, user_id, rule_name, status, error, rule_version, created_at, started_at, finished_at, workspace_id
+FROM wasmorph.build_jobs
+WHERE id = $1 AND workspace_id = $2;
+
+-- name: GetUserIDByIdentity :one
+SELECT u.id FROM wasmorph.user_identities i
+JOIN wasmorph.users u ON u.id = i.user_id
+WHERE i.issuer = $1 AND i.subject = $2 AND u.is_active = true;
+
+-- name: CreateUserIdentity :exec
+INSERT INTO wasmorph.user_identities (issuer, subject, user_id, email)
+VALUES ($1, $2, $3, $4);
+
+-- name: IsUserAdmin :one
+SELECT EXISTS (
+    SELECT 1 FROM wasmorph.users
+    WHERE id = $1 AND is_active = true AND is_admin = true
+);
+
+-- name: ListUserSummaries :many
+SELECT u.id, u.username, u.email, u.is_active, u.is_admin, u.created_at,
+    (SELECT COUNT(*) FROM wasmorph.rules r WHERE r.user_id = u.id AND r.is_active = true) AS rule_count,
+    (SELECT COUNT(*) FROM wasmorph.api_keys k WHERE k.user_id = u.id AND k.is_active = true
+        AND (k.expires_at IS NULL OR k.expires_at > NOW())) AS api_key_count
+FROM wasmorph.users u
+ORDER BY u.id;
+
+-- name: GetUserSummary :one
+SELECT u.id, u.username, u.email, u.is_active, u.is_admin, u.created_at,
+    (SELECT COUNT(*) FROM wasmorph.rules r WHERE r.user_id = u.id AND r.is_active = true) AS rule_count,
+    (SELECT COUNT(*) FROM wasmorph.api_keys k WHERE k.user_id = u.id AND k.is_active = true
+        AND (k.expires_at IS NULL OR k.expires_at > NOW())) AS api_key_count
+FROM wasmorph.users u
+WHERE u.id = $1;
+
+-- name: UpdateUserStatus :execrows
+UPDATE wasmorph.users
+SET is_active = COALESCE(sqlc.narg(is_active), is_active),
+    is_admin = COALESCE(sqlc.narg(is_admin), is_admin),
+    updated_at = NOW()
+WHERE id = sqlc.arg(id);
+
+-- name: RevokeUserAPIKeys :exec
+UPDATE wasmorph.api_keys SET is_active = false
+WHERE user_id = $1 AND is_active = true;
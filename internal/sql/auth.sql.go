@@ -7,62 +7,152 @@ package sql
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const completeBuildJob = `-- name: CompleteBuildJob :exec
+UPDATE wasmorph.build_jobs
+SET status = 'succeeded', rule_version = $2, finished_at = NOW()
+WHERE id = $1
+`
+
+type CompleteBuildJobParams struct {
+	ID          int32       `json:"id"`
+	RuleVersion pgtype.Int4 `json:"rule_version"`
+}
+
+func (q *Queries) CompleteBuildJob(ctx context.Context, arg CompleteBuildJobParams) error {
+	_, err := q.db.Exec(ctx, completeBuildJob, arg.ID, arg.RuleVersion)
+	return err
+}
+
 const createAPIKey = `-- name: CreateAPIKey :one
-INSERT INTO wasmorph.api_keys (api_key, user_id, is_active)
-VALUES ($1, $2, $3)
-RETURNING id, api_key, user_id, created_at, is_active
+INSERT INTO wasmorph.api_keys (key_hash, key_prefix, user_id, label, expires_at, scopes, rule_patterns)
+VALUES ($1, $2, $3, $4, $5::timestamptz, $6, $7)
+RETURNING id, user_id, created_at, is_active, label, last_used_at, expires_at, key_hash, key_prefix, scopes, rule_patterns
 `
 
 type CreateAPIKeyParams struct {
-	ApiKey   string      `json:"api_key"`
-	UserID   int32       `json:"user_id"`
-	IsActive pgtype.Bool `json:"is_active"`
+	KeyHash      string             `json:"key_hash"`
+	KeyPrefix    string             `json:"key_prefix"`
+	UserID       int32              `json:"user_id"`
+	Label        string             `json:"label"`
+	ExpiresAt    pgtype.Timestamptz `json:"expires_at"`
+	Scopes       []string           `json:"scopes"`
+	RulePatterns []string           `json:"rule_patterns"`
 }
 
 func (q *Queries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (WasmorphApiKey, error) {
-	row := q.db.QueryRow(ctx, createAPIKey, arg.ApiKey, arg.UserID, arg.IsActive)
+	row := q.db.QueryRow(ctx, createAPIKey,
+		arg.KeyHash,
+		arg.KeyPrefix,
+		arg.UserID,
+		arg.Label,
+		arg.ExpiresAt,
+		arg.Scopes,
+		arg.RulePatterns,
+	)
 	var i WasmorphApiKey
 	err := row.Scan(
 		&i.ID,
-		&i.ApiKey,
 		&i.UserID,
 		&i.CreatedAt,
 		&i.IsActive,
+		&i.Label,
+		&i.LastUsedAt,
+		&i.ExpiresAt,
+		&i.KeyHash,
+		&i.KeyPrefix,
+		&i.Scopes,
+		&i.RulePatterns,
 	)
 	return i, err
 }
 
-const createRule = `-- name: CreateRule :one
-INSERT INTO wasmorph.rules (name, user_id, source_code, wasm_binary, is_active)
+const createBuildJob = `-- name: CreateBuildJob :one
+INSERT INTO wasmorph.build_jobs (user_id, workspace_id, rule_name, source_code, instance_id)
 VALUES ($1, $2, $3, $4, $5)
-ON CONFLICT (name, user_id) 
+RETURNING id, user_id, rule_name, source_code, status, error, rule_version, created_at, started_at, finished_at, workspace_id, instance_id
+`
+
+type CreateBuildJobParams struct {
+	UserID      int32       `json:"user_id"`
+	WorkspaceID int32       `json:"workspace_id"`
+	RuleName    string      `json:"rule_name"`
+	SourceCode  string      `json:"source_code"`
+	InstanceID  pgtype.Int8 `json:"instance_id"`
+}
+
+func (q *Queries) CreateBuildJob(ctx context.Context, arg CreateBuildJobParams) (WasmorphBuildJob, error) {
+	row := q.db.QueryRow(ctx, createBuildJob,
+		arg.UserID,
+		arg.WorkspaceID,
+		arg.RuleName,
+		arg.SourceCode,
+		arg.InstanceID,
+	)
+	var i WasmorphBuildJob
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RuleName,
+		&i.SourceCode,
+		&i.Status,
+		&i.Error,
+		&i.RuleVersion,
+		&i.CreatedAt,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.WorkspaceID,
+		&i.InstanceID,
+	)
+	return i, err
+}
+
+const createRule = `-- name: CreateRule :one
+INSERT INTO wasmorph.rules (name, workspace_id, user_id, source_code, wasm_binary, is_active, description, tags, labels)
+VALUES (
+    $1, $2, $3, $4, $5, $6,
+    COALESCE($7::text, ''), COALESCE($8::text[], '{}'), COALESCE($9::jsonb, '{}')
+)
+ON CONFLICT (name, workspace_id) 
 DO UPDATE SET 
     source_code = EXCLUDED.source_code,
     wasm_binary = EXCLUDED.wasm_binary,
+    version = rules.version + 1,
     updated_at = NOW(),
-    is_active = EXCLUDED.is_active
-RETURNING id, name, user_id, source_code, wasm_binary, created_at, updated_at, is_active
+    is_active = EXCLUDED.is_active,
+    description = COALESCE($7::text, rules.description),
+    tags = COALESCE($8::text[], rules.tags),
+    labels = COALESCE($9::jsonb, rules.labels)
+RETURNING id, name, user_id, source_code, wasm_binary, created_at, updated_at, is_active, version, timeout_ms, max_memory_pages, max_output_bytes, min_instances, max_instances, workspace_id, description, tags, labels, deleted_at
 `
 
 type CreateRuleParams struct {
-	Name       string      `json:"name"`
-	UserID     int32       `json:"user_id"`
-	SourceCode string      `json:"source_code"`
-	WasmBinary []byte      `json:"wasm_binary"`
-	IsActive   pgtype.Bool `json:"is_active"`
+	Name        string          `json:"name"`
+	WorkspaceID int32           `json:"workspace_id"`
+	UserID      int32           `json:"user_id"`
+	SourceCode  string          `json:"source_code"`
+	WasmBinary  []byte          `json:"wasm_binary"`
+	IsActive    pgtype.Bool     `json:"is_active"`
+	Description pgtype.Text     `json:"description"`
+	Tags        []string        `json:"tags"`
+	Labels      json.RawMessage `json:"labels"`
 }
 
 func (q *Queries) CreateRule(ctx context.Context, arg CreateRuleParams) (WasmorphRule, error) {
 	row := q.db.QueryRow(ctx, createRule,
 		arg.Name,
+		arg.WorkspaceID,
 		arg.UserID,
 		arg.SourceCode,
 		arg.WasmBinary,
 		arg.IsActive,
+		arg.Description,
+		arg.Tags,
+		arg.Labels,
 	)
 	var i WasmorphRule
 	err := row.Scan(
@@ -74,14 +164,76 @@ func (q *Queries) CreateRule(ctx context.Context, arg CreateRuleParams) (Wasmorp
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.IsActive,
+		&i.Version,
+		&i.TimeoutMs,
+		&i.MaxMemoryPages,
+		&i.MaxOutputBytes,
+		&i.MinInstances,
+		&i.MaxInstances,
+		&i.WorkspaceID,
+		&i.Description,
+		&i.Tags,
+		&i.Labels,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const createUser = `-- name: CreateUser :one
-INSERT INTO wasmorph.users (username, email, password_hash, is_active)
+const createRuleVersion = `-- name: CreateRuleVersion :one
+INSERT INTO wasmorph.rule_versions (rule_id, version, source_code, wasm_binary)
 VALUES ($1, $2, $3, $4)
-RETURNING id, username, email, password_hash, created_at, updated_at, is_active
+RETURNING id, rule_id, version, source_code, wasm_binary, created_at
+`
+
+type CreateRuleVersionParams struct {
+	RuleID     int32  `json:"rule_id"`
+	Version    int32  `json:"version"`
+	SourceCode string `json:"source_code"`
+	WasmBinary []byte `json:"wasm_binary"`
+}
+
+func (q *Queries) CreateRuleVersion(ctx context.Context, arg CreateRuleVersionParams) (WasmorphRuleVersion, error) {
+	row := q.db.QueryRow(ctx, createRuleVersion,
+		arg.RuleID,
+		arg.Version,
+		arg.SourceCode,
+		arg.WasmBinary,
+	)
+	var i WasmorphRuleVersion
+	err := row.Scan(
+		&i.ID,
+		&i.RuleID,
+		&i.Version,
+		&i.SourceCode,
+		&i.WasmBinary,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createSession = `-- name: CreateSession :one
+INSERT INTO wasmorph.sessions (user_id, refresh_token_hash, expires_at)
+VALUES ($1, $2, $3::timestamptz)
+RETURNING id
+`
+
+type CreateSessionParams struct {
+	UserID           int32              `json:"user_id"`
+	RefreshTokenHash string             `json:"refresh_token_hash"`
+	ExpiresAt        pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (int32, error) {
+	row := q.db.QueryRow(ctx, createSession, arg.UserID, arg.RefreshTokenHash, arg.ExpiresAt)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createUser = `-- name: CreateUser :one
+INSERT INTO wasmorph.users (username, email, password_hash, is_active, is_admin)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, username, email, password_hash, created_at, updated_at, is_active, is_admin
 `
 
 type CreateUserParams struct {
@@ -89,6 +241,7 @@ type CreateUserParams struct {
 	Email        pgtype.Text `json:"email"`
 	PasswordHash string      `json:"password_hash"`
 	IsActive     pgtype.Bool `json:"is_active"`
+	IsAdmin      bool        `json:"is_admin"`
 }
 
 type CreateUserRow struct {
@@ -99,6 +252,7 @@ type CreateUserRow struct {
 	CreatedAt    pgtype.Timestamp `json:"created_at"`
 	UpdatedAt    pgtype.Timestamp `json:"updated_at"`
 	IsActive     pgtype.Bool      `json:"is_active"`
+	IsAdmin      bool             `json:"is_admin"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
@@ -107,6 +261,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 		arg.Email,
 		arg.PasswordHash,
 		arg.IsActive,
+		arg.IsAdmin,
 	)
 	var i CreateUserRow
 	err := row.Scan(
@@ -117,39 +272,194 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.IsActive,
+		&i.IsAdmin,
 	)
 	return i, err
 }
 
+const createUserIdentity = `-- name: CreateUserIdentity :exec
+INSERT INTO wasmorph.user_identities (issuer, subject, user_id, email)
+VALUES ($1, $2, $3, $4)
+`
+
+type CreateUserIdentityParams struct {
+	Issuer  string      `json:"issuer"`
+	Subject string      `json:"subject"`
+	UserID  int32       `json:"user_id"`
+	Email   pgtype.Text `json:"email"`
+}
+
+func (q *Queries) CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) error {
+	_, err := q.db.Exec(ctx, createUserIdentity,
+		arg.Issuer,
+		arg.Subject,
+		arg.UserID,
+		arg.Email,
+	)
+	return err
+}
+
+const deleteFinishedBuildJobs = `-- name: DeleteFinishedBuildJobs :exec
+DELETE FROM wasmorph.build_jobs
+WHERE workspace_id = $1 AND rule_name = $2 AND status IN ('succeeded', 'failed')
+`
+
+type DeleteFinishedBuildJobsParams struct {
+	WorkspaceID int32  `json:"workspace_id"`
+	RuleName    string `json:"rule_name"`
+}
+
+func (q *Queries) DeleteFinishedBuildJobs(ctx context.Context, arg DeleteFinishedBuildJobsParams) error {
+	_, err := q.db.Exec(ctx, deleteFinishedBuildJobs, arg.WorkspaceID, arg.RuleName)
+	return err
+}
+
 const deleteRule = `-- name: DeleteRule :exec
 UPDATE wasmorph.rules
-SET is_active = false, updated_at = NOW()
-WHERE name = $1 AND user_id = $2
+SET is_active = false, deleted_at = NOW(), updated_at = NOW()
+WHERE name = $1 AND workspace_id = $2 AND is_active = true
 `
 
 type DeleteRuleParams struct {
-	Name   string `json:"name"`
-	UserID int32  `json:"user_id"`
+	Name        string `json:"name"`
+	WorkspaceID int32  `json:"workspace_id"`
 }
 
 func (q *Queries) DeleteRule(ctx context.Context, arg DeleteRuleParams) error {
-	_, err := q.db.Exec(ctx, deleteRule, arg.Name, arg.UserID)
+	_, err := q.db.Exec(ctx, deleteRule, arg.Name, arg.WorkspaceID)
+	return err
+}
+
+const deleteRuleAlias = `-- name: DeleteRuleAlias :execrows
+DELETE FROM wasmorph.rule_aliases a
+USING wasmorph.rules r
+WHERE a.rule_id = r.id AND r.name = $1 AND r.workspace_id = $2 AND r.is_active AND a.alias = $3
+`
+
+type DeleteRuleAliasParams struct {
+	Name        string `json:"name"`
+	WorkspaceID int32  `json:"workspace_id"`
+	Alias       string `json:"alias"`
+}
+
+func (q *Queries) DeleteRuleAlias(ctx context.Context, arg DeleteRuleAliasParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteRuleAlias, arg.Name, arg.WorkspaceID, arg.Alias)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const failBuildJob = `-- name: FailBuildJob :exec
+UPDATE wasmorph.build_jobs
+SET status = 'failed', error = $2, finished_at = NOW()
+WHERE id = $1
+`
+
+type FailBuildJobParams struct {
+	ID    int32       `json:"id"`
+	Error pgtype.Text `json:"error"`
+}
+
+func (q *Queries) FailBuildJob(ctx context.Context, arg FailBuildJobParams) error {
+	_, err := q.db.Exec(ctx, failBuildJob, arg.ID, arg.Error)
 	return err
 }
 
-const getRuleByNameAndUser = `-- name: GetRuleByNameAndUser :one
-SELECT id, name, user_id, source_code, wasm_binary, created_at, updated_at, is_active
+const failInstanceBuildJobs = `-- name: FailInstanceBuildJobs :execrows
+UPDATE wasmorph.build_jobs
+SET status = 'failed', error = $2, finished_at = NOW()
+WHERE instance_id IS NOT DISTINCT FROM $1 AND status IN ('queued', 'running')
+`
+
+type FailInstanceBuildJobsParams struct {
+	InstanceID pgtype.Int8 `json:"instance_id"`
+	Error      pgtype.Text `json:"error"`
+}
+
+func (q *Queries) FailInstanceBuildJobs(ctx context.Context, arg FailInstanceBuildJobsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, failInstanceBuildJobs, arg.InstanceID, arg.Error)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getBuildJob = `-- name: GetBuildJob :one
+SELECT id, user_id, rule_name, status, error, rule_version, created_at, started_at, finished_at, workspace_id
+FROM wasmorph.build_jobs
+WHERE id = $1 AND workspace_id = $2
+`
+
+type GetBuildJobParams struct {
+	ID          int32 `json:"id"`
+	WorkspaceID int32 `json:"workspace_id"`
+}
+
+type GetBuildJobRow struct {
+	ID          int32            `json:"id"`
+	UserID      int32            `json:"user_id"`
+	RuleName    string           `json:"rule_name"`
+	Status      string           `json:"status"`
+	Error       pgtype.Text      `json:"error"`
+	RuleVersion pgtype.Int4      `json:"rule_version"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	StartedAt   pgtype.Timestamp `json:"started_at"`
+	FinishedAt  pgtype.Timestamp `json:"finished_at"`
+	WorkspaceID int32            `json:"workspace_id"`
+}
+
+func (q *Queries) GetBuildJob(ctx context.Context, arg GetBuildJobParams) (GetBuildJobRow, error) {
+	row := q.db.QueryRow(ctx, getBuildJob, arg.ID, arg.WorkspaceID)
+	var i GetBuildJobRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RuleName,
+		&i.Status,
+		&i.Error,
+		&i.RuleVersion,
+		&i.CreatedAt,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const getRuleAliasVersion = `-- name: GetRuleAliasVersion :one
+SELECT a.version
+FROM wasmorph.rule_aliases a
+JOIN wasmorph.rules r ON r.id = a.rule_id
+WHERE r.name = $1 AND r.workspace_id = $2 AND r.is_active = true AND a.alias = $3
+`
+
+type GetRuleAliasVersionParams struct {
+	Name        string `json:"name"`
+	WorkspaceID int32  `json:"workspace_id"`
+	Alias       string `json:"alias"`
+}
+
+func (q *Queries) GetRuleAliasVersion(ctx context.Context, arg GetRuleAliasVersionParams) (int32, error) {
+	row := q.db.QueryRow(ctx, getRuleAliasVersion, arg.Name, arg.WorkspaceID, arg.Alias)
+	var version int32
+	err := row.Scan(&version)
+	return version, err
+}
+
+const getRuleByNameAndWorkspace = `-- name: GetRuleByNameAndWorkspace :one
+SELECT id, name, user_id, source_code, wasm_binary, created_at, updated_at, is_active, version, timeout_ms, max_memory_pages, max_output_bytes, min_instances, max_instances, workspace_id, description, tags, labels, deleted_at
 FROM wasmorph.rules
-WHERE name = $1 AND user_id = $2 AND is_active = true
+WHERE name = $1 AND workspace_id = $2 AND is_active = true
 `
 
-type GetRuleByNameAndUserParams struct {
-	Name   string `json:"name"`
-	UserID int32  `json:"user_id"`
+type GetRuleByNameAndWorkspaceParams struct {
+	Name        string `json:"name"`
+	WorkspaceID int32  `json:"workspace_id"`
 }
 
-func (q *Queries) GetRuleByNameAndUser(ctx context.Context, arg GetRuleByNameAndUserParams) (WasmorphRule, error) {
-	row := q.db.QueryRow(ctx, getRuleByNameAndUser, arg.Name, arg.UserID)
+func (q *Queries) GetRuleByNameAndWorkspace(ctx context.Context, arg GetRuleByNameAndWorkspaceParams) (WasmorphRule, error) {
+	row := q.db.QueryRow(ctx, getRuleByNameAndWorkspace, arg.Name, arg.WorkspaceID)
 	var i WasmorphRule
 	err := row.Scan(
 		&i.ID,
@@ -160,6 +470,92 @@ func (q *Queries) GetRuleByNameAndUser(ctx context.Context, arg GetRuleByNameAnd
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.IsActive,
+		&i.Version,
+		&i.TimeoutMs,
+		&i.MaxMemoryPages,
+		&i.MaxOutputBytes,
+		&i.MinInstances,
+		&i.MaxInstances,
+		&i.WorkspaceID,
+		&i.Description,
+		&i.Tags,
+		&i.Labels,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getRuleHeadVersion = `-- name: GetRuleHeadVersion :one
+SELECT version FROM wasmorph.rules
+WHERE name = $1 AND workspace_id = $2 AND is_active = true
+`
+
+type GetRuleHeadVersionParams struct {
+	Name        string `json:"name"`
+	WorkspaceID int32  `json:"workspace_id"`
+}
+
+func (q *Queries) GetRuleHeadVersion(ctx context.Context, arg GetRuleHeadVersionParams) (int32, error) {
+	row := q.db.QueryRow(ctx, getRuleHeadVersion, arg.Name, arg.WorkspaceID)
+	var version int32
+	err := row.Scan(&version)
+	return version, err
+}
+
+const getRuleLimits = `-- name: GetRuleLimits :one
+SELECT timeout_ms, max_memory_pages, max_output_bytes, min_instances, max_instances FROM wasmorph.rules
+WHERE name = $1 AND workspace_id = $2 AND is_active = true
+`
+
+type GetRuleLimitsParams struct {
+	Name        string `json:"name"`
+	WorkspaceID int32  `json:"workspace_id"`
+}
+
+type GetRuleLimitsRow struct {
+	TimeoutMs      int32 `json:"timeout_ms"`
+	MaxMemoryPages int32 `json:"max_memory_pages"`
+	MaxOutputBytes int32 `json:"max_output_bytes"`
+	MinInstances   int32 `json:"min_instances"`
+	MaxInstances   int32 `json:"max_instances"`
+}
+
+func (q *Queries) GetRuleLimits(ctx context.Context, arg GetRuleLimitsParams) (GetRuleLimitsRow, error) {
+	row := q.db.QueryRow(ctx, getRuleLimits, arg.Name, arg.WorkspaceID)
+	var i GetRuleLimitsRow
+	err := row.Scan(
+		&i.TimeoutMs,
+		&i.MaxMemoryPages,
+		&i.MaxOutputBytes,
+		&i.MinInstances,
+		&i.MaxInstances,
+	)
+	return i, err
+}
+
+const getRuleVersion = `-- name: GetRuleVersion :one
+SELECT v.id, v.rule_id, v.version, v.source_code, v.wasm_binary, v.created_at
+FROM wasmorph.rule_versions v
+JOIN wasmorph.rules r ON r.id = v.rule_id
+WHERE r.name = $1 AND r.workspace_id = $2 AND r.is_active = true AND v.version = $3
+`
+
+type GetRuleVersionParams struct {
+	Name        string `json:"name"`
+	WorkspaceID int32  `json:"workspace_id"`
+	Version     int32  `json:"version"`
+}
+
+func (q *Queries) GetRuleVersion(ctx context.Context, arg GetRuleVersionParams) (WasmorphRuleVersion, error) {
+	row := q.db.QueryRow(ctx, getRuleVersion, arg.Name, arg.WorkspaceID, arg.Version)
+	var i WasmorphRuleVersion
+	err := row.Scan(
+		&i.ID,
+		&i.RuleID,
+		&i.Version,
+		&i.SourceCode,
+		&i.WasmBinary,
+		&i.CreatedAt,
 	)
 	return i, err
 }
@@ -257,31 +653,221 @@ func (q *Queries) GetUserByUsername(ctx context.Context, username string) (GetUs
 	return i, err
 }
 
-const listRulesByUser = `-- name: ListRulesByUser :many
-SELECT id, name, user_id, created_at, updated_at, is_active
-FROM wasmorph.rules
+const getUserIDByIdentity = `-- name: GetUserIDByIdentity :one
+SELECT u.id FROM wasmorph.user_identities i
+JOIN wasmorph.users u ON u.id = i.user_id
+WHERE i.issuer = $1 AND i.subject = $2 AND u.is_active = true
+`
+
+type GetUserIDByIdentityParams struct {
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+}
+
+func (q *Queries) GetUserIDByIdentity(ctx context.Context, arg GetUserIDByIdentityParams) (int32, error) {
+	row := q.db.QueryRow(ctx, getUserIDByIdentity, arg.Issuer, arg.Subject)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getUserSummary = `-- name: GetUserSummary :one
+SELECT u.id, u.username, u.email, u.is_active, u.is_admin, u.created_at,
+    (SELECT COUNT(*) FROM wasmorph.rules r WHERE r.user_id = u.id AND r.is_active = true) AS rule_count,
+    (SELECT COUNT(*) FROM wasmorph.api_keys k WHERE k.user_id = u.id AND k.is_active = true
+        AND (k.expires_at IS NULL OR k.expires_at > NOW())) AS api_key_count
+FROM wasmorph.users u
+WHERE u.id = $1
+`
+
+type GetUserSummaryRow struct {
+	ID          int32            `json:"id"`
+	Username    string           `json:"username"`
+	Email       pgtype.Text      `json:"email"`
+	IsActive    pgtype.Bool      `json:"is_active"`
+	IsAdmin     bool             `json:"is_admin"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	RuleCount   int64            `json:"rule_count"`
+	ApiKeyCount int64            `json:"api_key_count"`
+}
+
+func (q *Queries) GetUserSummary(ctx context.Context, id int32) (GetUserSummaryRow, error) {
+	row := q.db.QueryRow(ctx, getUserSummary, id)
+	var i GetUserSummaryRow
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.IsActive,
+		&i.IsAdmin,
+		&i.CreatedAt,
+		&i.RuleCount,
+		&i.ApiKeyCount,
+	)
+	return i, err
+}
+
+const isRuleDeleted = `-- name: IsRuleDeleted :one
+SELECT EXISTS (
+    SELECT 1 FROM wasmorph.rules
+    WHERE name = $1 AND workspace_id = $2 AND is_active = false
+)
+`
+
+type IsRuleDeletedParams struct {
+	Name        string `json:"name"`
+	WorkspaceID int32  `json:"workspace_id"`
+}
+
+func (q *Queries) IsRuleDeleted(ctx context.Context, arg IsRuleDeletedParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isRuleDeleted, arg.Name, arg.WorkspaceID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const isSessionActive = `-- name: IsSessionActive :one
+SELECT EXISTS (
+    SELECT 1 FROM wasmorph.sessions s
+    JOIN wasmorph.users u ON u.id = s.user_id
+    WHERE s.id = $1 AND s.user_id = $2 AND s.revoked_at IS NULL AND s.expires_at > NOW()
+      AND u.is_active = true
+)
+`
+
+type IsSessionActiveParams struct {
+	ID     int32 `json:"id"`
+	UserID int32 `json:"user_id"`
+}
+
+func (q *Queries) IsSessionActive(ctx context.Context, arg IsSessionActiveParams) (bool, error) {
+	row := q.db.QueryRow(ctx, isSessionActive, arg.ID, arg.UserID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const isUserAdmin = `-- name: IsUserAdmin :one
+SELECT EXISTS (
+    SELECT 1 FROM wasmorph.users
+    WHERE id = $1 AND is_active = true AND is_admin = true
+)
+`
+
+func (q *Queries) IsUserAdmin(ctx context.Context, id int32) (bool, error) {
+	row := q.db.QueryRow(ctx, isUserAdmin, id)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const listAPIKeysByUser = `-- name: ListAPIKeysByUser :many
+SELECT id, key_prefix, label, created_at, last_used_at, expires_at, scopes, rule_patterns
+FROM wasmorph.api_keys
 WHERE user_id = $1 AND is_active = true
-ORDER BY created_at DESC
+ORDER BY id
 `
 
-type ListRulesByUserRow struct {
-	ID        int32            `json:"id"`
-	Name      string           `json:"name"`
-	UserID    int32            `json:"user_id"`
-	CreatedAt pgtype.Timestamp `json:"created_at"`
-	UpdatedAt pgtype.Timestamp `json:"updated_at"`
-	IsActive  pgtype.Bool      `json:"is_active"`
+type ListAPIKeysByUserRow struct {
+	ID           int32            `json:"id"`
+	KeyPrefix    string           `json:"key_prefix"`
+	Label        string           `json:"label"`
+	CreatedAt    pgtype.Timestamp `json:"created_at"`
+	LastUsedAt   pgtype.Timestamp `json:"last_used_at"`
+	ExpiresAt    pgtype.Timestamp `json:"expires_at"`
+	Scopes       []string         `json:"scopes"`
+	RulePatterns []string         `json:"rule_patterns"`
+}
+
+func (q *Queries) ListAPIKeysByUser(ctx context.Context, userID int32) ([]ListAPIKeysByUserRow, error) {
+	rows, err := q.db.Query(ctx, listAPIKeysByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListAPIKeysByUserRow{}
+	for rows.Next() {
+		var i ListAPIKeysByUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.KeyPrefix,
+			&i.Label,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+			&i.Scopes,
+			&i.RulePatterns,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDeletedRulesPage = `-- name: ListDeletedRulesPage :many
+SELECT id, name, user_id, created_at, updated_at, is_active, version, workspace_id, description, tags, labels, deleted_at
+FROM wasmorph.rules
+WHERE workspace_id = $1 AND is_active = false
+  AND ($2::text IS NULL OR name ILIKE '%' || $2 || '%')
+  AND ($3::text IS NULL OR to_tsvector('simple', source_code) @@ plainto_tsquery('simple', $3))
+  AND ($4::timestamptz IS NULL OR updated_at >= $4)
+  AND ($5::text[] IS NULL OR tags @> $5)
+  AND ($6::jsonb IS NULL OR labels @> $6)
+  AND ($7::int IS NULL OR (deleted_at, id) < ($8::timestamp, $7))
+ORDER BY deleted_at DESC, id DESC
+LIMIT $9
+`
+
+type ListDeletedRulesPageParams struct {
+	WorkspaceID  int32              `json:"workspace_id"`
+	NameQuery    pgtype.Text        `json:"name_query"`
+	SourceQuery  pgtype.Text        `json:"source_query"`
+	UpdatedSince pgtype.Timestamptz `json:"updated_since"`
+	Tags         []string           `json:"tags"`
+	Labels       json.RawMessage    `json:"labels"`
+	AfterID      pgtype.Int4        `json:"after_id"`
+	AfterTime    pgtype.Timestamp   `json:"after_time"`
+	MaxResults   int32              `json:"max_results"`
+}
+
+type ListDeletedRulesPageRow struct {
+	ID          int32            `json:"id"`
+	Name        string           `json:"name"`
+	UserID      int32            `json:"user_id"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
+	IsActive    pgtype.Bool      `json:"is_active"`
+	Version     int32            `json:"version"`
+	WorkspaceID int32            `json:"workspace_id"`
+	Description string           `json:"description"`
+	Tags        []string         `json:"tags"`
+	Labels      json.RawMessage  `json:"labels"`
+	DeletedAt   pgtype.Timestamp `json:"deleted_at"`
 }
 
-func (q *Queries) ListRulesByUser(ctx context.Context, userID int32) ([]ListRulesByUserRow, error) {
-	rows, err := q.db.Query(ctx, listRulesByUser, userID)
+func (q *Queries) ListDeletedRulesPage(ctx context.Context, arg ListDeletedRulesPageParams) ([]ListDeletedRulesPageRow, error) {
+	rows, err := q.db.Query(ctx, listDeletedRulesPage,
+		arg.WorkspaceID,
+		arg.NameQuery,
+		arg.SourceQuery,
+		arg.UpdatedSince,
+		arg.Tags,
+		arg.Labels,
+		arg.AfterID,
+		arg.AfterTime,
+		arg.MaxResults,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []ListRulesByUserRow{}
+	items := []ListDeletedRulesPageRow{}
 	for rows.Next() {
-		var i ListRulesByUserRow
+		var i ListDeletedRulesPageRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.Name,
@@ -289,6 +875,12 @@ func (q *Queries) ListRulesByUser(ctx context.Context, userID int32) ([]ListRule
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.IsActive,
+			&i.Version,
+			&i.WorkspaceID,
+			&i.Description,
+			&i.Tags,
+			&i.Labels,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -300,49 +892,916 @@ func (q *Queries) ListRulesByUser(ctx context.Context, userID int32) ([]ListRule
 	return items, nil
 }
 
-const updateRule = `-- name: UpdateRule :one
-UPDATE wasmorph.rules
-SET source_code = $3, wasm_binary = $4, updated_at = NOW()
-WHERE name = $1 AND user_id = $2 AND is_active = true
-RETURNING id, name, user_id, source_code, wasm_binary, created_at, updated_at, is_active
+const listRuleAliases = `-- name: ListRuleAliases :many
+SELECT a.alias, a.version, a.created_at, a.updated_at
+FROM wasmorph.rule_aliases a
+JOIN wasmorph.rules r ON r.id = a.rule_id
+WHERE r.name = $1 AND r.workspace_id = $2 AND r.is_active = true
+ORDER BY a.alias
 `
 
-type UpdateRuleParams struct {
-	Name       string `json:"name"`
-	UserID     int32  `json:"user_id"`
-	SourceCode string `json:"source_code"`
-	WasmBinary []byte `json:"wasm_binary"`
+type ListRuleAliasesParams struct {
+	Name        string `json:"name"`
+	WorkspaceID int32  `json:"workspace_id"`
 }
 
-func (q *Queries) UpdateRule(ctx context.Context, arg UpdateRuleParams) (WasmorphRule, error) {
-	row := q.db.QueryRow(ctx, updateRule,
-		arg.Name,
-		arg.UserID,
-		arg.SourceCode,
-		arg.WasmBinary,
-	)
-	var i WasmorphRule
-	err := row.Scan(
-		&i.ID,
-		&i.Name,
-		&i.UserID,
-		&i.SourceCode,
-		&i.WasmBinary,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.IsActive,
-	)
-	return i, err
+type ListRuleAliasesRow struct {
+	Alias     string           `json:"alias"`
+	Version   int32            `json:"version"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+	UpdatedAt pgtype.Timestamp `json:"updated_at"`
 }
 
-const validateAPIKey = `-- name: ValidateAPIKey :one
-SELECT user_id FROM wasmorph.api_keys 
-WHERE api_key = $1 AND is_active = true
-`
-
-func (q *Queries) ValidateAPIKey(ctx context.Context, apiKey string) (int32, error) {
-	row := q.db.QueryRow(ctx, validateAPIKey, apiKey)
-	var user_id int32
-	err := row.Scan(&user_id)
-	return user_id, err
+func (q *Queries) ListRuleAliases(ctx context.Context, arg ListRuleAliasesParams) ([]ListRuleAliasesRow, error) {
+	rows, err := q.db.Query(ctx, listRuleAliases, arg.Name, arg.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRuleAliasesRow{}
+	for rows.Next() {
+		var i ListRuleAliasesRow
+		if err := rows.Scan(
+			&i.Alias,
+			&i.Version,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRuleVersions = `-- name: ListRuleVersions :many
+SELECT v.id, v.rule_id, v.version, v.created_at
+FROM wasmorph.rule_versions v
+JOIN wasmorph.rules r ON r.id = v.rule_id
+WHERE r.name = $1 AND r.workspace_id = $2 AND r.is_active = true
+ORDER BY v.version DESC
+`
+
+type ListRuleVersionsParams struct {
+	Name        string `json:"name"`
+	WorkspaceID int32  `json:"workspace_id"`
+}
+
+type ListRuleVersionsRow struct {
+	ID        int32            `json:"id"`
+	RuleID    int32            `json:"rule_id"`
+	Version   int32            `json:"version"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+func (q *Queries) ListRuleVersions(ctx context.Context, arg ListRuleVersionsParams) ([]ListRuleVersionsRow, error) {
+	rows, err := q.db.Query(ctx, listRuleVersions, arg.Name, arg.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRuleVersionsRow{}
+	for rows.Next() {
+		var i ListRuleVersionsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.RuleID,
+			&i.Version,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRulesByWorkspace = `-- name: ListRulesByWorkspace :many
+SELECT id, name, user_id, created_at, updated_at, is_active, version, workspace_id, description, tags, labels, deleted_at
+FROM wasmorph.rules
+WHERE workspace_id = $1 AND is_active = true
+ORDER BY created_at DESC
+`
+
+type ListRulesByWorkspaceRow struct {
+	ID          int32            `json:"id"`
+	Name        string           `json:"name"`
+	UserID      int32            `json:"user_id"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
+	IsActive    pgtype.Bool      `json:"is_active"`
+	Version     int32            `json:"version"`
+	WorkspaceID int32            `json:"workspace_id"`
+	Description string           `json:"description"`
+	Tags        []string         `json:"tags"`
+	Labels      json.RawMessage  `json:"labels"`
+	DeletedAt   pgtype.Timestamp `json:"deleted_at"`
+}
+
+func (q *Queries) ListRulesByWorkspace(ctx context.Context, workspaceID int32) ([]ListRulesByWorkspaceRow, error) {
+	rows, err := q.db.Query(ctx, listRulesByWorkspace, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRulesByWorkspaceRow{}
+	for rows.Next() {
+		var i ListRulesByWorkspaceRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.IsActive,
+			&i.Version,
+			&i.WorkspaceID,
+			&i.Description,
+			&i.Tags,
+			&i.Labels,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRulesPageByCreated = `-- name: ListRulesPageByCreated :many
+SELECT id, name, user_id, created_at, updated_at, is_active, version, workspace_id, description, tags, labels, deleted_at
+FROM wasmorph.rules
+WHERE workspace_id = $1 AND is_active = true
+  AND ($2::text IS NULL OR name ILIKE '%' || $2 || '%')
+  AND ($3::text IS NULL OR to_tsvector('simple', source_code) @@ plainto_tsquery('simple', $3))
+  AND ($4::timestamptz IS NULL OR updated_at >= $4)
+  AND ($5::text[] IS NULL OR tags @> $5)
+  AND ($6::jsonb IS NULL OR labels @> $6)
+  AND ($7::int IS NULL OR (created_at, id) < ($8::timestamp, $7))
+ORDER BY created_at DESC, id DESC
+LIMIT $9
+`
+
+type ListRulesPageByCreatedParams struct {
+	WorkspaceID  int32              `json:"workspace_id"`
+	NameQuery    pgtype.Text        `json:"name_query"`
+	SourceQuery  pgtype.Text        `json:"source_query"`
+	UpdatedSince pgtype.Timestamptz `json:"updated_since"`
+	Tags         []string           `json:"tags"`
+	Labels       json.RawMessage    `json:"labels"`
+	AfterID      pgtype.Int4        `json:"after_id"`
+	AfterTime    pgtype.Timestamp   `json:"after_time"`
+	MaxResults   int32              `json:"max_results"`
+}
+
+type ListRulesPageByCreatedRow struct {
+	ID          int32            `json:"id"`
+	Name        string           `json:"name"`
+	UserID      int32            `json:"user_id"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
+	IsActive    pgtype.Bool      `json:"is_active"`
+	Version     int32            `json:"version"`
+	WorkspaceID int32            `json:"workspace_id"`
+	Description string           `json:"description"`
+	Tags        []string         `json:"tags"`
+	Labels      json.RawMessage  `json:"labels"`
+	DeletedAt   pgtype.Timestamp `json:"deleted_at"`
+}
+
+func (q *Queries) ListRulesPageByCreated(ctx context.Context, arg ListRulesPageByCreatedParams) ([]ListRulesPageByCreatedRow, error) {
+	rows, err := q.db.Query(ctx, listRulesPageByCreated,
+		arg.WorkspaceID,
+		arg.NameQuery,
+		arg.SourceQuery,
+		arg.UpdatedSince,
+		arg.Tags,
+		arg.Labels,
+		arg.AfterID,
+		arg.AfterTime,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRulesPageByCreatedRow{}
+	for rows.Next() {
+		var i ListRulesPageByCreatedRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.IsActive,
+			&i.Version,
+			&i.WorkspaceID,
+			&i.Description,
+			&i.Tags,
+			&i.Labels,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRulesPageByName = `-- name: ListRulesPageByName :many
+SELECT id, name, user_id, created_at, updated_at, is_active, version, workspace_id, description, tags, labels, deleted_at
+FROM wasmorph.rules
+WHERE workspace_id = $1 AND is_active = true
+  AND ($2::text IS NULL OR name ILIKE '%' || $2 || '%')
+  AND ($3::text IS NULL OR to_tsvector('simple', source_code) @@ plainto_tsquery('simple', $3))
+  AND ($4::timestamptz IS NULL OR updated_at >= $4)
+  AND ($5::text[] IS NULL OR tags @> $5)
+  AND ($6::jsonb IS NULL OR labels @> $6)
+  AND ($7::text IS NULL OR name > $7)
+ORDER BY name
+LIMIT $8
+`
+
+type ListRulesPageByNameParams struct {
+	WorkspaceID  int32              `json:"workspace_id"`
+	NameQuery    pgtype.Text        `json:"name_query"`
+	SourceQuery  pgtype.Text        `json:"source_query"`
+	UpdatedSince pgtype.Timestamptz `json:"updated_since"`
+	Tags         []string           `json:"tags"`
+	Labels       json.RawMessage    `json:"labels"`
+	AfterName    pgtype.Text        `json:"after_name"`
+	MaxResults   int32              `json:"max_results"`
+}
+
+type ListRulesPageByNameRow struct {
+	ID          int32            `json:"id"`
+	Name        string           `json:"name"`
+	UserID      int32            `json:"user_id"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
+	IsActive    pgtype.Bool      `json:"is_active"`
+	Version     int32            `json:"version"`
+	WorkspaceID int32            `json:"workspace_id"`
+	Description string           `json:"description"`
+	Tags        []string         `json:"tags"`
+	Labels      json.RawMessage  `json:"labels"`
+	DeletedAt   pgtype.Timestamp `json:"deleted_at"`
+}
+
+func (q *Queries) ListRulesPageByName(ctx context.Context, arg ListRulesPageByNameParams) ([]ListRulesPageByNameRow, error) {
+	rows, err := q.db.Query(ctx, listRulesPageByName,
+		arg.WorkspaceID,
+		arg.NameQuery,
+		arg.SourceQuery,
+		arg.UpdatedSince,
+		arg.Tags,
+		arg.Labels,
+		arg.AfterName,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRulesPageByNameRow{}
+	for rows.Next() {
+		var i ListRulesPageByNameRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.IsActive,
+			&i.Version,
+			&i.WorkspaceID,
+			&i.Description,
+			&i.Tags,
+			&i.Labels,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRulesPageByUpdated = `-- name: ListRulesPageByUpdated :many
+SELECT id, name, user_id, created_at, updated_at, is_active, version, workspace_id, description, tags, labels, deleted_at
+FROM wasmorph.rules
+WHERE workspace_id = $1 AND is_active = true
+  AND ($2::text IS NULL OR name ILIKE '%' || $2 || '%')
+  AND ($3::text IS NULL OR to_tsvector('simple', source_code) @@ plainto_tsquery('simple', $3))
+  AND ($4::timestamptz IS NULL OR updated_at >= $4)
+  AND ($5::text[] IS NULL OR tags @> $5)
+  AND ($6::jsonb IS NULL OR labels @> $6)
+  AND ($7::int IS NULL OR (updated_at, id) < ($8::timestamp, $7))
+ORDER BY updated_at DESC, id DESC
+LIMIT $9
+`
+
+type ListRulesPageByUpdatedParams struct {
+	WorkspaceID  int32              `json:"workspace_id"`
+	NameQuery    pgtype.Text        `json:"name_query"`
+	SourceQuery  pgtype.Text        `json:"source_query"`
+	UpdatedSince pgtype.Timestamptz `json:"updated_since"`
+	Tags         []string           `json:"tags"`
+	Labels       json.RawMessage    `json:"labels"`
+	AfterID      pgtype.Int4        `json:"after_id"`
+	AfterTime    pgtype.Timestamp   `json:"after_time"`
+	MaxResults   int32              `json:"max_results"`
+}
+
+type ListRulesPageByUpdatedRow struct {
+	ID          int32            `json:"id"`
+	Name        string           `json:"name"`
+	UserID      int32            `json:"user_id"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	UpdatedAt   pgtype.Timestamp `json:"updated_at"`
+	IsActive    pgtype.Bool      `json:"is_active"`
+	Version     int32            `json:"version"`
+	WorkspaceID int32            `json:"workspace_id"`
+	Description string           `json:"description"`
+	Tags        []string         `json:"tags"`
+	Labels      json.RawMessage  `json:"labels"`
+	DeletedAt   pgtype.Timestamp `json:"deleted_at"`
+}
+
+func (q *Queries) ListRulesPageByUpdated(ctx context.Context, arg ListRulesPageByUpdatedParams) ([]ListRulesPageByUpdatedRow, error) {
+	rows, err := q.db.Query(ctx, listRulesPageByUpdated,
+		arg.WorkspaceID,
+		arg.NameQuery,
+		arg.SourceQuery,
+		arg.UpdatedSince,
+		arg.Tags,
+		arg.Labels,
+		arg.AfterID,
+		arg.AfterTime,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRulesPageByUpdatedRow{}
+	for rows.Next() {
+		var i ListRulesPageByUpdatedRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.IsActive,
+			&i.Version,
+			&i.WorkspaceID,
+			&i.Description,
+			&i.Tags,
+			&i.Labels,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUnfinishedBuildInstances = `-- name: ListUnfinishedBuildInstances :many
+SELECT DISTINCT instance_id FROM wasmorph.build_jobs
+WHERE status IN ('queued', 'running')
+`
+
+func (q *Queries) ListUnfinishedBuildInstances(ctx context.Context) ([]pgtype.Int8, error) {
+	rows, err := q.db.Query(ctx, listUnfinishedBuildInstances)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []pgtype.Int8{}
+	for rows.Next() {
+		var instance_id pgtype.Int8
+		if err := rows.Scan(&instance_id); err != nil {
+			return nil, err
+		}
+		items = append(items, instance_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserSummaries = `-- name: ListUserSummaries :many
+SELECT u.id, u.username, u.email, u.is_active, u.is_admin, u.created_at,
+    (SELECT COUNT(*) FROM wasmorph.rules r WHERE r.user_id = u.id AND r.is_active = true) AS rule_count,
+    (SELECT COUNT(*) FROM wasmorph.api_keys k WHERE k.user_id = u.id AND k.is_active = true
+        AND (k.expires_at IS NULL OR k.expires_at > NOW())) AS api_key_count
+FROM wasmorph.users u
+ORDER BY u.id
+`
+
+type ListUserSummariesRow struct {
+	ID          int32            `json:"id"`
+	Username    string           `json:"username"`
+	Email       pgtype.Text      `json:"email"`
+	IsActive    pgtype.Bool      `json:"is_active"`
+	IsAdmin     bool             `json:"is_admin"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	RuleCount   int64            `json:"rule_count"`
+	ApiKeyCount int64            `json:"api_key_count"`
+}
+
+func (q *Queries) ListUserSummaries(ctx context.Context) ([]ListUserSummariesRow, error) {
+	rows, err := q.db.Query(ctx, listUserSummaries)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListUserSummariesRow{}
+	for rows.Next() {
+		var i ListUserSummariesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Email,
+			&i.IsActive,
+			&i.IsAdmin,
+			&i.CreatedAt,
+			&i.RuleCount,
+			&i.ApiKeyCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockInstance = `-- name: LockInstance :exec
+SELECT pg_advisory_lock($1::bigint)
+`
+
+func (q *Queries) LockInstance(ctx context.Context, instanceID int64) error {
+	_, err := q.db.Exec(ctx, lockInstance, instanceID)
+	return err
+}
+
+const moveRule = `-- name: MoveRule :execrows
+UPDATE wasmorph.rules
+SET workspace_id = $1, updated_at = NOW()
+WHERE name = $2 AND workspace_id = $3 AND is_active = true
+`
+
+type MoveRuleParams struct {
+	TargetWorkspaceID int32  `json:"target_workspace_id"`
+	Name              string `json:"name"`
+	WorkspaceID       int32  `json:"workspace_id"`
+}
+
+func (q *Queries) MoveRule(ctx context.Context, arg MoveRuleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, moveRule, arg.TargetWorkspaceID, arg.Name, arg.WorkspaceID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const notifyRuleChanged = `-- name: NotifyRuleChanged :exec
+SELECT pg_notify('wasmorph_rules', $1::text)
+`
+
+func (q *Queries) NotifyRuleChanged(ctx context.Context, payload string) error {
+	_, err := q.db.Exec(ctx, notifyRuleChanged, payload)
+	return err
+}
+
+const purgeDeletedRule = `-- name: PurgeDeletedRule :one
+DELETE FROM wasmorph.rules
+WHERE name = $1 AND workspace_id = $2 AND is_active = false
+RETURNING version
+`
+
+type PurgeDeletedRuleParams struct {
+	Name        string `json:"name"`
+	WorkspaceID int32  `json:"workspace_id"`
+}
+
+func (q *Queries) PurgeDeletedRule(ctx context.Context, arg PurgeDeletedRuleParams) (int32, error) {
+	row := q.db.QueryRow(ctx, purgeDeletedRule, arg.Name, arg.WorkspaceID)
+	var version int32
+	err := row.Scan(&version)
+	return version, err
+}
+
+const purgeExpiredRules = `-- name: PurgeExpiredRules :many
+DELETE FROM wasmorph.rules
+WHERE is_active = false AND deleted_at < NOW() - $1::interval
+RETURNING workspace_id, name, version
+`
+
+type PurgeExpiredRulesRow struct {
+	WorkspaceID int32  `json:"workspace_id"`
+	Name        string `json:"name"`
+	Version     int32  `json:"version"`
+}
+
+func (q *Queries) PurgeExpiredRules(ctx context.Context, retention pgtype.Interval) ([]PurgeExpiredRulesRow, error) {
+	rows, err := q.db.Query(ctx, purgeExpiredRules, retention)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []PurgeExpiredRulesRow{}
+	for rows.Next() {
+		var i PurgeExpiredRulesRow
+		if err := rows.Scan(&i.WorkspaceID, &i.Name, &i.Version); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const renameRule = `-- name: RenameRule :execrows
+UPDATE wasmorph.rules
+SET name = $1, updated_at = NOW()
+WHERE name = $2 AND workspace_id = $3 AND is_active = true
+`
+
+type RenameRuleParams struct {
+	NewName     string `json:"new_name"`
+	Name        string `json:"name"`
+	WorkspaceID int32  `json:"workspace_id"`
+}
+
+func (q *Queries) RenameRule(ctx context.Context, arg RenameRuleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, renameRule, arg.NewName, arg.Name, arg.WorkspaceID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const restoreRule = `-- name: RestoreRule :one
+UPDATE wasmorph.rules
+SET is_active = true, deleted_at = NULL, updated_at = NOW()
+WHERE name = $1 AND workspace_id = $2 AND is_active = false
+RETURNING version
+`
+
+type RestoreRuleParams struct {
+	Name        string `json:"name"`
+	WorkspaceID int32  `json:"workspace_id"`
+}
+
+func (q *Queries) RestoreRule(ctx context.Context, arg RestoreRuleParams) (int32, error) {
+	row := q.db.QueryRow(ctx, restoreRule, arg.Name, arg.WorkspaceID)
+	var version int32
+	err := row.Scan(&version)
+	return version, err
+}
+
+const revokeAPIKey = `-- name: RevokeAPIKey :execrows
+UPDATE wasmorph.api_keys SET is_active = false
+WHERE id = $1 AND user_id = $2 AND is_active = true
+`
+
+type RevokeAPIKeyParams struct {
+	ID     int32 `json:"id"`
+	UserID int32 `json:"user_id"`
+}
+
+func (q *Queries) RevokeAPIKey(ctx context.Context, arg RevokeAPIKeyParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeAPIKey, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeSession = `-- name: RevokeSession :exec
+UPDATE wasmorph.sessions
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	ID     int32 `json:"id"`
+	UserID int32 `json:"user_id"`
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) error {
+	_, err := q.db.Exec(ctx, revokeSession, arg.ID, arg.UserID)
+	return err
+}
+
+const revokeSessionByPreviousToken = `-- name: RevokeSessionByPreviousToken :exec
+UPDATE wasmorph.sessions
+SET revoked_at = NOW()
+WHERE previous_token_hash = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeSessionByPreviousToken(ctx context.Context, previousTokenHash string) error {
+	_, err := q.db.Exec(ctx, revokeSessionByPreviousToken, previousTokenHash)
+	return err
+}
+
+const revokeUserAPIKeys = `-- name: RevokeUserAPIKeys :exec
+UPDATE wasmorph.api_keys SET is_active = false
+WHERE user_id = $1 AND is_active = true
+`
+
+func (q *Queries) RevokeUserAPIKeys(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, revokeUserAPIKeys, userID)
+	return err
+}
+
+const revokeUserSessions = `-- name: RevokeUserSessions :exec
+UPDATE wasmorph.sessions
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserSessions(ctx context.Context, userID int32) error {
+	_, err := q.db.Exec(ctx, revokeUserSessions, userID)
+	return err
+}
+
+const rotateSession = `-- name: RotateSession :one
+UPDATE wasmorph.sessions
+SET previous_token_hash = refresh_token_hash,
+    refresh_token_hash = $1,
+    refreshed_at = NOW()
+WHERE refresh_token_hash = $2 AND revoked_at IS NULL AND expires_at > NOW()
+RETURNING id, user_id
+`
+
+type RotateSessionParams struct {
+	NewTokenHash string `json:"new_token_hash"`
+	TokenHash    string `json:"token_hash"`
+}
+
+type RotateSessionRow struct {
+	ID     int32 `json:"id"`
+	UserID int32 `json:"user_id"`
+}
+
+func (q *Queries) RotateSession(ctx context.Context, arg RotateSessionParams) (RotateSessionRow, error) {
+	row := q.db.QueryRow(ctx, rotateSession, arg.NewTokenHash, arg.TokenHash)
+	var i RotateSessionRow
+	err := row.Scan(&i.ID, &i.UserID)
+	return i, err
+}
+
+const setRuleAlias = `-- name: SetRuleAlias :one
+INSERT INTO wasmorph.rule_aliases (rule_id, alias, version)
+VALUES ($1, $2, $3)
+ON CONFLICT (rule_id, alias)
+DO UPDATE SET version = EXCLUDED.version, updated_at = NOW()
+RETURNING rule_id, alias, version, created_at, updated_at
+`
+
+type SetRuleAliasParams struct {
+	RuleID  int32  `json:"rule_id"`
+	Alias   string `json:"alias"`
+	Version int32  `json:"version"`
+}
+
+func (q *Queries) SetRuleAlias(ctx context.Context, arg SetRuleAliasParams) (WasmorphRuleAlias, error) {
+	row := q.db.QueryRow(ctx, setRuleAlias, arg.RuleID, arg.Alias, arg.Version)
+	var i WasmorphRuleAlias
+	err := row.Scan(
+		&i.RuleID,
+		&i.Alias,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const startBuildJob = `-- name: StartBuildJob :exec
+UPDATE wasmorph.build_jobs
+SET status = 'running', started_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) StartBuildJob(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, startBuildJob, id)
+	return err
+}
+
+const touchAPIKey = `-- name: TouchAPIKey :exec
+UPDATE wasmorph.api_keys SET last_used_at = NOW()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+`
+
+func (q *Queries) TouchAPIKey(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, touchAPIKey, id)
+	return err
+}
+
+const tryLockInstance = `-- name: TryLockInstance :one
+SELECT pg_try_advisory_lock($1::bigint)
+`
+
+func (q *Queries) TryLockInstance(ctx context.Context, instanceID int64) (bool, error) {
+	row := q.db.QueryRow(ctx, tryLockInstance, instanceID)
+	var pg_try_advisory_lock bool
+	err := row.Scan(&pg_try_advisory_lock)
+	return pg_try_advisory_lock, err
+}
+
+const unlockInstance = `-- name: UnlockInstance :exec
+SELECT pg_advisory_unlock($1::bigint)
+`
+
+func (q *Queries) UnlockInstance(ctx context.Context, instanceID int64) error {
+	_, err := q.db.Exec(ctx, unlockInstance, instanceID)
+	return err
+}
+
+const updateRule = `-- name: UpdateRule :one
+UPDATE wasmorph.rules
+SET source_code = COALESCE($1, source_code),
+    wasm_binary = COALESCE($2, wasm_binary),
+    description = COALESCE($3::text, description),
+    tags = COALESCE($4::text[], tags),
+    labels = COALESCE($5::jsonb, labels),
+    version = CASE WHEN $1::text IS NULL THEN version ELSE version + 1 END,
+    updated_at = NOW()
+WHERE name = $6 AND workspace_id = $7 AND is_active = true
+  AND version = $8
+RETURNING id, name, user_id, source_code, wasm_binary, created_at, updated_at, is_active, version, timeout_ms, max_memory_pages, max_output_bytes, min_instances, max_instances, workspace_id, description, tags, labels, deleted_at
+`
+
+type UpdateRuleParams struct {
+	SourceCode      pgtype.Text     `json:"source_code"`
+	WasmBinary      []byte          `json:"wasm_binary"`
+	Description     pgtype.Text     `json:"description"`
+	Tags            []string        `json:"tags"`
+	Labels          json.RawMessage `json:"labels"`
+	Name            string          `json:"name"`
+	WorkspaceID     int32           `json:"workspace_id"`
+	ExpectedVersion int32           `json:"expected_version"`
+}
+
+func (q *Queries) UpdateRule(ctx context.Context, arg UpdateRuleParams) (WasmorphRule, error) {
+	row := q.db.QueryRow(ctx, updateRule,
+		arg.SourceCode,
+		arg.WasmBinary,
+		arg.Description,
+		arg.Tags,
+		arg.Labels,
+		arg.Name,
+		arg.WorkspaceID,
+		arg.ExpectedVersion,
+	)
+	var i WasmorphRule
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.UserID,
+		&i.SourceCode,
+		&i.WasmBinary,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.IsActive,
+		&i.Version,
+		&i.TimeoutMs,
+		&i.MaxMemoryPages,
+		&i.MaxOutputBytes,
+		&i.MinInstances,
+		&i.MaxInstances,
+		&i.WorkspaceID,
+		&i.Description,
+		&i.Tags,
+		&i.Labels,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const updateRuleLimits = `-- name: UpdateRuleLimits :execrows
+UPDATE wasmorph.rules
+SET timeout_ms = $3, max_memory_pages = $4, max_output_bytes = $5,
+    min_instances = $6, max_instances = $7, updated_at = NOW()
+WHERE name = $1 AND workspace_id = $2 AND is_active = true
+`
+
+type UpdateRuleLimitsParams struct {
+	Name           string `json:"name"`
+	WorkspaceID    int32  `json:"workspace_id"`
+	TimeoutMs      int32  `json:"timeout_ms"`
+	MaxMemoryPages int32  `json:"max_memory_pages"`
+	MaxOutputBytes int32  `json:"max_output_bytes"`
+	MinInstances   int32  `json:"min_instances"`
+	MaxInstances   int32  `json:"max_instances"`
+}
+
+func (q *Queries) UpdateRuleLimits(ctx context.Context, arg UpdateRuleLimitsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateRuleLimits,
+		arg.Name,
+		arg.WorkspaceID,
+		arg.TimeoutMs,
+		arg.MaxMemoryPages,
+		arg.MaxOutputBytes,
+		arg.MinInstances,
+		arg.MaxInstances,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE wasmorph.users
+SET password_hash = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID           int32  `json:"id"`
+	PasswordHash string `json:"password_hash"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.Exec(ctx, updateUserPassword, arg.ID, arg.PasswordHash)
+	return err
+}
+
+const updateUserStatus = `-- name: UpdateUserStatus :execrows
+UPDATE wasmorph.users
+SET is_active = COALESCE($1, is_active),
+    is_admin = COALESCE($2, is_admin),
+    updated_at = NOW()
+WHERE id = $3
+`
+
+type UpdateUserStatusParams struct {
+	IsActive pgtype.Bool `json:"is_active"`
+	IsAdmin  pgtype.Bool `json:"is_admin"`
+	ID       int32       `json:"id"`
+}
+
+func (q *Queries) UpdateUserStatus(ctx context.Context, arg UpdateUserStatusParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateUserStatus, arg.IsActive, arg.IsAdmin, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const validateAPIKey = `-- name: ValidateAPIKey :one
+SELECT k.id, k.user_id, k.scopes, k.rule_patterns FROM wasmorph.api_keys k
+JOIN wasmorph.users u ON u.id = k.user_id
+WHERE k.key_hash = $1 AND k.is_active = true AND u.is_active = true
+  AND (k.expires_at IS NULL OR k.expires_at > NOW())
+`
+
+type ValidateAPIKeyRow struct {
+	ID           int32    `json:"id"`
+	UserID       int32    `json:"user_id"`
+	Scopes       []string `json:"scopes"`
+	RulePatterns []string `json:"rule_patterns"`
+}
+
+func (q *Queries) ValidateAPIKey(ctx context.Context, keyHash string) (ValidateAPIKeyRow, error) {
+	row := q.db.QueryRow(ctx, validateAPIKey, keyHash)
+	var i ValidateAPIKeyRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Scopes,
+		&i.RulePatterns,
+	)
+	return i, err
 }
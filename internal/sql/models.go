@@ -5,26 +5,102 @@
 package sql
 
 import (
+	"encoding/json"
+
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type WasmorphApiKey struct {
-	ID        int32            `json:"id"`
-	ApiKey    string           `json:"api_key"`
-	UserID    int32            `json:"user_id"`
-	CreatedAt pgtype.Timestamp `json:"created_at"`
-	IsActive  pgtype.Bool      `json:"is_active"`
+	ID           int32            `json:"id"`
+	UserID       int32            `json:"user_id"`
+	CreatedAt    pgtype.Timestamp `json:"created_at"`
+	IsActive     pgtype.Bool      `json:"is_active"`
+	Label        string           `json:"label"`
+	LastUsedAt   pgtype.Timestamp `json:"last_used_at"`
+	ExpiresAt    pgtype.Timestamp `json:"expires_at"`
+	KeyHash      string           `json:"key_hash"`
+	KeyPrefix    string           `json:"key_prefix"`
+	Scopes       []string         `json:"scopes"`
+	RulePatterns []string         `json:"rule_patterns"`
+}
+
+type WasmorphAuditLog struct {
+	ID            int64            `json:"id"`
+	CreatedAt     pgtype.Timestamp `json:"created_at"`
+	ActorUserID   pgtype.Int4      `json:"actor_user_id"`
+	ActorApiKeyID pgtype.Int4      `json:"actor_api_key_id"`
+	SourceIp      pgtype.Text      `json:"source_ip"`
+	WorkspaceID   pgtype.Int4      `json:"workspace_id"`
+	Action        string           `json:"action"`
+	Target        string           `json:"target"`
+	Detail        pgtype.Text      `json:"detail"`
+	VersionBefore pgtype.Int4      `json:"version_before"`
+	VersionAfter  pgtype.Int4      `json:"version_after"`
+}
+
+type WasmorphBuildJob struct {
+	ID          int32            `json:"id"`
+	UserID      int32            `json:"user_id"`
+	RuleName    string           `json:"rule_name"`
+	SourceCode  string           `json:"source_code"`
+	Status      string           `json:"status"`
+	Error       pgtype.Text      `json:"error"`
+	RuleVersion pgtype.Int4      `json:"rule_version"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	StartedAt   pgtype.Timestamp `json:"started_at"`
+	FinishedAt  pgtype.Timestamp `json:"finished_at"`
+	WorkspaceID int32            `json:"workspace_id"`
+	InstanceID  pgtype.Int8      `json:"instance_id"`
 }
 
 type WasmorphRule struct {
+	ID             int32            `json:"id"`
+	Name           string           `json:"name"`
+	UserID         int32            `json:"user_id"`
+	SourceCode     string           `json:"source_code"`
+	WasmBinary     []byte           `json:"wasm_binary"`
+	CreatedAt      pgtype.Timestamp `json:"created_at"`
+	UpdatedAt      pgtype.Timestamp `json:"updated_at"`
+	IsActive       pgtype.Bool      `json:"is_active"`
+	Version        int32            `json:"version"`
+	TimeoutMs      int32            `json:"timeout_ms"`
+	MaxMemoryPages int32            `json:"max_memory_pages"`
+	MaxOutputBytes int32            `json:"max_output_bytes"`
+	MinInstances   int32            `json:"min_instances"`
+	MaxInstances   int32            `json:"max_instances"`
+	WorkspaceID    int32            `json:"workspace_id"`
+	Description    string           `json:"description"`
+	Tags           []string         `json:"tags"`
+	Labels         json.RawMessage  `json:"labels"`
+	DeletedAt      pgtype.Timestamp `json:"deleted_at"`
+}
+
+type WasmorphRuleAlias struct {
+	RuleID    int32            `json:"rule_id"`
+	Alias     string           `json:"alias"`
+	Version   int32            `json:"version"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+	UpdatedAt pgtype.Timestamp `json:"updated_at"`
+}
+
+type WasmorphRuleVersion struct {
 	ID         int32            `json:"id"`
-	Name       string           `json:"name"`
-	UserID     int32            `json:"user_id"`
+	RuleID     int32            `json:"rule_id"`
+	Version    int32            `json:"version"`
 	SourceCode string           `json:"source_code"`
 	WasmBinary []byte           `json:"wasm_binary"`
 	CreatedAt  pgtype.Timestamp `json:"created_at"`
-	UpdatedAt  pgtype.Timestamp `json:"updated_at"`
-	IsActive   pgtype.Bool      `json:"is_active"`
+}
+
+type WasmorphSession struct {
+	ID                int32            `json:"id"`
+	UserID            int32            `json:"user_id"`
+	RefreshTokenHash  string           `json:"refresh_token_hash"`
+	PreviousTokenHash pgtype.Text      `json:"previous_token_hash"`
+	CreatedAt         pgtype.Timestamp `json:"created_at"`
+	RefreshedAt       pgtype.Timestamp `json:"refreshed_at"`
+	ExpiresAt         pgtype.Timestamp `json:"expires_at"`
+	RevokedAt         pgtype.Timestamp `json:"revoked_at"`
 }
 
 type WasmorphUser struct {
@@ -35,4 +111,27 @@ type WasmorphUser struct {
 	UpdatedAt    pgtype.Timestamp `json:"updated_at"`
 	IsActive     pgtype.Bool      `json:"is_active"`
 	Email        pgtype.Text      `json:"email"`
+	IsAdmin      bool             `json:"is_admin"`
+}
+
+type WasmorphUserIdentity struct {
+	Issuer    string           `json:"issuer"`
+	Subject   string           `json:"subject"`
+	UserID    int32            `json:"user_id"`
+	Email     pgtype.Text      `json:"email"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type WasmorphWorkspace struct {
+	ID             int32            `json:"id"`
+	Name           string           `json:"name"`
+	PersonalUserID pgtype.Int4      `json:"personal_user_id"`
+	CreatedAt      pgtype.Timestamp `json:"created_at"`
+}
+
+type WasmorphWorkspaceMember struct {
+	WorkspaceID int32            `json:"workspace_id"`
+	UserID      int32            `json:"user_id"`
+	Role        string           `json:"role"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
 }
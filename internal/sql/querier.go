@@ -11,17 +11,79 @@ import (
 )
 
 type Querier interface {
+	CompleteBuildJob(ctx context.Context, arg CompleteBuildJobParams) error
+	CountWorkspaceOwners(ctx context.Context, workspaceID int32) (int64, error)
 	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (WasmorphApiKey, error)
+	CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) error
+	CreateBuildJob(ctx context.Context, arg CreateBuildJobParams) (WasmorphBuildJob, error)
 	CreateRule(ctx context.Context, arg CreateRuleParams) (WasmorphRule, error)
+	CreateRuleVersion(ctx context.Context, arg CreateRuleVersionParams) (WasmorphRuleVersion, error)
+	CreateSession(ctx context.Context, arg CreateSessionParams) (int32, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error)
+	CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) error
+	CreateWorkspace(ctx context.Context, name string) (WasmorphWorkspace, error)
+	DeleteFinishedBuildJobs(ctx context.Context, arg DeleteFinishedBuildJobsParams) error
 	DeleteRule(ctx context.Context, arg DeleteRuleParams) error
-	GetRuleByNameAndUser(ctx context.Context, arg GetRuleByNameAndUserParams) (WasmorphRule, error)
+	DeleteRuleAlias(ctx context.Context, arg DeleteRuleAliasParams) (int64, error)
+	FailBuildJob(ctx context.Context, arg FailBuildJobParams) error
+	FailInstanceBuildJobs(ctx context.Context, arg FailInstanceBuildJobsParams) (int64, error)
+	GetBuildJob(ctx context.Context, arg GetBuildJobParams) (GetBuildJobRow, error)
+	GetPersonalWorkspaceID(ctx context.Context, personalUserID pgtype.Int4) (int32, error)
+	GetRuleAliasVersion(ctx context.Context, arg GetRuleAliasVersionParams) (int32, error)
+	GetRuleByNameAndWorkspace(ctx context.Context, arg GetRuleByNameAndWorkspaceParams) (WasmorphRule, error)
+	GetRuleHeadVersion(ctx context.Context, arg GetRuleHeadVersionParams) (int32, error)
+	GetRuleLimits(ctx context.Context, arg GetRuleLimitsParams) (GetRuleLimitsRow, error)
+	GetRuleVersion(ctx context.Context, arg GetRuleVersionParams) (WasmorphRuleVersion, error)
 	GetUserByEmail(ctx context.Context, email pgtype.Text) (GetUserByEmailRow, error)
 	GetUserByID(ctx context.Context, id int32) (GetUserByIDRow, error)
 	GetUserByUsername(ctx context.Context, username string) (GetUserByUsernameRow, error)
-	ListRulesByUser(ctx context.Context, userID int32) ([]ListRulesByUserRow, error)
+	GetUserIDByIdentity(ctx context.Context, arg GetUserIDByIdentityParams) (int32, error)
+	GetUserSummary(ctx context.Context, id int32) (GetUserSummaryRow, error)
+	GetWorkspace(ctx context.Context, id int32) (WasmorphWorkspace, error)
+	GetWorkspaceRole(ctx context.Context, arg GetWorkspaceRoleParams) (string, error)
+	IsRuleDeleted(ctx context.Context, arg IsRuleDeletedParams) (bool, error)
+	IsSessionActive(ctx context.Context, arg IsSessionActiveParams) (bool, error)
+	IsUserAdmin(ctx context.Context, id int32) (bool, error)
+	ListAPIKeysByUser(ctx context.Context, userID int32) ([]ListAPIKeysByUserRow, error)
+	ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]ListAuditEventsRow, error)
+	ListDeletedRulesPage(ctx context.Context, arg ListDeletedRulesPageParams) ([]ListDeletedRulesPageRow, error)
+	ListRuleAliases(ctx context.Context, arg ListRuleAliasesParams) ([]ListRuleAliasesRow, error)
+	ListRuleVersions(ctx context.Context, arg ListRuleVersionsParams) ([]ListRuleVersionsRow, error)
+	ListRulesByWorkspace(ctx context.Context, workspaceID int32) ([]ListRulesByWorkspaceRow, error)
+	ListRulesPageByCreated(ctx context.Context, arg ListRulesPageByCreatedParams) ([]ListRulesPageByCreatedRow, error)
+	ListRulesPageByName(ctx context.Context, arg ListRulesPageByNameParams) ([]ListRulesPageByNameRow, error)
+	ListRulesPageByUpdated(ctx context.Context, arg ListRulesPageByUpdatedParams) ([]ListRulesPageByUpdatedRow, error)
+	ListUnfinishedBuildInstances(ctx context.Context) ([]pgtype.Int8, error)
+	ListUserSummaries(ctx context.Context) ([]ListUserSummariesRow, error)
+	ListWorkspaceMembers(ctx context.Context, workspaceID int32) ([]ListWorkspaceMembersRow, error)
+	ListWorkspacesByUser(ctx context.Context, userID int32) ([]ListWorkspacesByUserRow, error)
+	LockInstance(ctx context.Context, instanceID int64) error
+	LockWorkspace(ctx context.Context, id int32) error
+	MoveRule(ctx context.Context, arg MoveRuleParams) (int64, error)
+	NotifyMembershipChanged(ctx context.Context, payload string) error
+	NotifyRuleChanged(ctx context.Context, payload string) error
+	PurgeDeletedRule(ctx context.Context, arg PurgeDeletedRuleParams) (int32, error)
+	PurgeExpiredRules(ctx context.Context, retention pgtype.Interval) ([]PurgeExpiredRulesRow, error)
+	RemoveWorkspaceMember(ctx context.Context, arg RemoveWorkspaceMemberParams) (int64, error)
+	RenameRule(ctx context.Context, arg RenameRuleParams) (int64, error)
+	RestoreRule(ctx context.Context, arg RestoreRuleParams) (int32, error)
+	RevokeAPIKey(ctx context.Context, arg RevokeAPIKeyParams) (int64, error)
+	RevokeSession(ctx context.Context, arg RevokeSessionParams) error
+	RevokeSessionByPreviousToken(ctx context.Context, previousTokenHash string) error
+	RevokeUserAPIKeys(ctx context.Context, userID int32) error
+	RevokeUserSessions(ctx context.Context, userID int32) error
+	RotateSession(ctx context.Context, arg RotateSessionParams) (RotateSessionRow, error)
+	SetRuleAlias(ctx context.Context, arg SetRuleAliasParams) (WasmorphRuleAlias, error)
+	SetWorkspaceMember(ctx context.Context, arg SetWorkspaceMemberParams) (WasmorphWorkspaceMember, error)
+	StartBuildJob(ctx context.Context, id int32) error
+	TouchAPIKey(ctx context.Context, id int32) error
+	TryLockInstance(ctx context.Context, instanceID int64) (bool, error)
+	UnlockInstance(ctx context.Context, instanceID int64) error
 	UpdateRule(ctx context.Context, arg UpdateRuleParams) (WasmorphRule, error)
-	ValidateAPIKey(ctx context.Context, apiKey string) (int32, error)
+	UpdateRuleLimits(ctx context.Context, arg UpdateRuleLimitsParams) (int64, error)
+	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
+	UpdateUserStatus(ctx context.Context, arg UpdateUserStatusParams) (int64, error)
+	ValidateAPIKey(ctx context.Context, keyHash string) (ValidateAPIKeyRow, error)
 }
 
 var _ Querier = (*Queries)(nil)
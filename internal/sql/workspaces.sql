@@ -0,0 +1,53 @@
+-- name: GetPersonalWorkspaceID :one
+SELECT id FROM wasmorph.workspaces
+WHERE personal_user_id = $1;
+
+-- name: GetWorkspace :one
+SELECT id, name, personal_user_id, created_at FROM wasmorph.workspaces
+WHERE id = $1;
+
+-- name: LockWorkspace :exec
+SELECT id FROM wasmorph.workspaces
+WHERE id = $1
+FOR UPDATE;
+
+-- name: CreateWorkspace :one
+INSERT INTO wasmorph.workspaces (name)
+VALUES ($1)
+RETURNING id, name, personal_user_id, created_at;
+
+-- name: ListWorkspacesByUser :many
+SELECT w.id, w.name, w.personal_user_id, w.created_at, m.role
+FROM wasmorph.workspaces w
+JOIN wasmorph.workspace_members m ON m.workspace_id = w.id
+WHERE m.user_id = $1
+ORDER BY w.id;
+
+-- name: GetWorkspaceRole :one
+SELECT role FROM wasmorph.workspace_members
+WHERE workspace_id = $1 AND user_id = $2;
+
+-- name: SetWorkspaceMember :one
+INSERT INTO wasmorph.workspace_members (workspace_id, user_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT (workspace_id, user_id)
+DO UPDATE SET role = EXCLUDED.role
+RETURNING workspace_id, user_id, role, created_at;
+
+-- name: ListWorkspaceMembers :many
+SELECT m.user_id, u.username, m.role, m.created_at
+FROM wasmorph.workspace_members m
+JOIN wasmorph.users u ON u.id = m.user_id
+WHERE m.workspace_id = $1
+ORDER BY u.username;
+
+-- name: RemoveWorkspaceMember :execrows
+DELETE FROM wasmorph.workspace_members
+WHERE workspace_id = $1 AND user_id = $2;
+
+-- name: CountWorkspaceOwners :one
+SELECT COUNT(*) FROM wasmorph.workspace_members
+WHERE workspace_id = $1 AND role = 'owner';
+
+-- name: NotifyMembershipChanged :exec
+SELECT pg_notify('wasmorph_members', sqlc.arg(payload)::text);
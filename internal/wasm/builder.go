@@ -0,0 +1,135 @@
+package wasm
+
+import (
+	"context"
+)
+
+var ErrBuildQueueFull = newError(CodeUnavailable, "build queue is full")
+
+type CompileFunc func(sourceCode, ruleName string) ([]byte, error)
+
+// LookupFunc returns the binary of an earlier identical build, if any.
+type LookupFunc func(sourceCode string) ([]byte, bool)
+
+type buildTask struct {
+	ctx        context.Context
+	sourceCode string
+	ruleName   string
+	started    func()
+	finished   func(wasmBytes []byte, err error)
+}
+
+// Builder runs compilations on a fixed number of workers, so concurrent saves
+// queue up instead of each starting its own TinyGo process.
+//
+// Builds already present in the compile cache skip the queue entirely.
+type Builder struct {
+	compile CompileFunc
+	lookup  LookupFunc
+	tasks   chan buildTask
+}
+
+func NewBuilder(compile CompileFunc, lookup LookupFunc, workers, queueSize int) *Builder {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	b := &Builder{
+		compile: compile,
+		lookup:  lookup,
+		tasks:   make(chan buildTask, queueSize),
+	}
+	for i := 0; i < workers; i++ {
+		go b.worker()
+	}
+	return b
+}
+
+func (b *Builder) worker() {
+	for task := range b.tasks {
+		if err := task.ctx.Err(); err != nil {
+			task.finished(nil, err)
+			continue
+		}
+		if task.started != nil {
+			task.started()
+		}
+		wasmBytes, err := b.compile(task.sourceCode, task.ruleName)
+		task.finished(wasmBytes, err)
+	}
+}
+
+// Compile waits for a free worker, compiles the source and returns the binary.
+func (b *Builder) Compile(ctx context.Context, sourceCode, ruleName string) ([]byte, error) {
+	if wasmBytes, ok := b.cached(sourceCode); ok {
+		return wasmBytes, nil
+	}
+
+	type result struct {
+		wasmBytes []byte
+		err       error
+	}
+	done := make(chan result, 1)
+
+	task := buildTask{
+		ctx:        ctx,
+		sourceCode: sourceCode,
+		ruleName:   ruleName,
+		finished: func(wasmBytes []byte, err error) {
+			done <- result{wasmBytes: wasmBytes, err: err}
+		},
+	}
+
+	select {
+	case b.tasks <- task:
+	case <-ctx.Done():
+		return nil, contextError(ctx.Err())
+	}
+
+	select {
+	case res := <-done:
+		return res.wasmBytes, res.err
+	case <-ctx.Done():
+		return nil, contextError(ctx.Err())
+	}
+}
+
+// Submit queues a build without waiting for it. started is called when a
+// worker picks the build up and finished when it completes. It returns
+// ErrBuildQueueFull instead of blocking when the queue has no room.
+func (b *Builder) Submit(sourceCode, ruleName string, started func(), finished func(wasmBytes []byte, err error)) error {
+	if wasmBytes, ok := b.cached(sourceCode); ok {
+		go func() {
+			if started != nil {
+				started()
+			}
+			finished(wasmBytes, nil)
+		}()
+		return nil
+	}
+
+	task := buildTask{
+		ctx:        context.Background(),
+		sourceCode: sourceCode,
+		ruleName:   ruleName,
+		started:    started,
+		finished:   finished,
+	}
+
+	select {
+	case b.tasks <- task:
+		return nil
+	default:
+		return ErrBuildQueueFull
+	}
+}
+
+func (b *Builder) cached(sourceCode string) ([]byte, bool) {
+	if b.lookup == nil {
+		return nil, false
+	}
+	return b.lookup(sourceCode)
+}
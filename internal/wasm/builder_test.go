@@ -0,0 +1,127 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder_Compile(t *testing.T) {
+	builder := NewBuilder(func(sourceCode, ruleName string) ([]byte, error) {
+		if sourceCode == "bad" {
+			return nil, errors.New("compile error")
+		}
+		return []byte(ruleName + ":" + sourceCode), nil
+	}, nil, 1, 1)
+
+	wasmBytes, err := builder.Compile(context.Background(), "code", "rule")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("rule:code"), wasmBytes)
+
+	_, err = builder.Compile(context.Background(), "bad", "rule")
+	assert.EqualError(t, err, "compile error")
+}
+
+func TestBuilder_LimitsConcurrency(t *testing.T) {
+	const workers = 2
+
+	var running, maxRunning atomic.Int32
+	builder := NewBuilder(func(sourceCode, ruleName string) ([]byte, error) {
+		current := running.Add(1)
+		for {
+			seen := maxRunning.Load()
+			if current <= seen || maxRunning.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+		return nil, nil
+	}, nil, workers, 10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := builder.Compile(context.Background(), "code", "rule")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, maxRunning.Load(), int32(workers))
+}
+
+func TestBuilder_Submit(t *testing.T) {
+	release := make(chan struct{})
+	builder := NewBuilder(func(sourceCode, ruleName string) ([]byte, error) {
+		<-release
+		return []byte(sourceCode), nil
+	}, nil, 1, 1)
+
+	started := make(chan struct{}, 2)
+	results := make(chan []byte, 2)
+	submit := func() error {
+		return builder.Submit("code", "rule",
+			func() { started <- struct{}{} },
+			func(wasmBytes []byte, err error) { results <- wasmBytes },
+		)
+	}
+
+	require.NoError(t, submit())
+	<-started
+	require.NoError(t, submit())
+	assert.ErrorIs(t, submit(), ErrBuildQueueFull)
+
+	close(release)
+	assert.Equal(t, []byte("code"), <-results)
+	assert.Equal(t, []byte("code"), <-results)
+}
+
+func TestBuilder_CompileCanceled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	builder := NewBuilder(func(sourceCode, ruleName string) ([]byte, error) {
+		<-release
+		return nil, nil
+	}, nil, 1, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := builder.Compile(ctx, "code", "rule")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestBuilder_CacheHitSkipsQueue(t *testing.T) {
+	var compiled atomic.Int32
+	builder := NewBuilder(func(sourceCode, ruleName string) ([]byte, error) {
+		compiled.Add(1)
+		return []byte("compiled"), nil
+	}, func(sourceCode string) ([]byte, bool) {
+		return []byte("cached"), sourceCode == "known"
+	}, 1, 0)
+
+	wasmBytes, err := builder.Compile(context.Background(), "known", "rule")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("cached"), wasmBytes)
+
+	done := make(chan []byte, 1)
+	require.NoError(t, builder.Submit("known", "rule", nil, func(wasmBytes []byte, err error) {
+		done <- wasmBytes
+	}))
+	assert.Equal(t, []byte("cached"), <-done)
+	assert.Equal(t, int32(0), compiled.Load())
+
+	wasmBytes, err = builder.Compile(context.Background(), "new", "rule")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("compiled"), wasmBytes)
+	assert.Equal(t, int32(1), compiled.Load())
+}
@@ -2,7 +2,10 @@ package wasm
 
 import (
 	"context"
+	"fmt"
+	"sync"
 
+	"github.com/Gmacem/wasmorph/internal/workspace"
 	"github.com/dgraph-io/ristretto"
 )
 
@@ -46,8 +49,10 @@ func NewRistrettoCache(config *RuntimeCacheConfig) RuntimeCache {
 		NumCounters: config.NumCounters,
 		MaxCost:     config.MaxCost,
 		BufferItems: config.BufferItems,
-		OnEvict: func(item *ristretto.Item) {
-			if runtime, ok := item.Value.(*Runtime); ok && runtime != nil {
+		// OnExit runs for every value leaving the cache: on eviction,
+		// rejection, replacement and Del alike.
+		OnExit: func(val interface{}) {
+			if runtime, ok := val.(*Runtime); ok && runtime != nil {
 				runtime.Close()
 			}
 		},
@@ -83,3 +88,186 @@ func (c *RistrettoCache) Delete(ctx context.Context, key string) {
 func (c *RistrettoCache) Close() {
 	c.cache.Close()
 }
+
+// ruleIndex remembers which cache keys belong to each rule, so that every
+// cached runtime of a rule can be dropped when the rule changes. It also
+// remembers the versions that the rule's head and aliases resolve to.
+//
+// Each rule also carries a generation that is bumped on eviction. A runtime
+// loaded before an eviction is not cached afterwards, even if the load
+// finishes later.
+type ruleIndex struct {
+	cache RuntimeCache
+	mu    sync.Mutex
+	rules map[string]*indexedRule
+}
+
+type indexedRule struct {
+	generation uint64
+	keys       map[string]struct{}
+	versions   map[VersionRef]int32
+}
+
+func newRuleIndex(cache RuntimeCache) *ruleIndex {
+	return &ruleIndex{
+		cache: cache,
+		rules: make(map[string]*indexedRule),
+	}
+}
+
+func ruleIndexKey(workspaceID int32, name string) string {
+	return fmt.Sprintf("%d:%s", workspaceID, name)
+}
+
+func (i *ruleIndex) rule(key string) *indexedRule {
+	rule, ok := i.rules[key]
+	if !ok {
+		rule = &indexedRule{
+			keys:     make(map[string]struct{}),
+			versions: make(map[VersionRef]int32),
+		}
+		i.rules[key] = rule
+	}
+	return rule
+}
+
+// generation returns the rule's current generation. Read it before loading
+// the rule from the database and pass it to set.
+func (i *ruleIndex) generation(rule string) uint64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.rule(rule).generation
+}
+
+// set caches runtime under key unless the rule was evicted since generation
+// was read. It reports whether the runtime was cached.
+func (i *ruleIndex) set(ctx context.Context, rule string, generation uint64, key string, runtime *Runtime, cost int64) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	r := i.rule(rule)
+	if r.generation != generation {
+		return false
+	}
+	r.keys[key] = struct{}{}
+	return i.cache.Set(ctx, key, runtime, cost)
+}
+
+// version returns the version that ref was last resolved to, if the rule has
+// not been evicted since.
+func (i *ruleIndex) version(rule string, ref VersionRef) (int32, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	version, ok := i.rule(rule).versions[ref]
+	return version, ok
+}
+
+// setVersion remembers that ref resolves to version, unless the rule was
+// evicted since generation was read.
+func (i *ruleIndex) setVersion(rule string, generation uint64, ref VersionRef, version int32) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	r := i.rule(rule)
+	if r.generation == generation {
+		r.versions[ref] = version
+	}
+}
+
+// evict drops every cached runtime of the rule.
+func (i *ruleIndex) evict(ctx context.Context, rule string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	r := i.rule(rule)
+	r.generation++
+	for key := range r.keys {
+		i.cache.Delete(ctx, key)
+	}
+	r.keys = make(map[string]struct{})
+	r.versions = make(map[VersionRef]int32)
+}
+
+// evictAll drops every cached runtime of every rule.
+func (i *ruleIndex) evictAll(ctx context.Context) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, r := range i.rules {
+		r.generation++
+		for key := range r.keys {
+			i.cache.Delete(ctx, key)
+		}
+		r.keys = make(map[string]struct{})
+		r.versions = make(map[VersionRef]int32)
+	}
+}
+
+// memberIndex caches the workspace and role that each caller resolves to, so
+// that executions are authorized without a query. Like ruleIndex it carries a
+// generation, bumped on eviction, so that a role loaded before a membership
+// change is not cached afterwards.
+type memberIndex struct {
+	mu         sync.Mutex
+	generation uint64
+	members    map[workspace.Caller]cachedMember
+}
+
+type cachedMember struct {
+	workspaceID int32
+	role        workspace.Role
+}
+
+func newMemberIndex() *memberIndex {
+	return &memberIndex{members: make(map[workspace.Caller]cachedMember)}
+}
+
+func (i *memberIndex) get(caller workspace.Caller) (cachedMember, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	member, ok := i.members[caller]
+	return member, ok
+}
+
+// currentGeneration returns the generation to pass to set. Read it before
+// loading the role from the database.
+func (i *memberIndex) currentGeneration() uint64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.generation
+}
+
+// set caches the caller's member unless a membership changed since
+// generation was read.
+func (i *memberIndex) set(caller workspace.Caller, generation uint64, member cachedMember) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.generation == generation {
+		i.members[caller] = member
+	}
+}
+
+// evict drops the cached role of the user in the workspace.
+func (i *memberIndex) evict(workspaceID, userID int32) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.generation++
+	for caller, member := range i.members {
+		if caller.UserID == userID && member.workspaceID == workspaceID {
+			delete(i.members, caller)
+		}
+	}
+}
+
+// evictAll drops every cached role.
+func (i *memberIndex) evictAll() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.generation++
+	i.members = make(map[workspace.Caller]cachedMember)
+}
@@ -2,7 +2,10 @@ package wasm
 
 import (
 	"context"
+	"errors"
 	"testing"
+
+	"github.com/Gmacem/wasmorph/internal/workspace"
 )
 
 func TestNoOpCache(t *testing.T) {
@@ -54,3 +57,192 @@ func TestRistrettoCache(t *testing.T) {
 		t.Error("Cache should be empty after delete")
 	}
 }
+
+func runtimeClosed(runtime *Runtime) bool {
+	runtime.mu.Lock()
+	defer runtime.mu.Unlock()
+	return runtime.closed
+}
+
+func TestRistrettoCacheClosesRemovedRuntimes(t *testing.T) {
+	cache := NewRistrettoCache(&RuntimeCacheConfig{
+		MaxCost:     1024,
+		NumCounters: 10,
+		BufferItems: 64,
+	})
+	defer cache.Close()
+	store := cache.(*RistrettoCache).cache
+	ctx := context.Background()
+
+	deleted := &Runtime{}
+	cache.Set(ctx, "deleted", deleted, 100)
+	store.Wait()
+	cache.Delete(ctx, "deleted")
+	store.Wait()
+	if !runtimeClosed(deleted) {
+		t.Error("Deleted runtime should be closed")
+	}
+
+	replaced := &Runtime{}
+	cache.Set(ctx, "replaced", replaced, 100)
+	store.Wait()
+	cache.Set(ctx, "replaced", &Runtime{}, 100)
+	store.Wait()
+	if !runtimeClosed(replaced) {
+		t.Error("Replaced runtime should be closed")
+	}
+
+	busy := &Runtime{}
+	cache.Set(ctx, "busy", busy, 100)
+	store.Wait()
+	busy.acquire()
+	cache.Delete(ctx, "busy")
+	store.Wait()
+	if runtimeClosed(busy) {
+		t.Error("Runtime should stay open while a call is running")
+	}
+	busy.release()
+	if !runtimeClosed(busy) {
+		t.Error("Runtime should be closed when its last call finishes")
+	}
+	if _, err := busy.ExecuteTransform(ctx, nil); !errors.Is(err, errRuntimeClosed) {
+		t.Errorf("Expected errRuntimeClosed from a closed runtime, got %v", err)
+	}
+}
+
+type mapCache struct {
+	NoOpCache
+	items map[string]*Runtime
+}
+
+func (c *mapCache) Get(ctx context.Context, key string) (*Runtime, bool) {
+	runtime, found := c.items[key]
+	return runtime, found
+}
+
+func (c *mapCache) Set(ctx context.Context, key string, runtime *Runtime, cost int64) bool {
+	c.items[key] = runtime
+	return true
+}
+
+func (c *mapCache) Delete(ctx context.Context, key string) {
+	delete(c.items, key)
+}
+
+func TestRuleIndex(t *testing.T) {
+	cache := &mapCache{items: make(map[string]*Runtime)}
+	index := newRuleIndex(cache)
+	ctx := context.Background()
+
+	rule := ruleIndexKey(1, "rule")
+	other := ruleIndexKey(1, "other")
+
+	generation := index.generation(rule)
+	index.set(ctx, rule, generation, ruleCacheKey(1, "rule", 1), &Runtime{}, 1)
+	index.set(ctx, rule, generation, ruleCacheKey(1, "rule", 2), &Runtime{}, 1)
+	index.set(ctx, other, index.generation(other), ruleCacheKey(1, "other", 1), &Runtime{}, 1)
+
+	index.evict(ctx, rule)
+
+	if len(cache.items) != 1 {
+		t.Errorf("Expected only the other rule to stay cached, got %d entries", len(cache.items))
+	}
+	if _, found := cache.Get(ctx, ruleCacheKey(1, "other", 1)); !found {
+		t.Error("Evicting a rule should not touch other rules")
+	}
+
+	// A load that started before the eviction must not repopulate the cache.
+	if index.set(ctx, rule, generation, ruleCacheKey(1, "rule", 1), &Runtime{}, 1) {
+		t.Error("Runtime loaded before eviction should not be cached")
+	}
+	if _, found := cache.Get(ctx, ruleCacheKey(1, "rule", 1)); found {
+		t.Error("Stale runtime should not be cached")
+	}
+
+	if !index.set(ctx, rule, index.generation(rule), ruleCacheKey(1, "rule", 3), &Runtime{}, 1) {
+		t.Error("Runtime loaded after eviction should be cached")
+	}
+}
+
+func TestRuleIndexEvictAll(t *testing.T) {
+	cache := &mapCache{items: make(map[string]*Runtime)}
+	index := newRuleIndex(cache)
+	ctx := context.Background()
+
+	rule := ruleIndexKey(1, "rule")
+	other := ruleIndexKey(2, "other")
+	generation := index.generation(rule)
+	index.set(ctx, rule, generation, ruleCacheKey(1, "rule", 1), &Runtime{}, 1)
+	index.set(ctx, other, index.generation(other), ruleCacheKey(2, "other", 1), &Runtime{}, 1)
+
+	index.evictAll(ctx)
+
+	if len(cache.items) != 0 {
+		t.Errorf("Expected empty cache, got %d entries", len(cache.items))
+	}
+	if index.set(ctx, rule, generation, ruleCacheKey(1, "rule", 1), &Runtime{}, 1) {
+		t.Error("Runtime loaded before eviction should not be cached")
+	}
+}
+
+func TestRuleIndexVersions(t *testing.T) {
+	index := newRuleIndex(&NoOpCache{})
+	ctx := context.Background()
+
+	rule := ruleIndexKey(1, "rule")
+	head := VersionRef{}
+	stable := VersionRef{Alias: "stable"}
+
+	generation := index.generation(rule)
+	index.setVersion(rule, generation, head, 3)
+	index.setVersion(rule, generation, stable, 2)
+	if version, ok := index.version(rule, stable); !ok || version != 2 {
+		t.Errorf("Expected the alias to resolve to version 2, got %d (cached: %v)", version, ok)
+	}
+
+	index.evict(ctx, rule)
+
+	if _, ok := index.version(rule, head); ok {
+		t.Error("Evicting a rule should drop its resolved versions")
+	}
+	index.setVersion(rule, generation, head, 3)
+	if _, ok := index.version(rule, head); ok {
+		t.Error("Version resolved before eviction should not be cached")
+	}
+}
+
+func TestMemberIndex(t *testing.T) {
+	index := newMemberIndex()
+
+	personal := workspace.Caller{UserID: 1}
+	shared := workspace.Caller{UserID: 1, WorkspaceID: 20}
+	other := workspace.Caller{UserID: 2, WorkspaceID: 20}
+
+	generation := index.currentGeneration()
+	index.set(personal, generation, cachedMember{workspaceID: 10, role: workspace.RoleOwner})
+	index.set(shared, generation, cachedMember{workspaceID: 20, role: workspace.RoleExecutor})
+	index.set(other, generation, cachedMember{workspaceID: 20, role: workspace.RoleViewer})
+
+	index.evict(20, 1)
+
+	if _, ok := index.get(shared); ok {
+		t.Error("Evicting a membership should drop the cached role")
+	}
+	if _, ok := index.get(personal); !ok {
+		t.Error("Evicting a membership should not touch the user's other workspaces")
+	}
+	if _, ok := index.get(other); !ok {
+		t.Error("Evicting a membership should not touch other members")
+	}
+
+	// A role loaded before the change must not repopulate the cache.
+	index.set(shared, generation, cachedMember{workspaceID: 20, role: workspace.RoleExecutor})
+	if _, ok := index.get(shared); ok {
+		t.Error("Role loaded before eviction should not be cached")
+	}
+
+	index.evictAll()
+	if _, ok := index.get(personal); ok {
+		t.Error("Expected no cached roles after evicting all")
+	}
+}
@@ -4,16 +4,27 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/parser"
+	"go/scanner"
 	"go/token"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
 const wasmTemplate = `package main
@@ -41,20 +52,74 @@ func main() {
 type Compiler struct {
 	templateDir string
 	tempBaseDir string
+	// cacheDir holds compiled binaries named by the hash of everything that
+	// goes into a build. Caching is disabled when it is empty.
+	cacheDir string
+	// cacheMaxBytes caps the size of the cached binaries; the least recently
+	// used are removed first. Zero means no cap.
+	cacheMaxBytes    int64
+	toolchainVersion func() (string, error)
+	builds           singleflight.Group
+	pruneMu          sync.Mutex
 }
 
-func NewCompiler(templateDir, tempBaseDir string) *Compiler {
+func NewCompiler(templateDir, tempBaseDir, cacheDir string) *Compiler {
 	return &Compiler{
-		templateDir: templateDir,
-		tempBaseDir: tempBaseDir,
+		templateDir:      templateDir,
+		tempBaseDir:      tempBaseDir,
+		cacheDir:         cacheDir,
+		toolchainVersion: sync.OnceValues(tinygoVersion),
 	}
 }
 
 func (c *Compiler) CompileGoToWasm(sourceCode, ruleName string) ([]byte, error) {
 	if err := c.validateGoCode(sourceCode); err != nil {
-		return nil, fmt.Errorf("code validation failed: %w", err)
+		return nil, err
+	}
+
+	if c.cacheDir == "" {
+		return c.build(sourceCode)
+	}
+
+	key, err := c.buildKey(sourceCode)
+	if err != nil {
+		return c.build(sourceCode)
+	}
+	if wasmBytes, ok := c.readCache(key); ok {
+		return wasmBytes, nil
 	}
 
+	// Identical builds that arrive while one is running share its result.
+	result, err, _ := c.builds.Do(key, func() (any, error) {
+		if wasmBytes, ok := c.readCache(key); ok {
+			return wasmBytes, nil
+		}
+		wasmBytes, err := c.build(sourceCode)
+		if err != nil {
+			return nil, err
+		}
+		c.writeCache(key, wasmBytes)
+		return wasmBytes, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]byte), nil
+}
+
+// CachedWasm returns the binary of an earlier identical build, if there is one.
+func (c *Compiler) CachedWasm(sourceCode string) ([]byte, bool) {
+	if c.cacheDir == "" {
+		return nil, false
+	}
+	key, err := c.buildKey(sourceCode)
+	if err != nil {
+		return nil, false
+	}
+	return c.readCache(key)
+}
+
+func (c *Compiler) build(sourceCode string) ([]byte, error) {
 	tempDir, err := c.createTempDir()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp dir: %w", err)
@@ -71,7 +136,7 @@ func (c *Compiler) CompileGoToWasm(sourceCode, ruleName string) ([]byte, error)
 
 	wasmFile := filepath.Join(tempDir, "main.wasm")
 	if err := c.compileWithTinyGo(tempDir, wasmFile); err != nil {
-		return nil, fmt.Errorf("compilation failed: %w", err)
+		return nil, err
 	}
 
 	wasmBytes, err := os.ReadFile(wasmFile)
@@ -82,6 +147,163 @@ func (c *Compiler) CompileGoToWasm(sourceCode, ruleName string) ([]byte, error)
 	return wasmBytes, nil
 }
 
+// buildKey hashes the rule source together with the build template and the
+// TinyGo version, so a change to any of them produces a new cache entry. The
+// key is the hash of the template and toolchain, which names the directory of
+// the entries built with them, followed by the hash of the source.
+func (c *Compiler) buildKey(sourceCode string) (string, error) {
+	version, err := c.toolchainVersion()
+	if err != nil {
+		return "", err
+	}
+
+	toolchain := sha256.New()
+	fmt.Fprintf(toolchain, "tinygo %s\n", version)
+	if err := hashTemplateDir(toolchain, c.templateDir); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(toolchain, "wrapper %d\n%s\n", len(wasmTemplate), wasmTemplate)
+	generation := hex.EncodeToString(toolchain.Sum(nil))[:16]
+
+	source := sha256.New()
+	fmt.Fprintf(source, "source %d\n%s", len(sourceCode), sourceCode)
+	return generation + "/" + hex.EncodeToString(source.Sum(nil)), nil
+}
+
+func hashTemplateDir(w io.Writer, dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "file %s %d\n", filepath.ToSlash(rel), len(content))
+		_, err = w.Write(content)
+		return err
+	})
+}
+
+func (c *Compiler) cachePath(key string) string {
+	return filepath.Join(c.cacheDir, filepath.FromSlash(key)+".wasm")
+}
+
+// readCache returns a cached binary and marks it as recently used.
+func (c *Compiler) readCache(key string) ([]byte, bool) {
+	path := c.cachePath(key)
+	wasmBytes, err := os.ReadFile(path)
+	if err != nil || len(wasmBytes) == 0 {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return wasmBytes, true
+}
+
+// writeCache stores the binary through a temporary file and a rename, so
+// concurrent readers never see a partially written entry, then prunes the
+// cache. Failures only cost a rebuild later and are not reported.
+func (c *Compiler) writeCache(key string, wasmBytes []byte) {
+	path := c.cachePath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(wasmBytes); err != nil {
+		tmp.Close()
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		return
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return
+	}
+	c.pruneCache(filepath.Dir(path))
+}
+
+// staleCacheEntry matches what the cache keeps in its directory: the
+// directories of entries built with a template and toolchain, and entries
+// written before they had directories.
+var staleCacheEntry = regexp.MustCompile(`^([0-9a-f]{16}|[0-9a-f]{64}\.wasm)$`)
+
+// pruneCache removes the entries built with other templates or toolchains
+// than current, the directory of the entries built with the current ones,
+// since they are never read again. It then removes the least recently used
+// entries of current until they fit in cacheMaxBytes.
+func (c *Compiler) pruneCache(current string) {
+	c.pruneMu.Lock()
+	defer c.pruneMu.Unlock()
+
+	entries, err := os.ReadDir(c.cacheDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		path := filepath.Join(c.cacheDir, entry.Name())
+		if path != current && staleCacheEntry.MatchString(entry.Name()) {
+			os.RemoveAll(path)
+		}
+	}
+	if c.cacheMaxBytes <= 0 {
+		return
+	}
+
+	entries, err = os.ReadDir(current)
+	if err != nil {
+		return
+	}
+	type cached struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cached
+	var total int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !strings.HasSuffix(entry.Name(), ".wasm") {
+			continue
+		}
+		files = append(files, cached{filepath.Join(current, entry.Name()), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+	slices.SortFunc(files, func(a, b cached) int { return a.modTime.Compare(b.modTime) })
+	for _, file := range files {
+		if total <= c.cacheMaxBytes {
+			break
+		}
+		if os.Remove(file.path) == nil {
+			total -= file.size
+		}
+	}
+}
+
+func tinygoVersion() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "tinygo", "version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get tinygo version: %w", err)
+	}
+	version := strings.TrimSpace(string(out))
+	if version == "" {
+		return "", errors.New("empty tinygo version")
+	}
+	return version, nil
+}
+
 func (c *Compiler) createTempDir() (string, error) {
 	hash := make([]byte, 16)
 	if _, err := rand.Read(hash); err != nil {
@@ -182,31 +404,48 @@ func (c *Compiler) compileWithTinyGo(tempDir, wasmFile string) error {
 	cmd.Stderr = &stderr
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("tinygo compilation failed: %s", stderr.String())
+		return &Error{
+			Code:        CodeCompileError,
+			Message:     "tinygo compilation failed",
+			Diagnostics: tinygoDiagnostics(stderr.String()),
+			Err:         errors.New(stderr.String()),
+		}
 	}
 
 	return nil
 }
 
-func (c *Compiler) validateGoCode(sourceCode string) error {
-	tempFile := `package main
+// validatePrefix is put before the source code to parse it as a file.
+const validatePrefix = `package main
+
+`
 
-` + sourceCode
+func (c *Compiler) validateGoCode(sourceCode string) error {
+	tempFile := validatePrefix + sourceCode
 
 	fset := token.NewFileSet()
 	node, err := parser.ParseFile(fset, "main.go", tempFile, parser.ParseComments)
 	if err != nil {
-		return fmt.Errorf("invalid Go syntax: %w", err)
+		var diagnostics []Diagnostic
+		var list scanner.ErrorList
+		if errors.As(err, &list) {
+			for _, e := range list {
+				diagnostics = append(diagnostics, sourceDiagnostic(e.Pos.Line, e.Pos.Column, e.Msg, validatePrefix))
+			}
+		}
+		return &Error{Code: CodeCompileError, Message: "invalid Go syntax", Diagnostics: diagnostics, Err: err}
 	}
 
 	hasTransform := false
 	var validationErr error
+	var validationPos token.Position
 	ast.Inspect(node, func(n ast.Node) bool {
 		if fn, ok := n.(*ast.FuncDecl); ok {
 			if fn.Name.Name == "Transform" {
 				hasTransform = true
 				if err := c.validateTransformSignature(fn); err != nil {
 					validationErr = err
+					validationPos = fset.Position(fn.Pos())
 					return false
 				}
 			}
@@ -215,16 +454,47 @@ func (c *Compiler) validateGoCode(sourceCode string) error {
 	})
 
 	if !hasTransform {
-		return fmt.Errorf("transform function not found")
+		return &Error{Code: CodeCompileError, Message: "code validation failed", Err: fmt.Errorf("transform function not found")}
 	}
 
 	if validationErr != nil {
-		return validationErr
+		return &Error{
+			Code:        CodeCompileError,
+			Message:     "code validation failed",
+			Diagnostics: []Diagnostic{sourceDiagnostic(validationPos.Line, validationPos.Column, validationErr.Error(), validatePrefix)},
+			Err:         validationErr,
+		}
 	}
 
 	return nil
 }
 
+// tinygoDiagnostic matches a problem TinyGo reports in main.go.
+var tinygoDiagnostic = regexp.MustCompile(`(?m)main\.go:(\d+):(\d+): (.+)$`)
+
+// tinygoDiagnostics picks the problems in main.go out of TinyGo's output.
+func tinygoDiagnostics(output string) []Diagnostic {
+	prefix, _, _ := strings.Cut(wasmTemplate, "%s")
+	var diagnostics []Diagnostic
+	for _, match := range tinygoDiagnostic.FindAllStringSubmatch(output, -1) {
+		line, _ := strconv.Atoi(match[1])
+		column, _ := strconv.Atoi(match[2])
+		diagnostics = append(diagnostics, sourceDiagnostic(line, column, match[3], prefix))
+	}
+	return diagnostics
+}
+
+// sourceDiagnostic turns a position in a file that holds the source code
+// after prefix into a position in the source code. Positions within prefix
+// are left unknown.
+func sourceDiagnostic(line, column int, message, prefix string) Diagnostic {
+	line -= strings.Count(prefix, "\n")
+	if line < 1 {
+		return Diagnostic{Message: message}
+	}
+	return Diagnostic{Line: line, Column: column, Message: message}
+}
+
 func (c *Compiler) validateTransformSignature(fn *ast.FuncDecl) error {
 	if fn.Type.Params.NumFields() != 1 {
 		return fmt.Errorf("transform must have exactly 1 parameter")
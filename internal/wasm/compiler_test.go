@@ -1,17 +1,22 @@
 package wasm
 
 import (
+	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestCompiler_ValidateGoCode(t *testing.T) {
-	compiler := NewCompiler("wasm-template", "test-temp")
+	compiler := NewCompiler("wasm-template", "test-temp", "")
 
 	tests := []struct {
 		name    string
@@ -95,8 +100,36 @@ func Transform(in map[string]any) map[string]any {
 	}
 }
 
+func TestCompiler_ValidateGoCodeDiagnostics(t *testing.T) {
+	compiler := NewCompiler("wasm-template", "test-temp", "")
+
+	err := compiler.validateGoCode("func Transform(input []byte) []byte {\n\treturn input +\n}")
+	require.Error(t, err)
+	assert.Equal(t, CodeCompileError, ErrorCodeOf(err))
+	diagnostics := DiagnosticsOf(err)
+	require.NotEmpty(t, diagnostics)
+	assert.Equal(t, 3, diagnostics[0].Line, "lines must count from the start of the rule's source")
+
+	err = compiler.validateGoCode("import \"strings\"\n\nfunc Transform(input string) []byte {\n\treturn nil\n}")
+	require.Error(t, err)
+	assert.Equal(t, CodeCompileError, ErrorCodeOf(err))
+	assert.Equal(t, []Diagnostic{{Line: 3, Column: 1, Message: "parameter must be []byte"}}, DiagnosticsOf(err))
+}
+
+func TestTinygoDiagnostics(t *testing.T) {
+	output := `# command-line-arguments
+/tmp/wasmorph-build-1/main.go:9:9: undefined: missing
+/tmp/wasmorph-build-1/main.go:3:2: could not import github.com/extism/go-pdk
+`
+	assert.Equal(t, []Diagnostic{
+		{Line: 2, Column: 9, Message: "undefined: missing"},
+		{Message: "could not import github.com/extism/go-pdk"},
+	}, tinygoDiagnostics(output))
+	assert.Empty(t, tinygoDiagnostics("error: unable to find tinygo root"))
+}
+
 func TestCompiler_ValidateTransformSignature(t *testing.T) {
-	compiler := NewCompiler("wasm-template", "test-temp")
+	compiler := NewCompiler("wasm-template", "test-temp", "")
 
 	tests := []struct {
 		name    string
@@ -176,7 +209,7 @@ func TestCompiler_ValidateTransformSignature(t *testing.T) {
 }
 
 func TestCompiler_IsByteSlice(t *testing.T) {
-	compiler := NewCompiler("wasm-template", "test-temp")
+	compiler := NewCompiler("wasm-template", "test-temp", "")
 
 	tests := []struct {
 		name     string
@@ -215,3 +248,127 @@ func TestCompiler_IsByteSlice(t *testing.T) {
 		})
 	}
 }
+
+func newCachingCompiler(t *testing.T) *Compiler {
+	t.Helper()
+
+	templateDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(templateDir, "go.mod"), []byte("module transform\n"), 0644))
+
+	compiler := NewCompiler(templateDir, t.TempDir(), t.TempDir())
+	compiler.toolchainVersion = func() (string, error) {
+		return "tinygo version 0.37.0", nil
+	}
+	return compiler
+}
+
+func TestCompiler_BuildKey(t *testing.T) {
+	compiler := newCachingCompiler(t)
+	source := "func Transform(input []byte) []byte { return input }"
+
+	key, err := compiler.buildKey(source)
+	require.NoError(t, err)
+
+	again, err := compiler.buildKey(source)
+	require.NoError(t, err)
+	assert.Equal(t, key, again)
+
+	otherSource, err := compiler.buildKey(source + "\n")
+	require.NoError(t, err)
+	assert.NotEqual(t, key, otherSource)
+
+	require.NoError(t, os.WriteFile(filepath.Join(compiler.templateDir, "go.mod"), []byte("module changed\n"), 0644))
+	otherTemplate, err := compiler.buildKey(source)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, otherTemplate)
+
+	compiler.toolchainVersion = func() (string, error) {
+		return "tinygo version 0.38.0", nil
+	}
+	otherToolchain, err := compiler.buildKey(source)
+	require.NoError(t, err)
+	assert.NotEqual(t, otherTemplate, otherToolchain)
+}
+
+func TestCompiler_CachedWasm(t *testing.T) {
+	compiler := newCachingCompiler(t)
+	source := "func Transform(input []byte) []byte { return input }"
+
+	_, ok := compiler.CachedWasm(source)
+	assert.False(t, ok)
+
+	key, err := compiler.buildKey(source)
+	require.NoError(t, err)
+	compiler.writeCache(key, []byte("\x00asm"))
+
+	wasmBytes, ok := compiler.CachedWasm(source)
+	require.True(t, ok)
+	assert.Equal(t, []byte("\x00asm"), wasmBytes)
+
+	// A hit skips TinyGo entirely, so this works without it installed.
+	wasmBytes, err = compiler.CompileGoToWasm(source, "any-name")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("\x00asm"), wasmBytes)
+
+	_, ok = NewCompiler(compiler.templateDir, t.TempDir(), "").CachedWasm(source)
+	assert.False(t, ok)
+}
+
+func TestCompiler_CachePrunesOtherToolchains(t *testing.T) {
+	compiler := newCachingCompiler(t)
+	source := "func Transform(input []byte) []byte { return input }"
+
+	// An entry from before entries had directories, and a file that is not
+	// the cache's.
+	legacy := filepath.Join(compiler.cacheDir, strings.Repeat("ab", 32)+".wasm")
+	require.NoError(t, os.WriteFile(legacy, []byte("\x00asm"), 0644))
+	unrelated := filepath.Join(compiler.cacheDir, "notes.txt")
+	require.NoError(t, os.WriteFile(unrelated, []byte("keep"), 0644))
+
+	oldKey, err := compiler.buildKey(source)
+	require.NoError(t, err)
+	compiler.writeCache(oldKey, []byte("\x00asm"))
+
+	compiler.toolchainVersion = func() (string, error) {
+		return "tinygo version 0.38.0", nil
+	}
+	_, ok := compiler.CachedWasm(source)
+	assert.False(t, ok)
+
+	newKey, err := compiler.buildKey(source)
+	require.NoError(t, err)
+	compiler.writeCache(newKey, []byte("\x00asm"))
+
+	assert.NoFileExists(t, compiler.cachePath(oldKey), "entries of an older toolchain must be removed")
+	assert.NoDirExists(t, filepath.Dir(compiler.cachePath(oldKey)))
+	assert.NoFileExists(t, legacy)
+	assert.FileExists(t, unrelated)
+	assert.FileExists(t, compiler.cachePath(newKey))
+}
+
+func TestCompiler_CacheSizeLimit(t *testing.T) {
+	compiler := newCachingCompiler(t)
+	compiler.cacheMaxBytes = 8
+
+	keys := make([]string, 3)
+	for i := range keys {
+		var err error
+		keys[i], err = compiler.buildKey(fmt.Sprintf("func Transform(input []byte) []byte { return nil } // %d", i))
+		require.NoError(t, err)
+	}
+
+	compiler.writeCache(keys[0], []byte("aaaa"))
+	compiler.writeCache(keys[1], []byte("bbbb"))
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(compiler.cachePath(keys[0]), past, past))
+	require.NoError(t, os.Chtimes(compiler.cachePath(keys[1]), past.Add(time.Minute), past.Add(time.Minute)))
+
+	// Reading an entry makes it the most recently used.
+	_, ok := compiler.readCache(keys[0])
+	require.True(t, ok)
+
+	compiler.writeCache(keys[2], []byte("cccc"))
+	assert.FileExists(t, compiler.cachePath(keys[0]))
+	assert.NoFileExists(t, compiler.cachePath(keys[1]), "the least recently used entry must be evicted")
+	assert.FileExists(t, compiler.cachePath(keys[2]))
+}
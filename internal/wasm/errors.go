@@ -0,0 +1,112 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrorCode classifies the errors of the Service for clients, which may
+// branch on it. Codes are part of the API and must not change.
+type ErrorCode string
+
+const (
+	CodeNotFound   ErrorCode = "not_found"
+	CodeValidation ErrorCode = "validation_error"
+	// CodeCompileError means the rule's source code does not build. The
+	// error carries Diagnostics where they could be located.
+	CodeCompileError ErrorCode = "compile_error"
+	// CodeExecutionTrap means the rule failed while running, for example by
+	// panicking or by exceeding its output limit.
+	CodeExecutionTrap ErrorCode = "execution_trap"
+	// CodeMemoryLimit means the rule ran out of memory under its page limit.
+	CodeMemoryLimit ErrorCode = "memory_limit_exceeded"
+	CodeTimeout     ErrorCode = "timeout"
+	// CodeCancelled means the client gave up on the request, usually by
+	// disconnecting, before it finished.
+	CodeCancelled ErrorCode = "cancelled"
+	CodeConflict  ErrorCode = "conflict"
+	// CodeVersionMismatch means an update was made against a version of the
+	// rule that is no longer current.
+	CodeVersionMismatch ErrorCode = "version_mismatch"
+	CodeForbidden       ErrorCode = "forbidden"
+	CodeUnauthorized    ErrorCode = "unauthorized"
+	CodeUnavailable     ErrorCode = "unavailable"
+	CodeInternal        ErrorCode = "internal"
+)
+
+// Error is an error with a code. Errors returned by the Service that wrap no
+// Error are internal.
+type Error struct {
+	Code    ErrorCode
+	Message string
+	// Diagnostics locate compile errors in the rule's source code.
+	Diagnostics []Diagnostic
+	// Err is the underlying cause, if any.
+	Err error
+}
+
+// Diagnostic is a problem found at a position of a rule's source code. Lines
+// and columns start at 1; they are 0 when unknown.
+type Diagnostic struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(code ErrorCode, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func invalidf(format string, args ...any) error {
+	return newError(CodeValidation, format, args...)
+}
+
+func notFoundf(format string, args ...any) error {
+	return newError(CodeNotFound, format, args...)
+}
+
+// contextError types err, the error of a done context: a passed deadline is a
+// timeout and anything else a cancellation.
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &Error{Code: CodeTimeout, Message: "deadline exceeded", Err: err}
+	}
+	return &Error{Code: CodeCancelled, Message: "request cancelled", Err: err}
+}
+
+// ErrorCodeOf returns the code of the first Error in err's chain. Context
+// errors that reached the caller untyped, for example through a database
+// query, are timeouts or cancellations; anything else is CodeInternal.
+func ErrorCodeOf(err error) ErrorCode {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e.Code
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return CodeCancelled
+	}
+	return CodeInternal
+}
+
+// DiagnosticsOf returns the diagnostics of a compile error in err's chain.
+func DiagnosticsOf(err error) []Diagnostic {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Diagnostics
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCodeOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{name: "sentinel", err: ErrRuleNotFound, want: CodeNotFound},
+		{name: "wrapped sentinel", err: fmt.Errorf("%w: no deleted rule named x", ErrRuleNotFound), want: CodeNotFound},
+		{name: "validation", err: invalidf("alias must not start with a digit"), want: CodeValidation},
+		{name: "timeout", err: fmt.Errorf("execution failed: %w", ErrExecutionTimeout), want: CodeTimeout},
+		{name: "memory limit", err: ErrMemoryLimitExceeded, want: CodeMemoryLimit},
+		{name: "output limit", err: ErrOutputLimitExceeded, want: CodeExecutionTrap},
+		{name: "cancelled", err: contextError(context.Canceled), want: CodeCancelled},
+		{name: "deadline", err: contextError(context.DeadlineExceeded), want: CodeTimeout},
+		{name: "untyped cancellation", err: fmt.Errorf("failed to load rule: %w", context.Canceled), want: CodeCancelled},
+		{name: "uncoded", err: errors.New("connection refused"), want: CodeInternal},
+		{name: "uncoded wrapped", err: fmt.Errorf("failed to load rule: %w", errors.New("connection refused")), want: CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ErrorCodeOf(tt.err))
+		})
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := &Error{Code: CodeExecutionTrap, Message: "transform execution failed", Err: errors.New("unreachable")}
+	assert.Equal(t, "transform execution failed: unreachable", err.Error())
+	assert.Equal(t, "rule not found", ErrRuleNotFound.Error())
+	assert.True(t, errors.Is(fmt.Errorf("execution failed: %w", err), err))
+}
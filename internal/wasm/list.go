@@ -0,0 +1,312 @@
+package wasm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/Gmacem/wasmorph/internal/workspace"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	DefaultRulePageSize = 100
+	MaxRulePageSize     = 1000
+)
+
+var ErrInvalidCursor = newError(CodeValidation, "invalid cursor")
+
+// RuleSort is the order ListRules returns rules in.
+type RuleSort string
+
+const (
+	// SortCreated lists the newest rules first.
+	SortCreated RuleSort = "created_at"
+	// SortUpdated lists the most recently updated rules first.
+	SortUpdated RuleSort = "updated_at"
+	// SortName lists rules by name.
+	SortName RuleSort = "name"
+	// sortDeleted lists the most recently deleted rules first. It is the only
+	// order of deleted rules.
+	sortDeleted RuleSort = "deleted_at"
+)
+
+// ParseRuleSort returns the sort order named by value, defaulting to
+// SortCreated.
+func ParseRuleSort(value string) (RuleSort, error) {
+	switch sort := RuleSort(value); sort {
+	case "":
+		return SortCreated, nil
+	case SortCreated, SortUpdated, SortName:
+		return sort, nil
+	default:
+		return "", invalidf("sort must be one of %s, %s or %s", SortCreated, SortUpdated, SortName)
+	}
+}
+
+// RuleQuery selects a page of rules. Zero values match every rule.
+type RuleQuery struct {
+	Sort RuleSort
+	// Cursor continues a listing from the NextCursor of its previous page. It
+	// is only valid with the same Sort.
+	Cursor string
+	Limit  int32
+	// Name matches rules whose name contains it, ignoring case.
+	Name string
+	// Source is a full-text search over the rules' source code.
+	Source       string
+	UpdatedSince time.Time
+	// Tags and Labels match rules that have all of them.
+	Tags   []string
+	Labels map[string]string
+	// Allowed, when set, leaves out the rules it returns false for. Pages are
+	// still filled up to Limit, unless too few of the rules fetched for one
+	// are allowed: the page then comes short with a NextCursor.
+	Allowed func(name string) bool
+	// Deleted lists deleted rules instead of active ones, most recently
+	// deleted first. Sort is ignored.
+	Deleted bool
+}
+
+type RulePage struct {
+	Rules []sql.ListRulesByWorkspaceRow
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// ruleCursor is the position after the last rule of a page, in the sort
+// order of the listing.
+type ruleCursor struct {
+	Sort RuleSort  `json:"s"`
+	Time time.Time `json:"t,omitempty"`
+	ID   int32     `json:"i,omitempty"`
+	Name string    `json:"n,omitempty"`
+}
+
+func cursorAfter(sort RuleSort, rule sql.ListRulesByWorkspaceRow) ruleCursor {
+	switch sort {
+	case SortName:
+		return ruleCursor{Sort: sort, Name: rule.Name}
+	case sortDeleted:
+		return ruleCursor{Sort: sort, Time: rule.DeletedAt.Time, ID: rule.ID}
+	case SortUpdated:
+		return ruleCursor{Sort: sort, Time: rule.UpdatedAt.Time, ID: rule.ID}
+	default:
+		return ruleCursor{Sort: sort, Time: rule.CreatedAt.Time, ID: rule.ID}
+	}
+}
+
+func (c ruleCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string, sort RuleSort) (*ruleCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor ruleCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Sort != sort {
+		return nil, fmt.Errorf("%w: it continues a listing sorted by %s", ErrInvalidCursor, cursor.Sort)
+	}
+	return &cursor, nil
+}
+
+// ListRules returns a page of the active, or with query.Deleted the deleted,
+// rules in the caller's workspace.
+func (s *Service) ListRules(ctx context.Context, caller workspace.Caller, query RuleQuery) (RulePage, error) {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleViewer)
+	if err != nil {
+		return RulePage{}, err
+	}
+
+	if query.Deleted {
+		query.Sort = sortDeleted
+	}
+	if query.Sort == "" {
+		query.Sort = SortCreated
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultRulePageSize
+	}
+	if query.Limit > MaxRulePageSize {
+		query.Limit = MaxRulePageSize
+	}
+	cursor, err := decodeCursor(query.Cursor, query.Sort)
+	if err != nil {
+		return RulePage{}, err
+	}
+
+	return collectRulePage(query, cursor, func(cursor *ruleCursor, limit int32) ([]sql.ListRulesByWorkspaceRow, error) {
+		rules, err := s.listRulesAfter(ctx, workspaceID, query, cursor, limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list rules: %w", err)
+		}
+		return rules, nil
+	})
+}
+
+// maxRuleListBatches bounds the queries made for one page when Allowed leaves
+// out most rules.
+const maxRuleListBatches = 10
+
+// collectRulePage fills a page from the batches that fetch returns after
+// cursor. Rules left out by query.Allowed are fetched past, for at most
+// maxRuleListBatches batches; a page cut short there holds fewer rules than
+// query.Limit and continues after the last rule fetched.
+func collectRulePage(query RuleQuery, cursor *ruleCursor, fetch func(cursor *ruleCursor, limit int32) ([]sql.ListRulesByWorkspaceRow, error)) (RulePage, error) {
+	// One rule more than the page holds tells whether there is a next page.
+	want := int(query.Limit) + 1
+	rules := []sql.ListRulesByWorkspaceRow{}
+	cutShort := false
+	for batches := 0; len(rules) < want; batches++ {
+		if batches == maxRuleListBatches {
+			cutShort = true
+			break
+		}
+		batch, err := fetch(cursor, query.Limit+1)
+		if err != nil {
+			return RulePage{}, err
+		}
+		for _, rule := range batch {
+			next := cursorAfter(query.Sort, rule)
+			cursor = &next
+			if query.Allowed == nil || query.Allowed(rule.Name) {
+				rules = append(rules, rule)
+			}
+			if len(rules) == want {
+				break
+			}
+		}
+		if len(batch) < int(query.Limit)+1 {
+			break
+		}
+	}
+
+	page := RulePage{Rules: rules}
+	switch {
+	case len(rules) == want:
+		page.Rules = rules[:query.Limit]
+		page.NextCursor = cursorAfter(query.Sort, page.Rules[query.Limit-1]).encode()
+	case cutShort:
+		page.NextCursor = cursor.encode()
+	}
+	return page, nil
+}
+
+// listRulesAfter returns up to limit rules that match query and follow cursor
+// in the query's sort order.
+func (s *Service) listRulesAfter(ctx context.Context, workspaceID int32, query RuleQuery, cursor *ruleCursor, limit int32) ([]sql.ListRulesByWorkspaceRow, error) {
+	nameQuery := pgtype.Text{String: escapeLike(query.Name), Valid: query.Name != ""}
+	sourceQuery := pgtype.Text{String: query.Source, Valid: query.Source != ""}
+	updatedSince := pgtype.Timestamptz{Time: query.UpdatedSince, Valid: !query.UpdatedSince.IsZero()}
+	var tags []string
+	if len(query.Tags) > 0 {
+		tags = query.Tags
+	}
+	var labels json.RawMessage
+	if len(query.Labels) > 0 {
+		labels = labelsJSON(query.Labels)
+	}
+
+	var afterID pgtype.Int4
+	var afterTime pgtype.Timestamp
+	var afterName pgtype.Text
+	if cursor != nil {
+		afterID = pgtype.Int4{Int32: cursor.ID, Valid: true}
+		afterTime = pgtype.Timestamp{Time: cursor.Time, Valid: true}
+		afterName = pgtype.Text{String: cursor.Name, Valid: true}
+	}
+
+	var rules []sql.ListRulesByWorkspaceRow
+	switch query.Sort {
+	case sortDeleted:
+		rows, err := s.queries.ListDeletedRulesPage(ctx, sql.ListDeletedRulesPageParams{
+			WorkspaceID:  workspaceID,
+			NameQuery:    nameQuery,
+			SourceQuery:  sourceQuery,
+			UpdatedSince: updatedSince,
+			Tags:         tags,
+			Labels:       labels,
+			AfterID:      afterID,
+			AfterTime:    afterTime,
+			MaxResults:   limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			rules = append(rules, sql.ListRulesByWorkspaceRow(row))
+		}
+	case SortName:
+		rows, err := s.queries.ListRulesPageByName(ctx, sql.ListRulesPageByNameParams{
+			WorkspaceID:  workspaceID,
+			NameQuery:    nameQuery,
+			SourceQuery:  sourceQuery,
+			UpdatedSince: updatedSince,
+			Tags:         tags,
+			Labels:       labels,
+			AfterName:    afterName,
+			MaxResults:   limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			rules = append(rules, sql.ListRulesByWorkspaceRow(row))
+		}
+	case SortUpdated:
+		rows, err := s.queries.ListRulesPageByUpdated(ctx, sql.ListRulesPageByUpdatedParams{
+			WorkspaceID:  workspaceID,
+			NameQuery:    nameQuery,
+			SourceQuery:  sourceQuery,
+			UpdatedSince: updatedSince,
+			Tags:         tags,
+			Labels:       labels,
+			AfterID:      afterID,
+			AfterTime:    afterTime,
+			MaxResults:   limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			rules = append(rules, sql.ListRulesByWorkspaceRow(row))
+		}
+	default:
+		rows, err := s.queries.ListRulesPageByCreated(ctx, sql.ListRulesPageByCreatedParams{
+			WorkspaceID:  workspaceID,
+			NameQuery:    nameQuery,
+			SourceQuery:  sourceQuery,
+			UpdatedSince: updatedSince,
+			Tags:         tags,
+			Labels:       labels,
+			AfterID:      afterID,
+			AfterTime:    afterTime,
+			MaxResults:   limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			rules = append(rules, sql.ListRulesByWorkspaceRow(row))
+		}
+	}
+	return rules, nil
+}
+
+// escapeLike makes value match literally inside an ILIKE pattern.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
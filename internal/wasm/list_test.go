@@ -0,0 +1,111 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleCursor(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC)
+	rule := sql.ListRulesByWorkspaceRow{
+		ID:        7,
+		Name:      "billing-eu",
+		CreatedAt: pgtype.Timestamp{Time: created, Valid: true},
+		UpdatedAt: pgtype.Timestamp{Time: created.Add(time.Hour), Valid: true},
+		DeletedAt: pgtype.Timestamp{Time: created.Add(2 * time.Hour), Valid: true},
+	}
+
+	for _, sort := range []RuleSort{SortCreated, SortUpdated, SortName, sortDeleted} {
+		t.Run(string(sort), func(t *testing.T) {
+			want := cursorAfter(sort, rule)
+			got, err := decodeCursor(want.encode(), sort)
+			require.NoError(t, err)
+			assert.True(t, want.Time.Equal(got.Time))
+			assert.Equal(t, want.ID, got.ID)
+			assert.Equal(t, want.Name, got.Name)
+		})
+	}
+
+	cursor, err := decodeCursor("", SortName)
+	assert.NoError(t, err)
+	assert.Nil(t, cursor)
+
+	_, err = decodeCursor("not a cursor!", SortName)
+	assert.True(t, errors.Is(err, ErrInvalidCursor))
+
+	_, err = decodeCursor(cursorAfter(SortName, rule).encode(), SortCreated)
+	assert.True(t, errors.Is(err, ErrInvalidCursor), "a cursor must not continue a listing in another order")
+
+	_, err = decodeCursor(cursorAfter(SortCreated, rule).encode(), sortDeleted)
+	assert.True(t, errors.Is(err, ErrInvalidCursor), "a cursor over active rules must not continue a listing of deleted ones")
+}
+
+func TestParseRuleSort(t *testing.T) {
+	sort, err := ParseRuleSort("")
+	require.NoError(t, err)
+	assert.Equal(t, SortCreated, sort)
+
+	sort, err = ParseRuleSort("name")
+	require.NoError(t, err)
+	assert.Equal(t, SortName, sort)
+
+	_, err = ParseRuleSort("size")
+	assert.Error(t, err)
+}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, `100\%\_done\\`, escapeLike(`100%_done\`))
+	assert.Equal(t, "billing", escapeLike("billing"))
+}
+
+func TestCollectRulePage(t *testing.T) {
+	var all []sql.ListRulesByWorkspaceRow
+	for i := 0; i < 100; i++ {
+		all = append(all, sql.ListRulesByWorkspaceRow{Name: fmt.Sprintf("other-%03d", i)})
+	}
+	all = append(all, sql.ListRulesByWorkspaceRow{Name: "zz-billing"})
+
+	queries := 0
+	fetch := func(cursor *ruleCursor, limit int32) ([]sql.ListRulesByWorkspaceRow, error) {
+		queries++
+		var batch []sql.ListRulesByWorkspaceRow
+		for _, rule := range all {
+			if (cursor == nil || rule.Name > cursor.Name) && len(batch) < int(limit) {
+				batch = append(batch, rule)
+			}
+		}
+		return batch, nil
+	}
+	query := RuleQuery{
+		Sort:    SortName,
+		Limit:   2,
+		Allowed: func(name string) bool { return strings.HasPrefix(name, "zz-") },
+	}
+
+	var found []string
+	var cursor *ruleCursor
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 10, "listing did not finish")
+		queries = 0
+		page, err := collectRulePage(query, cursor, fetch)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, queries, maxRuleListBatches)
+		for _, rule := range page.Rules {
+			found = append(found, rule.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor, err = decodeCursor(page.NextCursor, SortName)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"zz-billing"}, found)
+}
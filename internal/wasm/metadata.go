@@ -0,0 +1,92 @@
+package wasm
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	MaxDescriptionLength = 1024
+	MaxTags              = 32
+	MaxLabels            = 32
+	MaxLabelValueLength  = 256
+)
+
+// RuleMetadata describes what a rule is for. When a rule is saved, nil fields
+// keep the rule's current values; empty ones clear them.
+type RuleMetadata struct {
+	Description *string
+	Tags        []string
+	Labels      map[string]string
+}
+
+// empty reports whether m keeps every current value.
+func (m RuleMetadata) empty() bool {
+	return m.Description == nil && m.Tags == nil && m.Labels == nil
+}
+
+func (m RuleMetadata) validate() error {
+	if m.Description != nil && len(*m.Description) > MaxDescriptionLength {
+		return invalidf("description must be at most %d characters", MaxDescriptionLength)
+	}
+
+	if len(m.Tags) > MaxTags {
+		return invalidf("a rule may have at most %d tags", MaxTags)
+	}
+	for i, tag := range m.Tags {
+		if err := validateMetadataKey("tag", tag); err != nil {
+			return err
+		}
+		if slices.Contains(m.Tags[:i], tag) {
+			return invalidf("duplicate tag %q", tag)
+		}
+	}
+
+	if len(m.Labels) > MaxLabels {
+		return invalidf("a rule may have at most %d labels", MaxLabels)
+	}
+	for key, value := range m.Labels {
+		if err := validateMetadataKey("label key", key); err != nil {
+			return err
+		}
+		if len(value) > MaxLabelValueLength {
+			return invalidf("label %s must be at most %d characters", key, MaxLabelValueLength)
+		}
+	}
+	return nil
+}
+
+// validateMetadataKey checks a tag or label key. They are matched exactly
+// when filtering, so they are limited to characters that need no escaping in
+// a query string.
+func validateMetadataKey(kind, key string) error {
+	if key == "" || len(key) > 64 {
+		return invalidf("%s must be between 1 and 64 characters", kind)
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' || r == '/') {
+			return invalidf("%s may only contain letters, digits, '-', '_', '.' and '/'", kind)
+		}
+	}
+	return nil
+}
+
+// params returns the metadata as query arguments, null where it is kept.
+func (m RuleMetadata) params() (pgtype.Text, []string, json.RawMessage) {
+	var description pgtype.Text
+	if m.Description != nil {
+		description = pgtype.Text{String: *m.Description, Valid: true}
+	}
+	return description, m.Tags, labelsJSON(m.Labels)
+}
+
+// labelsJSON encodes labels as a JSON object, or returns nil for nil labels.
+func labelsJSON(labels map[string]string) json.RawMessage {
+	if labels == nil {
+		return nil
+	}
+	data, _ := json.Marshal(labels)
+	return data
+}
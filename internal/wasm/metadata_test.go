@@ -0,0 +1,64 @@
+package wasm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleMetadataValidate(t *testing.T) {
+	description := "Computes list prices"
+	longDescription := strings.Repeat("x", MaxDescriptionLength+1)
+	manyTags := make([]string, MaxTags+1)
+	for i := range manyTags {
+		manyTags[i] = "tag-" + strings.Repeat("x", i+1)
+	}
+
+	tests := []struct {
+		name     string
+		metadata RuleMetadata
+		wantErr  bool
+	}{
+		{name: "empty", metadata: RuleMetadata{}, wantErr: false},
+		{name: "full", metadata: RuleMetadata{
+			Description: &description,
+			Tags:        []string{"pricing", "eu.v2"},
+			Labels:      map[string]string{"team": "billing", "example.com/owner": "alice"},
+		}, wantErr: false},
+		{name: "long description", metadata: RuleMetadata{Description: &longDescription}, wantErr: true},
+		{name: "too many tags", metadata: RuleMetadata{Tags: manyTags}, wantErr: true},
+		{name: "empty tag", metadata: RuleMetadata{Tags: []string{""}}, wantErr: true},
+		{name: "tag with space", metadata: RuleMetadata{Tags: []string{"list prices"}}, wantErr: true},
+		{name: "duplicate tag", metadata: RuleMetadata{Tags: []string{"eu", "eu"}}, wantErr: true},
+		{name: "label key with equals", metadata: RuleMetadata{Labels: map[string]string{"a=b": "c"}}, wantErr: true},
+		{name: "long label value", metadata: RuleMetadata{Labels: map[string]string{"team": strings.Repeat("x", MaxLabelValueLength+1)}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.metadata.validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRuleMetadataParams(t *testing.T) {
+	assert.True(t, RuleMetadata{}.empty())
+	assert.False(t, RuleMetadata{Tags: []string{}}.empty(), "empty tags clear the rule's tags")
+
+	description, tags, labels := RuleMetadata{}.params()
+	assert.False(t, description.Valid)
+	assert.Nil(t, tags)
+	assert.Nil(t, labels, "nil labels must keep the rule's labels")
+
+	empty := ""
+	description, tags, labels = RuleMetadata{Description: &empty, Tags: []string{}, Labels: map[string]string{}}.params()
+	assert.True(t, description.Valid)
+	assert.NotNil(t, tags)
+	assert.JSONEq(t, `{}`, string(labels))
+}
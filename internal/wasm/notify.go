@@ -0,0 +1,119 @@
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/Gmacem/wasmorph/internal/workspace"
+)
+
+// ruleChangesChannel is the Postgres channel on which every replica announces
+// rule writes, so that all replicas drop their cached runtimes of the rule.
+const ruleChangesChannel = "wasmorph_rules"
+
+const (
+	listenRetryMin = 100 * time.Millisecond
+	listenRetryMax = 10 * time.Second
+)
+
+type ruleChange struct {
+	WorkspaceID int32  `json:"workspace_id"`
+	Name        string `json:"name"`
+}
+
+// publishRuleChange sends a rule change notification through q. Inside a
+// transaction it is delivered only when the transaction commits.
+func publishRuleChange(ctx context.Context, q *sql.Queries, workspaceID int32, name string) error {
+	payload, err := json.Marshal(ruleChange{WorkspaceID: workspaceID, Name: name})
+	if err != nil {
+		return err
+	}
+	if err := q.NotifyRuleChanged(ctx, string(payload)); err != nil {
+		return fmt.Errorf("failed to publish rule change: %w", err)
+	}
+	return nil
+}
+
+// ListenForRuleChanges evicts cached runtimes of rules changed by any replica,
+// including this one, and cached roles of changed memberships, until ctx is
+// done. It holds one connection of the pool and reconnects when that
+// connection is lost. Notifications sent while it was disconnected are lost,
+// so the whole cache is dropped after reconnecting, and roles and resolved
+// versions are not cached in the meantime.
+func (s *Service) ListenForRuleChanges(ctx context.Context) {
+	retry := listenRetryMin
+	for connected := false; ; {
+		err := s.listen(ctx, func() {
+			if connected {
+				s.index.evictAll(ctx)
+				s.members.evictAll()
+			}
+			connected = true
+			retry = listenRetryMin
+			s.listening.Store(true)
+		})
+		s.listening.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.Error("Rule change listener disconnected", "error", err, "retry_in", retry)
+		select {
+		case <-time.After(retry):
+		case <-ctx.Done():
+			return
+		}
+		retry = min(retry*2, listenRetryMax)
+	}
+}
+
+func (s *Service) listen(ctx context.Context, subscribed func()) error {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	// The connection stays subscribed, so it is never handed back to the pool.
+	pgConn := conn.Hijack()
+	defer pgConn.Close(context.Background())
+
+	for _, channel := range []string{ruleChangesChannel, workspace.MembershipChangesChannel} {
+		if _, err := pgConn.Exec(ctx, "LISTEN "+channel); err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+	}
+	subscribed()
+
+	for {
+		notification, err := pgConn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		if notification.Channel == workspace.MembershipChangesChannel {
+			s.handleMembershipChange(notification.Payload)
+		} else {
+			s.handleRuleChange(ctx, notification.Payload)
+		}
+	}
+}
+
+func (s *Service) handleRuleChange(ctx context.Context, payload string) {
+	var change ruleChange
+	if err := json.Unmarshal([]byte(payload), &change); err != nil || change.Name == "" {
+		slog.Warn("Ignoring malformed rule change notification", "payload", payload)
+		return
+	}
+	s.index.evict(ctx, ruleIndexKey(change.WorkspaceID, change.Name))
+}
+
+func (s *Service) handleMembershipChange(payload string) {
+	var change workspace.MembershipChange
+	if err := json.Unmarshal([]byte(payload), &change); err != nil || change.UserID == 0 {
+		slog.Warn("Ignoring malformed membership change notification", "payload", payload)
+		return
+	}
+	s.members.evict(change.WorkspaceID, change.UserID)
+}
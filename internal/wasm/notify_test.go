@@ -0,0 +1,43 @@
+package wasm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Gmacem/wasmorph/internal/workspace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleRuleChange(t *testing.T) {
+	cache := &mapCache{items: make(map[string]*Runtime)}
+	service := &Service{cache: cache, index: newRuleIndex(cache)}
+	ctx := context.Background()
+
+	rule := ruleIndexKey(7, "pricing")
+	service.index.set(ctx, rule, service.index.generation(rule), ruleCacheKey(7, "pricing", 1), &Runtime{}, 1)
+
+	service.handleRuleChange(ctx, "not json")
+	service.handleRuleChange(ctx, `{"workspace_id":7}`)
+	assert.Len(t, cache.items, 1, "malformed notifications are ignored")
+
+	service.handleRuleChange(ctx, `{"workspace_id":8,"name":"pricing"}`)
+	assert.Len(t, cache.items, 1, "rules of other users are kept")
+
+	service.handleRuleChange(ctx, `{"workspace_id":7,"name":"pricing"}`)
+	assert.Empty(t, cache.items)
+}
+
+func TestHandleMembershipChange(t *testing.T) {
+	service := &Service{members: newMemberIndex()}
+	caller := workspace.Caller{UserID: 3, WorkspaceID: 7}
+	service.members.set(caller, service.members.currentGeneration(), cachedMember{workspaceID: 7, role: workspace.RoleEditor})
+
+	service.handleMembershipChange("not json")
+	service.handleMembershipChange(`{"workspace_id":7}`)
+	_, cached := service.members.get(caller)
+	assert.True(t, cached, "malformed notifications are ignored")
+
+	service.handleMembershipChange(`{"workspace_id":7,"user_id":3}`)
+	_, cached = service.members.get(caller)
+	assert.False(t, cached)
+}
@@ -0,0 +1,138 @@
+package wasm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// abandonedBuildInterval is how often builds left by stopped replicas are
+// looked for.
+const abandonedBuildInterval = time.Minute
+
+// abandonedBuildError is the error of builds whose replica stopped before
+// they finished.
+const abandonedBuildError = "server restarted before the build finished"
+
+// newInstanceID returns a random ID for this process, under which it records
+// the builds it queues.
+func newInstanceID() int64 {
+	var b [8]byte
+	rand.Read(b[:])
+	return int64(binary.BigEndian.Uint64(b[:]) >> 1)
+}
+
+// FailAbandonedBuilds marks builds that stopped replicas left queued or
+// running as failed, so that clients polling them get an answer. Builds wait
+// in the memory of the replica that accepted them and cannot be resumed
+// elsewhere.
+//
+// Every replica holds an advisory lock on its instance ID for as long as it
+// runs, on a connection taken out of the pool; builds of an instance whose
+// lock can be taken were abandoned. FailAbandonedBuilds takes this replica's
+// lock and checks once before returning, then keeps checking every
+// abandonedBuildInterval until ctx is done.
+func (s *Service) FailAbandonedBuilds(ctx context.Context) error {
+	lockConn, err := s.lockInstance(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := s.failAbandonedBuilds(ctx, lockConn); err != nil {
+		lockConn.Close(context.Background())
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(abandonedBuildInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				lockConn.Close(context.Background())
+				return
+			}
+
+			if lockConn.IsClosed() {
+				slog.Error("Lost the build instance lock; other replicas may fail this replica's builds")
+				if lockConn, err = s.lockInstance(ctx); err != nil {
+					slog.Error("Failed to take the build instance lock", "error", err)
+					continue
+				}
+			}
+			failed, err := s.failAbandonedBuilds(ctx, lockConn)
+			if err != nil {
+				slog.Error("Failed to fail abandoned builds", "error", err)
+			} else if failed > 0 {
+				slog.Info("Failed abandoned builds", "count", failed)
+			}
+		}
+	}()
+	return nil
+}
+
+// lockInstance takes the advisory lock on this replica's instance ID and
+// returns the connection holding it.
+func (s *Service) lockInstance(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	// The lock lasts as long as the session, so the connection is never
+	// handed back to the pool.
+	lockConn := conn.Hijack()
+	if err := sql.New(lockConn).LockInstance(ctx, s.instanceID); err != nil {
+		lockConn.Close(context.Background())
+		return nil, fmt.Errorf("failed to lock build instance: %w", err)
+	}
+	return lockConn, nil
+}
+
+// failAbandonedBuilds fails the unfinished builds of instances that hold no
+// lock, and of builds recorded before instances were, using lockConn to
+// probe the locks. It returns the number of builds failed.
+func (s *Service) failAbandonedBuilds(ctx context.Context, lockConn *pgx.Conn) (int64, error) {
+	instances, err := s.queries.ListUnfinishedBuildInstances(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list unfinished builds: %w", err)
+	}
+
+	locks := sql.New(lockConn)
+	var failed int64
+	for _, instance := range instances {
+		if instance.Valid {
+			if instance.Int64 == s.instanceID {
+				continue
+			}
+			abandoned, err := locks.TryLockInstance(ctx, instance.Int64)
+			if err != nil {
+				return failed, fmt.Errorf("failed to check build instance: %w", err)
+			}
+			if !abandoned {
+				continue
+			}
+		}
+
+		n, err := s.queries.FailInstanceBuildJobs(ctx, sql.FailInstanceBuildJobsParams{
+			InstanceID: instance,
+			Error:      pgtype.Text{String: abandonedBuildError, Valid: true},
+		})
+		if instance.Valid {
+			if err := locks.UnlockInstance(ctx, instance.Int64); err != nil {
+				return failed, fmt.Errorf("failed to unlock build instance: %w", err)
+			}
+		}
+		if err != nil {
+			return failed, fmt.Errorf("failed to fail abandoned builds: %w", err)
+		}
+		failed += n
+	}
+	return failed, nil
+}
@@ -0,0 +1,60 @@
+package wasm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// retentionInterval is how often deleted rules are checked for expiry.
+const retentionInterval = time.Hour
+
+// PurgeExpiredRules permanently removes rules that were deleted more than
+// retention ago, checking every retentionInterval until ctx is done. Each
+// replica may run it; a rule is purged by whichever gets to it first.
+func (s *Service) PurgeExpiredRules(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		purged, err := s.purgeExpiredRules(ctx, retention)
+		if err != nil {
+			slog.Error("Failed to purge expired rules", "error", err)
+		} else if purged > 0 {
+			slog.Info("Purged expired rules", "count", purged, "retention", retention)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// purgeExpiredRules purges the rules deleted more than retention ago. The
+// cutoff is taken in the database, on the same clock that set deleted_at.
+func (s *Service) purgeExpiredRules(ctx context.Context, retention time.Duration) (int, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.queries.WithTx(tx)
+	rules, err := qtx.PurgeExpiredRules(ctx, pgtype.Interval{Microseconds: retention.Microseconds(), Valid: true})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge rules: %w", err)
+	}
+	for _, rule := range rules {
+		if err := cleanUpPurgedRule(ctx, qtx, rule.WorkspaceID, rule.Name, rule.Version, "retention expired"); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit rule purge: %w", err)
+	}
+	return len(rules), nil
+}
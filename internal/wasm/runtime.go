@@ -2,53 +2,310 @@ package wasm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	extism "github.com/extism/go-sdk"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/experimental"
 )
 
-type Runtime struct {
+var (
+	ErrExecutionTimeout    = newError(CodeTimeout, "execution timed out")
+	ErrMemoryLimitExceeded = newError(CodeMemoryLimit, "memory limit exceeded")
+	ErrOutputLimitExceeded = newError(CodeExecutionTrap, "output limit exceeded")
+)
+
+const (
+	DefaultExecutionTimeout = 5 * time.Second
+	MaxExecutionTimeout     = time.Minute
+
+	// Memory is measured in 64 KiB WebAssembly pages.
+	wasmPageSize          = 64 << 10
+	DefaultMaxMemoryPages = 1024
+	MinMemoryPages        = 16
+	MaxMemoryPages        = 16384
+
+	DefaultMaxOutputBytes = 1 << 20
+	MaxOutputBytes        = 64 << 20
+
+	DefaultMinInstances = 1
+	MaxInstances        = 64
+)
+
+// RuntimeLimits bounds a single execution of a rule and the number of
+// executions that may run at once.
+type RuntimeLimits struct {
+	Timeout        time.Duration
+	MaxMemoryPages uint32
+	MaxOutputBytes int
+	// MinInstances are created up front. MaxInstances caps concurrent
+	// executions; zero means one per available CPU.
+	MinInstances int
+	MaxInstances int
+}
+
+// instance is one instantiation of the rule's module together with the
+// memory backing it.
+type instance struct {
 	plugin *extism.Plugin
-	mu     sync.Mutex
+	memory *instanceMemory
 }
 
-func NewRuntime(wasmBytes []byte) (*Runtime, error) {
+// instanceMemory allocates the linear memories of an instance and holds each
+// of them to the rule's page limit. Guests see a refused memory.grow as a
+// failed allocation and trap the same way they do on any panic, so the
+// refusal is noted here to tell running out of memory apart.
+type instanceMemory struct {
+	maxBytes uint64
+	exceeded atomic.Bool
+}
+
+func (m *instanceMemory) Allocate(capacity, _ uint64) experimental.LinearMemory {
+	return &linearMemory{owner: m, buf: make([]byte, 0, capacity)}
+}
+
+// linearMemory is a linear memory allocated by an instanceMemory.
+type linearMemory struct {
+	owner *instanceMemory
+	buf   []byte
+	// created is set once the memory has its initial size, which the module
+	// declares and is not limited; later calls to Reallocate grow it.
+	created bool
+}
+
+func (m *linearMemory) Reallocate(size uint64) []byte {
+	if m.created && size > m.owner.maxBytes {
+		m.owner.exceeded.Store(true)
+		return nil
+	}
+	m.created = true
+	if size <= uint64(cap(m.buf)) {
+		m.buf = m.buf[:size]
+	} else {
+		m.buf = append(m.buf, make([]byte, size-uint64(len(m.buf)))...)
+	}
+	return m.buf
+}
+
+func (m *linearMemory) Free() {
+	m.buf = nil
+}
+
+// Runtime executes one compiled rule. The module is compiled once and a pool
+// of instances created from it runs calls in parallel. An instance whose call
+// fails is dropped, and a new one is created when it is next needed.
+//
+// A runtime dropped from the cache may still be running calls, so Close only
+// marks it and the last call releases it.
+type Runtime struct {
+	compiled *extism.CompiledPlugin
+	limits   RuntimeLimits
+	// slots holds one token per call allowed to run at once.
+	slots chan struct{}
+	idle  chan *instance
+
+	mu      sync.Mutex
+	calls   int
+	closing bool
+	closed  bool
+}
+
+// errRuntimeClosed is returned by calls on a runtime that has been released.
+// A runtime is only closed once it has left the cache, so the caller should
+// load the rule again.
+var errRuntimeClosed = errors.New("runtime is closed")
+
+// NewModuleCache returns a cache of natively compiled modules to share between
+// runtimes, so recreating a runtime for the same binary skips compilation.
+// With a directory, compiled code is also kept across restarts.
+func NewModuleCache(dir string) (wazero.CompilationCache, error) {
+	if dir == "" {
+		return wazero.NewCompilationCache(), nil
+	}
+	cache, err := wazero.NewCompilationCacheWithDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open module cache: %w", err)
+	}
+	return cache, nil
+}
+
+// NewRuntime compiles wasmBytes into a runtime. moduleCache may be nil, in
+// which case nothing is shared with other runtimes.
+func NewRuntime(wasmBytes []byte, limits RuntimeLimits, moduleCache wazero.CompilationCache) (*Runtime, error) {
+	if limits.Timeout <= 0 {
+		limits.Timeout = DefaultExecutionTimeout
+	}
+	if limits.MaxMemoryPages == 0 {
+		limits.MaxMemoryPages = DefaultMaxMemoryPages
+	}
+	if limits.MaxOutputBytes <= 0 {
+		limits.MaxOutputBytes = DefaultMaxOutputBytes
+	}
+	if limits.MaxInstances <= 0 {
+		limits.MaxInstances = runtime.GOMAXPROCS(0)
+	}
+	limits.MinInstances = max(1, min(limits.MinInstances, limits.MaxInstances))
+
 	manifest := extism.Manifest{
 		Wasm: []extism.Wasm{
 			extism.WasmData{Data: wasmBytes},
 		},
 		AllowedHosts: []string{},
 		AllowedPaths: map[string]string{},
+		// Memory pages are limited by instanceMemory rather than by wazero,
+		// so that running out of them can be detected.
+		Memory: &extism.ManifestMemory{},
+	}
+
+	runtimeConfig := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if moduleCache != nil {
+		runtimeConfig = runtimeConfig.WithCompilationCache(moduleCache)
 	}
 
 	config := extism.PluginConfig{
-		EnableWasi: true,
+		EnableWasi:    true,
+		RuntimeConfig: runtimeConfig,
 	}
 
-	plugin, err := extism.NewPlugin(context.Background(), manifest, config, nil)
+	ctx := context.Background()
+	compiled, err := extism.NewCompiledPlugin(ctx, manifest, config, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create plugin: %w", err)
 	}
 
-	return &Runtime{plugin: plugin}, nil
+	r := &Runtime{
+		compiled: compiled,
+		limits:   limits,
+		slots:    make(chan struct{}, limits.MaxInstances),
+		idle:     make(chan *instance, limits.MaxInstances),
+	}
+
+	for i := 0; i < limits.MinInstances; i++ {
+		inst, err := r.newInstance()
+		if err != nil {
+			compiled.Close(ctx)
+			return nil, fmt.Errorf("failed to create plugin: %w", err)
+		}
+		r.idle <- inst
+	}
+	return r, nil
 }
 
-func (r *Runtime) ExecuteTransform(input []byte) ([]byte, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (r *Runtime) newInstance() (*instance, error) {
+	memory := &instanceMemory{maxBytes: uint64(r.limits.MaxMemoryPages) * wasmPageSize}
+	ctx := experimental.WithMemoryAllocator(context.Background(), memory)
+	plugin, err := r.compiled.Instance(ctx, extism.PluginInstanceConfig{
+		ModuleConfig: wazero.NewModuleConfig(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &instance{plugin: plugin, memory: memory}, nil
+}
+
+// ExecuteTransform runs the rule on input. It gives up when ctx is done or
+// the rule's timeout passes, returning ErrExecutionTimeout for the latter,
+// returns ErrMemoryLimitExceeded when the rule runs out of memory and
+// ErrOutputLimitExceeded when it produces more output than allowed.
+func (r *Runtime) ExecuteTransform(ctx context.Context, input []byte) ([]byte, error) {
+	if !r.acquire() {
+		return nil, errRuntimeClosed
+	}
+	defer r.release()
+
+	select {
+	case r.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, contextError(ctx.Err())
+	}
+	defer func() { <-r.slots }()
 
-	_, result, err := r.plugin.Call("TransformWrapper", input)
+	var inst *instance
+	select {
+	case inst = <-r.idle:
+	default:
+		var err error
+		inst, err = r.newInstance()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create plugin instance: %w", err)
+		}
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, r.limits.Timeout)
+	defer cancel()
+
+	_, result, err := inst.plugin.CallWithContext(callCtx, "TransformWrapper", input)
 	if err != nil {
-		return nil, fmt.Errorf("transform execution failed: %w", err)
+		// After a trap or an interruption the guest's state is unknown, so
+		// the instance is dropped rather than reused.
+		inst.plugin.Close(context.Background())
+
+		switch {
+		case errors.Is(callCtx.Err(), context.DeadlineExceeded):
+			return nil, ErrExecutionTimeout
+		case callCtx.Err() != nil:
+			return nil, contextError(callCtx.Err())
+		case inst.memory.exceeded.Load():
+			return nil, fmt.Errorf("%w: rule needs more than %d memory pages", ErrMemoryLimitExceeded, r.limits.MaxMemoryPages)
+		}
+		return nil, &Error{Code: CodeExecutionTrap, Message: "transform execution failed", Err: err}
+	}
+	r.idle <- inst
+
+	if len(result) > r.limits.MaxOutputBytes {
+		return nil, fmt.Errorf("%w: output of %d bytes is larger than %d bytes", ErrOutputLimitExceeded, len(result), r.limits.MaxOutputBytes)
 	}
 
 	return result, nil
 }
 
+// acquire registers a call, failing if the runtime is already released.
+func (r *Runtime) acquire() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.calls++
+	return true
+}
+
+// release ends a call and releases the runtime if it was closed meanwhile.
+func (r *Runtime) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls--
+	if r.closing && r.calls == 0 {
+		if err := r.closeLocked(); err != nil {
+			slog.Error("Failed to close runtime", "error", err)
+		}
+	}
+}
+
+// Close releases the runtime once its calls in progress have finished.
 func (r *Runtime) Close() error {
-	if r.plugin != nil {
-		return r.plugin.Close(context.Background())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closing = true
+	if r.calls > 0 {
+		return nil
+	}
+	return r.closeLocked()
+}
+
+func (r *Runtime) closeLocked() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.compiled != nil {
+		return r.compiled.Close(context.Background())
 	}
 	return nil
 }
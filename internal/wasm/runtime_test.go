@@ -1,15 +1,19 @@
 package wasm
 
 import (
+	"context"
 	"encoding/json"
+	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestRuntime_ExecuteTransform(t *testing.T) {
-	compiler := NewCompiler("wasm-template", "test-temp")
+	compiler := NewCompiler("wasm-template", "test-temp", "")
 
 	sourceCode := `import "encoding/json"
 
@@ -33,7 +37,7 @@ func Transform(input []byte) []byte {
 			return
 		}
 
-		runtime, err := NewRuntime(wasmBytes)
+		runtime, err := NewRuntime(wasmBytes, RuntimeLimits{}, nil)
 		if err != nil {
 			t.Skip("Skipping test - runtime creation failed:", err)
 			return
@@ -42,7 +46,7 @@ func Transform(input []byte) []byte {
 
 		input := map[string]any{"test": "value", "number": 42.0}
 		inputJSON, _ := json.Marshal(input)
-		result, err := runtime.ExecuteTransform(inputJSON)
+		result, err := runtime.ExecuteTransform(context.Background(), inputJSON)
 
 		require.NoError(t, err)
 
@@ -58,7 +62,7 @@ func Transform(input []byte) []byte {
 
 func TestRuntime_Close(t *testing.T) {
 	t.Run("close nil plugin", func(t *testing.T) {
-		runtime := &Runtime{plugin: nil}
+		runtime := &Runtime{}
 		err := runtime.Close()
 		assert.NoError(t, err)
 	})
@@ -67,17 +71,17 @@ func TestRuntime_Close(t *testing.T) {
 func TestNewRuntime(t *testing.T) {
 	t.Run("invalid wasm data", func(t *testing.T) {
 		invalidWasm := []byte{0x00, 0x01, 0x02}
-		_, err := NewRuntime(invalidWasm)
+		_, err := NewRuntime(invalidWasm, RuntimeLimits{}, nil)
 		assert.Error(t, err)
 	})
 
 	t.Run("empty wasm data", func(t *testing.T) {
-		_, err := NewRuntime([]byte{})
+		_, err := NewRuntime([]byte{}, RuntimeLimits{}, nil)
 		assert.Error(t, err)
 	})
 
 	t.Run("valid wasm from compilation", func(t *testing.T) {
-		compiler := NewCompiler("wasm-template", "test-temp")
+		compiler := NewCompiler("wasm-template", "test-temp", "")
 		sourceCode := `func Transform(input []byte) []byte {
 	return input
 }`
@@ -88,9 +92,219 @@ func TestNewRuntime(t *testing.T) {
 			return
 		}
 
-		runtime, err := NewRuntime(wasmBytes)
+		runtime, err := NewRuntime(wasmBytes, RuntimeLimits{}, nil)
 		require.NoError(t, err)
 		require.NotNil(t, runtime)
 		defer runtime.Close()
 	})
 }
+
+// loopWasm is a module whose TransformWrapper never returns:
+//
+//	(func (export "TransformWrapper") (result i32)
+//	  (loop (br 0))
+//	  (i32.const 0))
+var loopWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	0x01, 0x05, 0x01, 0x60, 0x00, 0x01, 0x7f,
+	0x03, 0x02, 0x01, 0x00,
+	0x07, 0x14, 0x01, 0x10,
+	'T', 'r', 'a', 'n', 's', 'f', 'o', 'r', 'm', 'W', 'r', 'a', 'p', 'p', 'e', 'r',
+	0x00, 0x00,
+	0x0a, 0x0b, 0x01, 0x09, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x41, 0x00, 0x0b,
+}
+
+func TestRuntime_ExecuteTransformTimeout(t *testing.T) {
+	runtime, err := NewRuntime(loopWasm, RuntimeLimits{Timeout: 50 * time.Millisecond}, nil)
+	require.NoError(t, err)
+	defer runtime.Close()
+
+	t.Run("timeout", func(t *testing.T) {
+		start := time.Now()
+		_, err := runtime.ExecuteTransform(context.Background(), nil)
+		assert.ErrorIs(t, err, ErrExecutionTimeout)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("instance is replaced after timeout", func(t *testing.T) {
+		_, err := runtime.ExecuteTransform(context.Background(), nil)
+		assert.ErrorIs(t, err, ErrExecutionTimeout)
+	})
+
+	t.Run("request context cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		_, err := runtime.ExecuteTransform(ctx, nil)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NotErrorIs(t, err, ErrExecutionTimeout)
+	})
+}
+
+// outOfMemoryWasm grows its memory until that fails, then reports it the
+// way TinyGo does and traps like any panic:
+//
+//	(import "wasi_snapshot_preview1" "fd_write" (func $fd_write (param i32 i32 i32 i32) (result i32)))
+//	(memory (export "memory") 1)
+//	(data (i32.const 0) "\10\00\00\00\24\00\00\00")
+//	(data (i32.const 16) "panic: runtime error: out of memory\n")
+//	(func (export "TransformWrapper") (result i32)
+//	  (loop (br_if 0 (i32.ne (memory.grow (i32.const 1)) (i32.const -1))))
+//	  (drop (call $fd_write (i32.const 1) (i32.const 0) (i32.const 1) (i32.const 8)))
+//	  (unreachable))
+var outOfMemoryWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	0x01, 0x0d, 0x02, 0x60, 0x04, 0x7f, 0x7f, 0x7f, 0x7f, 0x01, 0x7f, 0x60, 0x00, 0x01, 0x7f,
+	0x02, 0x23, 0x01, 0x16,
+	'w', 'a', 's', 'i', '_', 's', 'n', 'a', 'p', 's', 'h', 'o', 't', '_', 'p', 'r', 'e', 'v', 'i', 'e', 'w', '1',
+	0x08, 'f', 'd', '_', 'w', 'r', 'i', 't', 'e', 0x00, 0x00,
+	0x03, 0x02, 0x01, 0x01,
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	0x07, 0x1d, 0x02, 0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00, 0x10,
+	'T', 'r', 'a', 'n', 's', 'f', 'o', 'r', 'm', 'W', 'r', 'a', 'p', 'p', 'e', 'r',
+	0x00, 0x01,
+	0x0a, 0x1c, 0x01, 0x1a, 0x00, 0x03, 0x40, 0x41, 0x01, 0x40, 0x00, 0x41, 0x7f, 0x47, 0x0d, 0x00, 0x0b,
+	0x41, 0x01, 0x41, 0x00, 0x41, 0x01, 0x41, 0x08, 0x10, 0x00, 0x1a, 0x00, 0x0b,
+	0x0b, 0x37, 0x02, 0x00, 0x41, 0x00, 0x0b, 0x08, 0x10, 0x00, 0x00, 0x00, 0x24, 0x00, 0x00, 0x00,
+	0x00, 0x41, 0x10, 0x0b, 0x24,
+	'p', 'a', 'n', 'i', 'c', ':', ' ', 'r', 'u', 'n', 't', 'i', 'm', 'e', ' ', 'e', 'r', 'r', 'o', 'r', ':', ' ',
+	'o', 'u', 't', ' ', 'o', 'f', ' ', 'm', 'e', 'm', 'o', 'r', 'y', '\n',
+}
+
+func TestRuntime_ExecuteTransformMemoryLimit(t *testing.T) {
+	runtime, err := NewRuntime(outOfMemoryWasm, RuntimeLimits{MaxMemoryPages: MinMemoryPages}, nil)
+	require.NoError(t, err)
+	defer runtime.Close()
+
+	for i := 0; i < 2; i++ {
+		_, err := runtime.ExecuteTransform(context.Background(), nil)
+		assert.ErrorIs(t, err, ErrMemoryLimitExceeded)
+		assert.Equal(t, CodeMemoryLimit, ErrorCodeOf(err))
+	}
+}
+
+// trapWasm is a module whose TransformWrapper traps without touching memory:
+//
+//	(func (export "TransformWrapper") (result i32)
+//	  (unreachable))
+var trapWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	0x01, 0x05, 0x01, 0x60, 0x00, 0x01, 0x7f,
+	0x03, 0x02, 0x01, 0x00,
+	0x07, 0x14, 0x01, 0x10,
+	'T', 'r', 'a', 'n', 's', 'f', 'o', 'r', 'm', 'W', 'r', 'a', 'p', 'p', 'e', 'r',
+	0x00, 0x00,
+	0x0a, 0x05, 0x01, 0x03, 0x00, 0x00, 0x0b,
+}
+
+func TestRuntime_ExecuteTransformTrap(t *testing.T) {
+	runtime, err := NewRuntime(trapWasm, RuntimeLimits{MaxMemoryPages: MinMemoryPages}, nil)
+	require.NoError(t, err)
+	defer runtime.Close()
+
+	_, err = runtime.ExecuteTransform(context.Background(), nil)
+	assert.NotErrorIs(t, err, ErrMemoryLimitExceeded)
+	assert.Equal(t, CodeExecutionTrap, ErrorCodeOf(err))
+}
+
+func TestRuntime_InstancePool(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+
+	runConcurrently := func(t *testing.T, runtime *Runtime, calls int) time.Duration {
+		t.Helper()
+		var wg sync.WaitGroup
+		start := time.Now()
+		for i := 0; i < calls; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := runtime.ExecuteTransform(context.Background(), nil)
+				assert.ErrorIs(t, err, ErrExecutionTimeout)
+			}()
+		}
+		wg.Wait()
+		return time.Since(start)
+	}
+
+	t.Run("min instances are created up front", func(t *testing.T) {
+		runtime, err := NewRuntime(loopWasm, RuntimeLimits{MinInstances: 3, MaxInstances: 4}, nil)
+		require.NoError(t, err)
+		defer runtime.Close()
+
+		assert.Len(t, runtime.idle, 3)
+	})
+
+	t.Run("calls run in parallel up to max instances", func(t *testing.T) {
+		runtime, err := NewRuntime(loopWasm, RuntimeLimits{Timeout: timeout, MaxInstances: 4}, nil)
+		require.NoError(t, err)
+		defer runtime.Close()
+
+		assert.Less(t, runConcurrently(t, runtime, 4), 3*timeout)
+	})
+
+	t.Run("calls beyond max instances wait", func(t *testing.T) {
+		runtime, err := NewRuntime(loopWasm, RuntimeLimits{Timeout: timeout, MaxInstances: 1}, nil)
+		require.NoError(t, err)
+		defer runtime.Close()
+
+		assert.GreaterOrEqual(t, runConcurrently(t, runtime, 3), 3*timeout)
+	})
+}
+
+func TestNewModuleCache(t *testing.T) {
+	t.Run("shared between runtimes", func(t *testing.T) {
+		cache, err := NewModuleCache("")
+		require.NoError(t, err)
+		defer cache.Close(context.Background())
+
+		first, err := NewRuntime(loopWasm, RuntimeLimits{Timeout: 10 * time.Millisecond}, cache)
+		require.NoError(t, err)
+		second, err := NewRuntime(loopWasm, RuntimeLimits{Timeout: 10 * time.Millisecond}, cache)
+		require.NoError(t, err)
+		defer second.Close()
+
+		// Closing one runtime leaves the compiled module usable by others.
+		require.NoError(t, first.Close())
+		_, err = second.ExecuteTransform(context.Background(), nil)
+		assert.ErrorIs(t, err, ErrExecutionTimeout)
+	})
+
+	t.Run("persisted to a directory", func(t *testing.T) {
+		dir := t.TempDir()
+
+		cache, err := NewModuleCache(dir)
+		require.NoError(t, err)
+		runtime, err := NewRuntime(loopWasm, RuntimeLimits{}, cache)
+		require.NoError(t, err)
+		require.NoError(t, runtime.Close())
+		require.NoError(t, cache.Close(context.Background()))
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.NotEmpty(t, entries)
+
+		cache, err = NewModuleCache(dir)
+		require.NoError(t, err)
+		defer cache.Close(context.Background())
+		runtime, err = NewRuntime(loopWasm, RuntimeLimits{}, cache)
+		require.NoError(t, err)
+		require.NoError(t, runtime.Close())
+	})
+}
+
+func TestInstanceMemory(t *testing.T) {
+	memory := &instanceMemory{maxBytes: 4}
+
+	memory.Allocate(8, 8).Reallocate(8)
+	assert.False(t, memory.exceeded.Load(), "the initial size is not limited")
+
+	linear := memory.Allocate(0, 8)
+	buf := linear.Reallocate(2)
+	copy(buf, "ab")
+	buf = linear.Reallocate(4)
+	assert.Equal(t, []byte("ab\x00\x00"), buf)
+	assert.False(t, memory.exceeded.Load())
+
+	assert.Nil(t, linear.Reallocate(5))
+	assert.True(t, memory.exceeded.Load())
+}
@@ -3,95 +3,637 @@ package wasm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strconv"
+	"log/slog"
+	"sync/atomic"
+	"time"
 
+	"github.com/Gmacem/wasmorph/internal/audit"
 	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/Gmacem/wasmorph/internal/workspace"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tetratelabs/wazero"
 )
 
+var (
+	ErrRuleNotFound    = newError(CodeNotFound, "rule not found")
+	ErrVersionNotFound = newError(CodeNotFound, "rule version not found")
+	ErrAliasNotFound   = newError(CodeNotFound, "rule alias not found")
+	ErrBuildNotFound   = newError(CodeNotFound, "build not found")
+	ErrRuleExists      = newError(CodeConflict, "rule already exists")
+	// ErrVersionMismatch means the rule was changed since the version an
+	// update was made against.
+	ErrVersionMismatch = newError(CodeVersionMismatch, "rule was changed by another update")
+)
+
+type ServiceConfig struct {
+	// BuildWorkers is the number of TinyGo builds that may run at once.
+	BuildWorkers int
+	// BuildQueueSize is the number of builds that may wait for a worker.
+	BuildQueueSize int
+	// CompileCacheDir stores compiled binaries keyed by a hash of their
+	// inputs. An empty value disables the compile cache.
+	CompileCacheDir string
+	// CompileCacheMaxBytes caps the size of the compile cache; the least
+	// recently used binaries are removed first. Zero means no cap.
+	CompileCacheMaxBytes int64
+	// ModuleCache holds natively compiled modules shared by all runtimes.
+	// An in-memory cache is used when it is nil.
+	ModuleCache wazero.CompilationCache
+}
+
 type Service struct {
+	pool     *pgxpool.Pool
 	queries  *sql.Queries
 	compiler *Compiler
+	builder  *Builder
 	cache    RuntimeCache
+	index    *ruleIndex
+	members  *memberIndex
+	modules  wazero.CompilationCache
+	// listening is set while change notifications are received. Resolved
+	// versions and roles are only cached then, since nothing else would
+	// drop them when they change.
+	listening atomic.Bool
+	// instanceID identifies this process on the builds it queues.
+	instanceID int64
 }
 
-func NewService(pool *pgxpool.Pool, cache RuntimeCache) *Service {
+func NewService(pool *pgxpool.Pool, cache RuntimeCache, config *ServiceConfig) *Service {
 	if cache == nil {
 		cache = &NoOpCache{}
 	}
+	if config == nil {
+		config = &ServiceConfig{
+			BuildWorkers:   2,
+			BuildQueueSize: 100,
+		}
+	}
 
+	modules := config.ModuleCache
+	if modules == nil {
+		modules = wazero.NewCompilationCache()
+	}
+
+	compiler := NewCompiler("wasm-template", "/tmp", config.CompileCacheDir)
+	compiler.cacheMaxBytes = config.CompileCacheMaxBytes
 	return &Service{
-		queries:  sql.New(pool),
-		compiler: NewCompiler("wasm-template", "/tmp"),
-		cache:    cache,
+		pool:       pool,
+		queries:    sql.New(pool),
+		compiler:   compiler,
+		builder:    NewBuilder(compiler.CompileGoToWasm, compiler.CachedWasm, config.BuildWorkers, config.BuildQueueSize),
+		cache:      cache,
+		index:      newRuleIndex(cache),
+		members:    newMemberIndex(),
+		modules:    modules,
+		instanceID: newInstanceID(),
 	}
 }
 
-func (s *Service) SaveRule(ctx context.Context, userID, name, sourceCode string) (sql.WasmorphRule, error) {
-	userIDInt, err := strconv.ParseInt(userID, 10, 32)
+// authorize checks the caller's role in their workspace and returns the
+// workspace ID.
+func (s *Service) authorize(ctx context.Context, caller workspace.Caller, required workspace.Role) (int32, error) {
+	return workspace.Authorize(ctx, s.queries, caller, required)
+}
+
+// authorizeCached is authorize with the caller's role taken from memory while
+// membership changes are received.
+func (s *Service) authorizeCached(ctx context.Context, caller workspace.Caller, required workspace.Role) (int32, error) {
+	if !s.listening.Load() {
+		return s.authorize(ctx, caller, required)
+	}
+
+	member, ok := s.members.get(caller)
+	if !ok {
+		generation := s.members.currentGeneration()
+		workspaceID, role, err := workspace.Membership(ctx, s.queries, caller)
+		if err != nil {
+			return 0, err
+		}
+		member = cachedMember{workspaceID: workspaceID, role: role}
+		s.members.set(caller, generation, member)
+	}
+	if err := member.role.Require(required); err != nil {
+		return 0, err
+	}
+	return member.workspaceID, nil
+}
+
+// SaveRule creates the rule or replaces its code, and reports whether it was
+// created.
+func (s *Service) SaveRule(ctx context.Context, caller workspace.Caller, name, sourceCode string, metadata RuleMetadata) (sql.WasmorphRule, bool, error) {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleEditor)
 	if err != nil {
-		return sql.WasmorphRule{}, fmt.Errorf("invalid user ID: %w", err)
+		return sql.WasmorphRule{}, false, err
+	}
+	if err := metadata.validate(); err != nil {
+		return sql.WasmorphRule{}, false, err
 	}
 
-	wasmBytes, err := s.compiler.CompileGoToWasm(sourceCode, name)
+	wasmBytes, err := s.builder.Compile(ctx, sourceCode, name)
 	if err != nil {
-		return sql.WasmorphRule{}, fmt.Errorf("compilation failed: %w", err)
+		return sql.WasmorphRule{}, false, err
 	}
 
-	rule, err := s.queries.CreateRule(ctx, sql.CreateRuleParams{
-		Name:       name,
-		UserID:     int32(userIDInt),
-		SourceCode: sourceCode,
-		WasmBinary: wasmBytes,
-		IsActive:   pgtype.Bool{Bool: true, Valid: true},
+	return s.saveRuleVersion(ctx, audit.ActionRuleUpdate, workspaceID, caller.UserID, name, sourceCode, wasmBytes, metadata)
+}
+
+// SubmitRuleBuild records a build job and queues the compilation in the
+// background. The rule is saved as a new version once the build succeeds;
+// progress is reported through GetBuild.
+func (s *Service) SubmitRuleBuild(ctx context.Context, caller workspace.Caller, name, sourceCode string, metadata RuleMetadata) (sql.WasmorphBuildJob, error) {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleEditor)
+	if err != nil {
+		return sql.WasmorphBuildJob{}, err
+	}
+	if err := metadata.validate(); err != nil {
+		return sql.WasmorphBuildJob{}, err
+	}
+
+	job, err := s.queries.CreateBuildJob(ctx, sql.CreateBuildJobParams{
+		UserID:      caller.UserID,
+		WorkspaceID: workspaceID,
+		RuleName:    name,
+		SourceCode:  sourceCode,
+		InstanceID:  pgtype.Int8{Int64: s.instanceID, Valid: true},
 	})
+	if err != nil {
+		return sql.WasmorphBuildJob{}, fmt.Errorf("failed to create build job: %w", err)
+	}
+
+	// The build finishes after the request, so its audit event is attributed
+	// to the actor of the request that submitted it.
+	actor, _ := audit.ActorFromContext(ctx)
+	started := func() {
+		if err := s.queries.StartBuildJob(context.Background(), job.ID); err != nil {
+			slog.Error("Failed to mark build job as running", "build_id", job.ID, "error", err)
+		}
+	}
+	finished := func(wasmBytes []byte, err error) {
+		s.finishBuild(audit.WithActor(context.Background(), actor), job, metadata, wasmBytes, err)
+	}
+
+	if err := s.builder.Submit(sourceCode, name, started, finished); err != nil {
+		s.failBuild(context.Background(), job.ID, err)
+		return sql.WasmorphBuildJob{}, err
+	}
+
+	return job, nil
+}
 
+func (s *Service) finishBuild(ctx context.Context, job sql.WasmorphBuildJob, metadata RuleMetadata, wasmBytes []byte, buildErr error) {
+	if buildErr != nil {
+		s.failBuild(ctx, job.ID, buildErr)
+		return
+	}
+
+	rule, _, err := s.saveRuleVersion(ctx, audit.ActionRuleUpdate, job.WorkspaceID, job.UserID, job.RuleName, job.SourceCode, wasmBytes, metadata)
 	if err != nil {
-		return sql.WasmorphRule{}, fmt.Errorf("failed to save rule: %w", err)
+		s.failBuild(ctx, job.ID, err)
+		return
+	}
+
+	if err := s.queries.CompleteBuildJob(ctx, sql.CompleteBuildJobParams{
+		ID:          job.ID,
+		RuleVersion: pgtype.Int4{Int32: rule.Version, Valid: true},
+	}); err != nil {
+		slog.Error("Failed to mark build job as succeeded", "build_id", job.ID, "error", err)
+	}
+}
+
+func (s *Service) failBuild(ctx context.Context, jobID int32, buildErr error) {
+	if err := s.queries.FailBuildJob(ctx, sql.FailBuildJobParams{
+		ID:    jobID,
+		Error: pgtype.Text{String: buildErr.Error(), Valid: true},
+	}); err != nil {
+		slog.Error("Failed to mark build job as failed", "build_id", jobID, "error", err)
+	}
+}
+
+func (s *Service) GetBuild(ctx context.Context, caller workspace.Caller, buildID int32) (sql.GetBuildJobRow, error) {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleViewer)
+	if err != nil {
+		return sql.GetBuildJobRow{}, err
+	}
+
+	job, err := s.queries.GetBuildJob(ctx, sql.GetBuildJobParams{
+		ID:          buildID,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return sql.GetBuildJobRow{}, lookupError(err, ErrBuildNotFound, "build")
+	}
+	return job, nil
+}
+
+// saveRuleVersion stores the source and binary as the rule's current code and
+// records them as a new immutable version in the same transaction. Cached
+// runtimes of the rule are dropped here and, through the notification sent on
+// commit, on every other replica. userID is recorded as the rule's author when
+// the rule is new. The change is audited as action, or as a creation when the
+// rule is new, and the result reports which it was.
+func (s *Service) saveRuleVersion(ctx context.Context, action audit.Action, workspaceID, userID int32, name, sourceCode string, wasmBytes []byte, metadata RuleMetadata) (sql.WasmorphRule, bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return sql.WasmorphRule{}, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.queries.WithTx(tx)
+	before, err := qtx.GetRuleHeadVersion(ctx, sql.GetRuleHeadVersionParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		action = audit.ActionRuleCreate
+		if err := checkNotDeleted(ctx, qtx, workspaceID, name); err != nil {
+			return sql.WasmorphRule{}, false, err
+		}
+	} else if err != nil {
+		return sql.WasmorphRule{}, false, fmt.Errorf("failed to load rule: %w", err)
+	}
+
+	description, tags, labels := metadata.params()
+	rule, err := qtx.CreateRule(ctx, sql.CreateRuleParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		SourceCode:  sourceCode,
+		WasmBinary:  wasmBytes,
+		IsActive:    pgtype.Bool{Bool: true, Valid: true},
+		Description: description,
+		Tags:        tags,
+		Labels:      labels,
+	})
+	if err != nil {
+		return sql.WasmorphRule{}, false, fmt.Errorf("failed to save rule: %w", err)
+	}
+
+	if err := recordRuleVersion(ctx, qtx, rule, action, before); err != nil {
+		return sql.WasmorphRule{}, false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return sql.WasmorphRule{}, false, fmt.Errorf("failed to commit rule: %w", err)
+	}
+
+	s.index.evict(ctx, ruleIndexKey(workspaceID, name))
+	return rule, action == audit.ActionRuleCreate, nil
+}
+
+// checkNotDeleted fails with ErrRuleExists if the workspace keeps a deleted
+// rule named name. Such a rule must be restored or purged before the name is
+// reused, so that nobody but an owner can drop a deleted rule for good.
+func checkNotDeleted(ctx context.Context, qtx *sql.Queries, workspaceID int32, name string) error {
+	deleted, err := qtx.IsRuleDeleted(ctx, sql.IsRuleDeletedParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check for deleted rule: %w", err)
+	}
+	if deleted {
+		return fmt.Errorf("%w: a deleted rule named %s exists; restore or purge it first", ErrRuleExists, name)
+	}
+	return nil
+}
+
+// recordRuleVersion follows a write of the rule's code in the transaction of
+// qtx: it stores the code as the rule's new version, audits the change from
+// version before and notifies other replicas on commit.
+func recordRuleVersion(ctx context.Context, qtx *sql.Queries, rule sql.WasmorphRule, action audit.Action, before int32) error {
+	if _, err := qtx.CreateRuleVersion(ctx, sql.CreateRuleVersionParams{
+		RuleID:     rule.ID,
+		Version:    rule.Version,
+		SourceCode: rule.SourceCode,
+		WasmBinary: rule.WasmBinary,
+	}); err != nil {
+		return fmt.Errorf("failed to save rule version: %w", err)
+	}
+
+	if err := audit.Record(ctx, qtx, audit.Event{
+		Action:        action,
+		WorkspaceID:   rule.WorkspaceID,
+		Target:        rule.Name,
+		VersionBefore: before,
+		VersionAfter:  rule.Version,
+	}); err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+
+	return publishRuleChange(ctx, qtx, rule.WorkspaceID, rule.Name)
+}
+
+// RuleUpdate changes an existing rule.
+type RuleUpdate struct {
+	// Version is the version the update was made against. The update fails
+	// with ErrVersionMismatch if the rule has changed since; 0 skips the check.
+	Version int32
+	// SourceCode replaces the rule's code. Nil keeps the current code and
+	// binary without recompiling.
+	SourceCode *string
+	Metadata   RuleMetadata
+}
+
+// UpdateRule applies update to an existing rule. New code becomes a new
+// version; an update of the metadata alone keeps the rule's version, so
+// versions only ever differ in their code.
+func (s *Service) UpdateRule(ctx context.Context, caller workspace.Caller, name string, update RuleUpdate) (sql.WasmorphRule, error) {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleEditor)
+	if err != nil {
+		return sql.WasmorphRule{}, err
+	}
+	if update.SourceCode == nil && update.Metadata.empty() {
+		return sql.WasmorphRule{}, invalidf("update changes nothing: code, description, tags or labels are required")
+	}
+	if err := update.Metadata.validate(); err != nil {
+		return sql.WasmorphRule{}, err
 	}
 
+	current, err := s.queries.GetRuleByNameAndWorkspace(ctx, sql.GetRuleByNameAndWorkspaceParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return sql.WasmorphRule{}, lookupError(err, ErrRuleNotFound, "rule")
+	}
+	if update.Version != 0 && update.Version != current.Version {
+		return sql.WasmorphRule{}, ErrVersionMismatch
+	}
+	if update.SourceCode != nil && *update.SourceCode == current.SourceCode {
+		update.SourceCode = nil
+	}
+	if update.SourceCode == nil && update.Metadata.empty() {
+		return current, nil
+	}
+
+	var sourceCode pgtype.Text
+	var wasmBytes []byte
+	if update.SourceCode != nil {
+		sourceCode = pgtype.Text{String: *update.SourceCode, Valid: true}
+		wasmBytes, err = s.builder.Compile(ctx, *update.SourceCode, name)
+		if err != nil {
+			return sql.WasmorphRule{}, err
+		}
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return sql.WasmorphRule{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.queries.WithTx(tx)
+	description, tags, labels := update.Metadata.params()
+	rule, err := qtx.UpdateRule(ctx, sql.UpdateRuleParams{
+		SourceCode:      sourceCode,
+		WasmBinary:      wasmBytes,
+		Description:     description,
+		Tags:            tags,
+		Labels:          labels,
+		Name:            name,
+		WorkspaceID:     workspaceID,
+		ExpectedVersion: current.Version,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Another update committed after the rule was read.
+		return sql.WasmorphRule{}, ErrVersionMismatch
+	}
+	if err != nil {
+		return sql.WasmorphRule{}, fmt.Errorf("failed to update rule: %w", err)
+	}
+
+	if update.SourceCode == nil {
+		// The code, and with it every cached runtime, is unchanged.
+		if err := audit.Record(ctx, qtx, audit.Event{
+			Action:        audit.ActionRuleUpdate,
+			WorkspaceID:   workspaceID,
+			Target:        name,
+			VersionBefore: current.Version,
+			VersionAfter:  rule.Version,
+		}); err != nil {
+			return sql.WasmorphRule{}, fmt.Errorf("failed to record audit event: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return sql.WasmorphRule{}, fmt.Errorf("failed to commit rule: %w", err)
+		}
+		return rule, nil
+	}
+
+	if err := recordRuleVersion(ctx, qtx, rule, audit.ActionRuleUpdate, current.Version); err != nil {
+		return sql.WasmorphRule{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return sql.WasmorphRule{}, fmt.Errorf("failed to commit rule: %w", err)
+	}
+
+	s.index.evict(ctx, ruleIndexKey(workspaceID, name))
 	return rule, nil
 }
 
-func (s *Service) ExecuteRule(ctx context.Context, userID, name string, input map[string]any) ([]byte, error) {
-	userIDInt, err := strconv.ParseInt(userID, 10, 32)
+// RenameRule gives the rule a new name, keeping its versions and aliases. The
+// rename fails with ErrRuleExists if a rule, deleted or not, has the new name.
+// A non-zero version must be the rule's current one.
+func (s *Service) RenameRule(ctx context.Context, caller workspace.Caller, name, newName string, version int32) error {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleEditor)
+	if err != nil {
+		return err
+	}
+	if newName == "" {
+		return invalidf("new name is required")
+	}
+	if newName == name {
+		return invalidf("rule is already named %s", name)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.queries.WithTx(tx)
+	current, err := qtx.GetRuleHeadVersion(ctx, sql.GetRuleHeadVersionParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrRuleNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load rule: %w", err)
+	}
+	if version != 0 && version != current {
+		return ErrVersionMismatch
+	}
+
+	if err := checkNotDeleted(ctx, qtx, workspaceID, newName); err != nil {
+		return err
+	}
+	if _, err := qtx.GetRuleHeadVersion(ctx, sql.GetRuleHeadVersionParams{
+		Name:        newName,
+		WorkspaceID: workspaceID,
+	}); err == nil {
+		return fmt.Errorf("%w: %s", ErrRuleExists, newName)
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to load rule: %w", err)
+	}
+
+	renamed, err := qtx.RenameRule(ctx, sql.RenameRuleParams{
+		NewName:     newName,
+		Name:        name,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rename rule: %w", err)
+	}
+	if renamed == 0 {
+		return ErrRuleNotFound
+	}
+
+	if err := audit.Record(ctx, qtx, audit.Event{
+		Action:      audit.ActionRuleRename,
+		WorkspaceID: workspaceID,
+		Target:      name,
+		Detail:      "to " + newName,
+	}); err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	for _, ruleName := range []string{name, newName} {
+		if err := publishRuleChange(ctx, qtx, workspaceID, ruleName); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit rule rename: %w", err)
+	}
+
+	s.index.evict(ctx, ruleIndexKey(workspaceID, name))
+	s.index.evict(ctx, ruleIndexKey(workspaceID, newName))
+	return nil
+}
+
+// VersionRef selects which version of a rule is executed. The zero value
+// selects the rule's current version.
+type VersionRef struct {
+	Version int32
+	Alias   string
+}
+
+// ExecuteRule runs the rule version that ref resolves to. When the caller's
+// role, the version and its runtime are all cached, it makes no query.
+func (s *Service) ExecuteRule(ctx context.Context, caller workspace.Caller, name string, ref VersionRef, input map[string]any) ([]byte, error) {
+	workspaceID, err := s.authorizeCached(ctx, caller, workspace.RoleExecutor)
+	if err != nil {
+		return nil, err
+	}
+
+	ruleKey := ruleIndexKey(workspaceID, name)
+	generation := s.index.generation(ruleKey)
+
+	version, err := s.resolveCachedVersion(ctx, ruleKey, generation, workspaceID, name, ref)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %w", err)
+		return nil, err
 	}
-	cacheKey := fmt.Sprintf("%d:%s", userIDInt, name)
+	cacheKey := ruleCacheKey(workspaceID, name, version)
 
 	if runtime, found := s.cache.Get(ctx, cacheKey); found && runtime != nil {
-		return s.executeWithRuntime(runtime, input)
+		result, err := s.executeWithRuntime(ctx, runtime, input)
+		if !errors.Is(err, errRuntimeClosed) {
+			return result, err
+		}
+		// The runtime was evicted and released after the lookup.
 	}
 
-	rule, err := s.queries.GetRuleByNameAndUser(ctx, sql.GetRuleByNameAndUserParams{
-		Name:   name,
-		UserID: int32(userIDInt),
+	ruleVersion, err := s.queries.GetRuleVersion(ctx, sql.GetRuleVersionParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+		Version:     version,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("rule not found: %w", err)
+		return nil, lookupError(err, ErrVersionNotFound, "rule version")
 	}
 
-	runtime, err := NewRuntime(rule.WasmBinary)
+	limits, err := s.loadRuleLimits(ctx, workspaceID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	runtime, err := NewRuntime(ruleVersion.WasmBinary, limits.runtimeLimits(), s.modules)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create runtime: %w", err)
 	}
 
-	cost := int64(len(rule.WasmBinary))
-	s.cache.Set(ctx, cacheKey, runtime, cost)
+	// Hold a call until this execution is done, so that an eviction right
+	// after caching cannot release the runtime before it runs.
+	runtime.acquire()
+	defer runtime.release()
+
+	cost := int64(len(ruleVersion.WasmBinary))
+	if !s.index.set(ctx, ruleKey, generation, cacheKey, runtime, cost) {
+		runtime.Close()
+	}
+
+	return s.executeWithRuntime(ctx, runtime, input)
+}
+
+// resolveCachedVersion is resolveVersion answered from the rule index when it
+// can be. generation must be read before the call.
+func (s *Service) resolveCachedVersion(ctx context.Context, ruleKey string, generation uint64, workspaceID int32, name string, ref VersionRef) (int32, error) {
+	if ref.Version != 0 || !s.listening.Load() {
+		return s.resolveVersion(ctx, workspaceID, name, ref)
+	}
+	if version, ok := s.index.version(ruleKey, ref); ok {
+		return version, nil
+	}
+
+	version, err := s.resolveVersion(ctx, workspaceID, name, ref)
+	if err != nil {
+		return 0, err
+	}
+	s.index.setVersion(ruleKey, generation, ref, version)
+	return version, nil
+}
 
-	return s.executeWithRuntime(runtime, input)
+// resolveVersion turns a version reference into a concrete version number.
+// Pinned versions are returned as is and checked when their binary is loaded.
+func (s *Service) resolveVersion(ctx context.Context, workspaceID int32, name string, ref VersionRef) (int32, error) {
+	switch {
+	case ref.Version != 0 && ref.Alias != "":
+		return 0, invalidf("version and alias are mutually exclusive")
+	case ref.Version != 0:
+		return ref.Version, nil
+	case ref.Alias != "":
+		version, err := s.queries.GetRuleAliasVersion(ctx, sql.GetRuleAliasVersionParams{
+			Name:        name,
+			WorkspaceID: workspaceID,
+			Alias:       ref.Alias,
+		})
+		if err != nil {
+			return 0, lookupError(err, ErrAliasNotFound, "rule alias")
+		}
+		return version, nil
+	default:
+		version, err := s.queries.GetRuleHeadVersion(ctx, sql.GetRuleHeadVersionParams{
+			Name:        name,
+			WorkspaceID: workspaceID,
+		})
+		if err != nil {
+			return 0, lookupError(err, ErrRuleNotFound, "rule")
+		}
+		return version, nil
+	}
 }
 
-func (s *Service) executeWithRuntime(runtime *Runtime, input map[string]any) ([]byte, error) {
+func (s *Service) executeWithRuntime(ctx context.Context, runtime *Runtime, input map[string]any) ([]byte, error) {
 	inputBytes, err := json.Marshal(input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal input: %w", err)
 	}
 
-	result, err := runtime.ExecuteTransform(inputBytes)
+	result, err := runtime.ExecuteTransform(ctx, inputBytes)
 	if err != nil {
 		return nil, fmt.Errorf("execution failed: %w", err)
 	}
@@ -99,44 +641,540 @@ func (s *Service) executeWithRuntime(runtime *Runtime, input map[string]any) ([]
 	return result, nil
 }
 
-func (s *Service) ListRules(ctx context.Context, userID string) ([]sql.ListRulesByUserRow, error) {
-	userIDInt, err := strconv.ParseInt(userID, 10, 32)
+func (s *Service) GetRule(ctx context.Context, caller workspace.Caller, name string) (sql.WasmorphRule, error) {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleViewer)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %w", err)
+		return sql.WasmorphRule{}, err
 	}
 
-	rules, err := s.queries.ListRulesByUser(ctx, int32(userIDInt))
+	rule, err := s.queries.GetRuleByNameAndWorkspace(ctx, sql.GetRuleByNameAndWorkspaceParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list rules: %w", err)
+		return sql.WasmorphRule{}, lookupError(err, ErrRuleNotFound, "rule")
 	}
-	return rules, nil
+
+	return rule, nil
 }
 
-func (s *Service) GetRule(ctx context.Context, userID, name string) (sql.WasmorphRule, error) {
-	userIDInt, err := strconv.ParseInt(userID, 10, 32)
+func (s *Service) DeleteRule(ctx context.Context, caller workspace.Caller, name string) error {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return sql.WasmorphRule{}, fmt.Errorf("invalid user ID: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	rule, err := s.queries.GetRuleByNameAndUser(ctx, sql.GetRuleByNameAndUserParams{
-		Name:   name,
-		UserID: int32(userIDInt),
+	qtx := s.queries.WithTx(tx)
+	before, err := qtx.GetRuleHeadVersion(ctx, sql.GetRuleHeadVersionParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
 	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Deleting a missing rule has always succeeded; there is nothing to audit.
+		return nil
+	}
 	if err != nil {
-		return sql.WasmorphRule{}, fmt.Errorf("rule not found: %w", err)
+		return fmt.Errorf("failed to load rule: %w", err)
 	}
 
-	return rule, nil
+	if err := qtx.DeleteRule(ctx, sql.DeleteRuleParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+	}); err != nil {
+		return err
+	}
+	if err := audit.Record(ctx, qtx, audit.Event{
+		Action:        audit.ActionRuleDelete,
+		WorkspaceID:   workspaceID,
+		Target:        name,
+		VersionBefore: before,
+	}); err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit rule deletion: %w", err)
+	}
+
+	s.ruleChanged(ctx, workspaceID, name)
+	return nil
 }
 
-func (s *Service) DeleteRule(ctx context.Context, userID, name string) error {
-	userIDInt, err := strconv.ParseInt(userID, 10, 32)
+// TransferTarget selects where TransferRule moves a rule: a workspace the
+// caller may edit, or the personal workspace of the user named Username.
+type TransferTarget struct {
+	WorkspaceID int32
+	Username    string
+}
+
+// TransferRule moves the rule, with its versions and aliases, from the
+// caller's workspace to the target workspace. The transfer fails with
+// ErrRuleExists if the target has a rule of the same name, deleted or not.
+func (s *Service) TransferRule(ctx context.Context, caller workspace.Caller, name string, target TransferTarget) (int32, error) {
+	sourceID, err := s.authorize(ctx, caller, workspace.RoleEditor)
+	if err != nil {
+		return 0, err
+	}
+
+	var targetID int32
+	switch {
+	case target.WorkspaceID != 0 && target.Username != "":
+		return 0, invalidf("workspace_id and username are mutually exclusive")
+	case target.WorkspaceID != 0:
+		targetID, err = s.authorize(ctx, workspace.Caller{UserID: caller.UserID, WorkspaceID: target.WorkspaceID}, workspace.RoleEditor)
+		if err != nil {
+			return 0, err
+		}
+	case target.Username != "":
+		user, err := s.queries.GetUserByUsername(ctx, target.Username)
+		if err != nil {
+			return 0, lookupError(err, notFoundf("user %s not found", target.Username), "user")
+		}
+		targetID, err = s.queries.GetPersonalWorkspaceID(ctx, pgtype.Int4{Int32: user.ID, Valid: true})
+		if err != nil {
+			return 0, fmt.Errorf("failed to find personal workspace: %w", err)
+		}
+	default:
+		return 0, invalidf("workspace_id or username is required")
+	}
+	if targetID == sourceID {
+		return 0, invalidf("rule is already in the target workspace")
+	}
+
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("invalid user ID: %w", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	return s.queries.DeleteRule(ctx, sql.DeleteRuleParams{
-		Name:   name,
-		UserID: int32(userIDInt),
+	qtx := s.queries.WithTx(tx)
+	if err := checkNotDeleted(ctx, qtx, targetID, name); err != nil {
+		return 0, err
+	}
+	if _, err := qtx.GetRuleHeadVersion(ctx, sql.GetRuleHeadVersionParams{
+		Name:        name,
+		WorkspaceID: targetID,
+	}); err == nil {
+		return 0, fmt.Errorf("%w: target workspace already has a rule named %s", ErrRuleExists, name)
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("failed to load rule: %w", err)
+	}
+
+	moved, err := qtx.MoveRule(ctx, sql.MoveRuleParams{
+		TargetWorkspaceID: targetID,
+		Name:              name,
+		WorkspaceID:       sourceID,
 	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to move rule: %w", err)
+	}
+	if moved == 0 {
+		return 0, ErrRuleNotFound
+	}
+
+	// The transfer is visible from both workspaces; Detail names the other one.
+	for _, event := range []audit.Event{
+		{WorkspaceID: sourceID, Detail: fmt.Sprintf("to workspace %d", targetID)},
+		{WorkspaceID: targetID, Detail: fmt.Sprintf("from workspace %d", sourceID)},
+	} {
+		event.Action = audit.ActionRuleTransfer
+		event.Target = name
+		if err := audit.Record(ctx, qtx, event); err != nil {
+			return 0, fmt.Errorf("failed to record audit event: %w", err)
+		}
+	}
+
+	for _, workspaceID := range []int32{sourceID, targetID} {
+		if err := publishRuleChange(ctx, qtx, workspaceID, name); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit rule transfer: %w", err)
+	}
+
+	s.index.evict(ctx, ruleIndexKey(sourceID, name))
+	s.index.evict(ctx, ruleIndexKey(targetID, name))
+	return targetID, nil
+}
+
+func (s *Service) ListRuleVersions(ctx context.Context, caller workspace.Caller, name string) ([]sql.ListRuleVersionsRow, error) {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := s.queries.ListRuleVersions(ctx, sql.ListRuleVersionsParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rule versions: %w", err)
+	}
+	if len(versions) == 0 {
+		return nil, ErrRuleNotFound
+	}
+	return versions, nil
+}
+
+// RollbackRule makes the code of an earlier version current again. The old
+// version is copied into a new version, so history is never rewritten and the
+// stored binary is reused without recompiling.
+func (s *Service) RollbackRule(ctx context.Context, caller workspace.Caller, name string, version int32) (sql.WasmorphRule, error) {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleEditor)
+	if err != nil {
+		return sql.WasmorphRule{}, err
+	}
+
+	target, err := s.queries.GetRuleVersion(ctx, sql.GetRuleVersionParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+		Version:     version,
+	})
+	if err != nil {
+		return sql.WasmorphRule{}, lookupError(err, ErrVersionNotFound, "rule version")
+	}
+
+	rule, _, err := s.saveRuleVersion(ctx, audit.ActionRuleRollback, workspaceID, caller.UserID, name, target.SourceCode, target.WasmBinary, RuleMetadata{})
+	return rule, err
+}
+
+func (s *Service) ListRuleAliases(ctx context.Context, caller workspace.Caller, name string) ([]sql.ListRuleAliasesRow, error) {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.queries.GetRuleHeadVersion(ctx, sql.GetRuleHeadVersionParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+	}); err != nil {
+		return nil, lookupError(err, ErrRuleNotFound, "rule")
+	}
+
+	aliases, err := s.queries.ListRuleAliases(ctx, sql.ListRuleAliasesParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rule aliases: %w", err)
+	}
+	return aliases, nil
+}
+
+// SetRuleAlias creates the alias or moves it to another version of the rule.
+func (s *Service) SetRuleAlias(ctx context.Context, caller workspace.Caller, name, alias string, version int32) (sql.WasmorphRuleAlias, error) {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleEditor)
+	if err != nil {
+		return sql.WasmorphRuleAlias{}, err
+	}
+	if err := validateAlias(alias); err != nil {
+		return sql.WasmorphRuleAlias{}, err
+	}
+
+	target, err := s.queries.GetRuleVersion(ctx, sql.GetRuleVersionParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+		Version:     version,
+	})
+	if err != nil {
+		return sql.WasmorphRuleAlias{}, lookupError(err, ErrVersionNotFound, "rule version")
+	}
+
+	ruleAlias, err := s.queries.SetRuleAlias(ctx, sql.SetRuleAliasParams{
+		RuleID:  target.RuleID,
+		Alias:   alias,
+		Version: target.Version,
+	})
+	if err != nil {
+		return sql.WasmorphRuleAlias{}, fmt.Errorf("failed to save rule alias: %w", err)
+	}
+
+	s.recordEvent(ctx, audit.Event{
+		Action:       audit.ActionRuleAliasSet,
+		WorkspaceID:  workspaceID,
+		Target:       name,
+		Detail:       alias,
+		VersionAfter: ruleAlias.Version,
+	})
+	return ruleAlias, nil
+}
+
+// RestoreRule makes a deleted rule active again, as it was when deleted.
+func (s *Service) RestoreRule(ctx context.Context, caller workspace.Caller, name string) error {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.queries.WithTx(tx)
+	version, err := qtx.RestoreRule(ctx, sql.RestoreRuleParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: no deleted rule named %s", ErrRuleNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore rule: %w", err)
+	}
+	if err := audit.Record(ctx, qtx, audit.Event{
+		Action:       audit.ActionRuleRestore,
+		WorkspaceID:  workspaceID,
+		Target:       name,
+		VersionAfter: version,
+	}); err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	if err := publishRuleChange(ctx, qtx, workspaceID, name); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit rule restore: %w", err)
+	}
+
+	s.index.evict(ctx, ruleIndexKey(workspaceID, name))
+	return nil
+}
+
+// PurgeRule permanently removes a deleted rule with its versions, aliases and
+// the source code kept by its finished builds. Only workspace owners may
+// purge, and only rules that were deleted first.
+func (s *Service) PurgeRule(ctx context.Context, caller workspace.Caller, name string) error {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.queries.WithTx(tx)
+	version, err := qtx.PurgeDeletedRule(ctx, sql.PurgeDeletedRuleParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: no deleted rule named %s", ErrRuleNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to purge rule: %w", err)
+	}
+	if err := cleanUpPurgedRule(ctx, qtx, workspaceID, name, version, ""); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit rule purge: %w", err)
+	}
+	return nil
+}
+
+// cleanUpPurgedRule removes what is left of a rule purged in the transaction
+// of qtx and audits the purge.
+func cleanUpPurgedRule(ctx context.Context, qtx *sql.Queries, workspaceID int32, name string, version int32, detail string) error {
+	if err := qtx.DeleteFinishedBuildJobs(ctx, sql.DeleteFinishedBuildJobsParams{
+		WorkspaceID: workspaceID,
+		RuleName:    name,
+	}); err != nil {
+		return fmt.Errorf("failed to delete build jobs: %w", err)
+	}
+	if err := audit.Record(ctx, qtx, audit.Event{
+		Action:        audit.ActionRulePurge,
+		WorkspaceID:   workspaceID,
+		Target:        name,
+		VersionBefore: version,
+		Detail:        detail,
+	}); err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) DeleteRuleAlias(ctx context.Context, caller workspace.Caller, name, alias string) error {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.queries.DeleteRuleAlias(ctx, sql.DeleteRuleAliasParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+		Alias:       alias,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete rule alias: %w", err)
+	}
+	if deleted == 0 {
+		return ErrAliasNotFound
+	}
+
+	s.recordEvent(ctx, audit.Event{
+		Action:      audit.ActionRuleAliasDelete,
+		WorkspaceID: workspaceID,
+		Target:      name,
+		Detail:      alias,
+	})
+	return nil
+}
+
+// RuleLimits are the execution limits stored with a rule. They apply to every
+// version of the rule.
+type RuleLimits struct {
+	TimeoutMs      int32 `json:"timeout_ms"`
+	MaxMemoryPages int32 `json:"max_memory_pages"`
+	MaxOutputBytes int32 `json:"max_output_bytes"`
+	MinInstances   int32 `json:"min_instances"`
+	MaxInstances   int32 `json:"max_instances"`
+}
+
+func (l RuleLimits) validate() error {
+	if l.TimeoutMs <= 0 || time.Duration(l.TimeoutMs)*time.Millisecond > MaxExecutionTimeout {
+		return invalidf("timeout_ms must be between 1 and %d", MaxExecutionTimeout.Milliseconds())
+	}
+	if l.MaxMemoryPages < MinMemoryPages || l.MaxMemoryPages > MaxMemoryPages {
+		return invalidf("max_memory_pages must be between %d and %d", MinMemoryPages, MaxMemoryPages)
+	}
+	if l.MaxOutputBytes <= 0 || l.MaxOutputBytes > MaxOutputBytes {
+		return invalidf("max_output_bytes must be between 1 and %d", MaxOutputBytes)
+	}
+	if l.MinInstances < 1 || l.MinInstances > MaxInstances {
+		return invalidf("min_instances must be between 1 and %d", MaxInstances)
+	}
+	if l.MaxInstances < 0 || l.MaxInstances > MaxInstances {
+		return invalidf("max_instances must be between 0 and %d", MaxInstances)
+	}
+	if l.MaxInstances != 0 && l.MinInstances > l.MaxInstances {
+		return invalidf("min_instances must not be greater than max_instances")
+	}
+	return nil
+}
+
+func (l RuleLimits) runtimeLimits() RuntimeLimits {
+	return RuntimeLimits{
+		Timeout:        time.Duration(l.TimeoutMs) * time.Millisecond,
+		MaxMemoryPages: uint32(l.MaxMemoryPages),
+		MaxOutputBytes: int(l.MaxOutputBytes),
+		MinInstances:   int(l.MinInstances),
+		MaxInstances:   int(l.MaxInstances),
+	}
+}
+
+func (s *Service) GetRuleLimits(ctx context.Context, caller workspace.Caller, name string) (RuleLimits, error) {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleViewer)
+	if err != nil {
+		return RuleLimits{}, err
+	}
+	return s.loadRuleLimits(ctx, workspaceID, name)
+}
+
+func (s *Service) loadRuleLimits(ctx context.Context, workspaceID int32, name string) (RuleLimits, error) {
+	limits, err := s.queries.GetRuleLimits(ctx, sql.GetRuleLimitsParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+	})
+	if err != nil {
+		return RuleLimits{}, lookupError(err, ErrRuleNotFound, "rule limits")
+	}
+	return RuleLimits{
+		TimeoutMs:      limits.TimeoutMs,
+		MaxMemoryPages: limits.MaxMemoryPages,
+		MaxOutputBytes: limits.MaxOutputBytes,
+		MinInstances:   limits.MinInstances,
+		MaxInstances:   limits.MaxInstances,
+	}, nil
+}
+
+// SetRuleLimits stores new limits for the rule. Runtimes are created with the
+// limits in force at the time, so cached runtimes of the rule are dropped.
+func (s *Service) SetRuleLimits(ctx context.Context, caller workspace.Caller, name string, limits RuleLimits) (RuleLimits, error) {
+	workspaceID, err := s.authorize(ctx, caller, workspace.RoleEditor)
+	if err != nil {
+		return RuleLimits{}, err
+	}
+	if err := limits.validate(); err != nil {
+		return RuleLimits{}, err
+	}
+
+	updated, err := s.queries.UpdateRuleLimits(ctx, sql.UpdateRuleLimitsParams{
+		Name:           name,
+		WorkspaceID:    workspaceID,
+		TimeoutMs:      limits.TimeoutMs,
+		MaxMemoryPages: limits.MaxMemoryPages,
+		MaxOutputBytes: limits.MaxOutputBytes,
+		MinInstances:   limits.MinInstances,
+		MaxInstances:   limits.MaxInstances,
+	})
+	if err != nil {
+		return RuleLimits{}, fmt.Errorf("failed to save rule limits: %w", err)
+	}
+	if updated == 0 {
+		return RuleLimits{}, ErrRuleNotFound
+	}
+
+	s.recordEvent(ctx, audit.Event{
+		Action:      audit.ActionRuleLimitsUpdate,
+		WorkspaceID: workspaceID,
+		Target:      name,
+	})
+	s.ruleChanged(ctx, workspaceID, name)
+	return limits, nil
+}
+
+// ruleChanged drops cached runtimes of a rule after a write that has already
+// been committed, and tells other replicas to do the same.
+func (s *Service) ruleChanged(ctx context.Context, workspaceID int32, name string) {
+	s.index.evict(ctx, ruleIndexKey(workspaceID, name))
+	if err := publishRuleChange(ctx, s.queries, workspaceID, name); err != nil {
+		slog.Error("Other replicas may serve a stale rule", "workspace_id", workspaceID, "rule", name, "error", err)
+	}
+}
+
+// recordEvent audits a change that has already been committed, so a failure
+// is logged rather than returned.
+func (s *Service) recordEvent(ctx context.Context, event audit.Event) {
+	if err := audit.Record(ctx, s.queries, event); err != nil {
+		slog.Error("Failed to record audit event", "action", event.Action, "rule", event.Target, "error", err)
+	}
+}
+
+func validateAlias(alias string) error {
+	if alias == "" || len(alias) > 64 {
+		return invalidf("alias must be between 1 and 64 characters")
+	}
+	for _, r := range alias {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return invalidf("alias may only contain letters, digits, '-' and '_'")
+		}
+	}
+	if alias[0] >= '0' && alias[0] <= '9' {
+		return invalidf("alias must not start with a digit")
+	}
+	return nil
+}
+
+func ruleCacheKey(workspaceID int32, name string, version int32) string {
+	return fmt.Sprintf("%d:%s:%d", workspaceID, name, version)
+}
+
+// lookupError returns notFound if err reports that a query found no row, and
+// otherwise err as a failure to load what.
+func lookupError(err, notFound error, what string) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return notFound
+	}
+	return fmt.Errorf("failed to load %s: %w", what, err)
 }
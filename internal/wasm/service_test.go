@@ -0,0 +1,106 @@
+package wasm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Gmacem/wasmorph/internal/workspace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		alias   string
+		wantErr bool
+	}{
+		{name: "simple", alias: "stable", wantErr: false},
+		{name: "with dash and digits", alias: "canary-2", wantErr: false},
+		{name: "with underscore", alias: "team_b", wantErr: false},
+		{name: "empty", alias: "", wantErr: true},
+		{name: "too long", alias: string(make([]byte, 65)), wantErr: true},
+		{name: "leading digit", alias: "7", wantErr: true},
+		{name: "slash", alias: "a/b", wantErr: true},
+		{name: "space", alias: "my alias", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAlias(tt.alias)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRuleCacheKey(t *testing.T) {
+	assert.Equal(t, "1:rule:3", ruleCacheKey(1, "rule", 3))
+	assert.NotEqual(t, ruleCacheKey(1, "rule", 3), ruleCacheKey(1, "rule", 4))
+}
+
+func TestRuleLimitsValidate(t *testing.T) {
+	valid := RuleLimits{
+		TimeoutMs:      5000,
+		MaxMemoryPages: DefaultMaxMemoryPages,
+		MaxOutputBytes: DefaultMaxOutputBytes,
+		MinInstances:   DefaultMinInstances,
+	}
+	assert.NoError(t, valid.validate())
+
+	tests := []struct {
+		name   string
+		modify func(l *RuleLimits)
+	}{
+		{"zero timeout", func(l *RuleLimits) { l.TimeoutMs = 0 }},
+		{"timeout too long", func(l *RuleLimits) { l.TimeoutMs = int32(MaxExecutionTimeout.Milliseconds()) + 1 }},
+		{"too few memory pages", func(l *RuleLimits) { l.MaxMemoryPages = MinMemoryPages - 1 }},
+		{"too many memory pages", func(l *RuleLimits) { l.MaxMemoryPages = MaxMemoryPages + 1 }},
+		{"zero output bytes", func(l *RuleLimits) { l.MaxOutputBytes = 0 }},
+		{"output bytes too large", func(l *RuleLimits) { l.MaxOutputBytes = MaxOutputBytes + 1 }},
+		{"zero min instances", func(l *RuleLimits) { l.MinInstances = 0 }},
+		{"negative max instances", func(l *RuleLimits) { l.MaxInstances = -1 }},
+		{"too many instances", func(l *RuleLimits) { l.MaxInstances = MaxInstances + 1 }},
+		{"min above max instances", func(l *RuleLimits) { l.MinInstances, l.MaxInstances = 4, 2 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := valid
+			tt.modify(&limits)
+			assert.Error(t, limits.validate())
+		})
+	}
+}
+
+func TestExecuteRuleFromCache(t *testing.T) {
+	// The service has no database: any query would panic.
+	cache := &mapCache{items: make(map[string]*Runtime)}
+	service := &Service{cache: cache, index: newRuleIndex(cache), members: newMemberIndex()}
+	service.listening.Store(true)
+	ctx := context.Background()
+
+	runtime, err := NewRuntime(trapWasm, RuntimeLimits{}, nil)
+	require.NoError(t, err)
+	defer runtime.Close()
+
+	caller := workspace.Caller{UserID: 1}
+	service.members.set(caller, service.members.currentGeneration(), cachedMember{workspaceID: 10, role: workspace.RoleExecutor})
+	rule := ruleIndexKey(10, "rule")
+	generation := service.index.generation(rule)
+	service.index.setVersion(rule, generation, VersionRef{Alias: "stable"}, 2)
+	service.index.set(ctx, rule, generation, ruleCacheKey(10, "rule", 2), runtime, 1)
+
+	_, err = service.ExecuteRule(ctx, caller, "rule", VersionRef{Alias: "stable"}, nil)
+	assert.Equal(t, CodeExecutionTrap, ErrorCodeOf(err), "the cached runtime runs")
+
+	_, err = service.ExecuteRule(ctx, caller, "rule", VersionRef{Version: 2}, nil)
+	assert.Equal(t, CodeExecutionTrap, ErrorCodeOf(err), "pinned versions need no lookup")
+
+	service.members.set(caller, service.members.currentGeneration(), cachedMember{workspaceID: 10, role: workspace.RoleViewer})
+	_, err = service.ExecuteRule(ctx, caller, "rule", VersionRef{Version: 2}, nil)
+	assert.ErrorIs(t, err, workspace.ErrForbidden)
+}
@@ -0,0 +1,193 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maxNameLength = 255
+
+type Service struct {
+	pool    *pgxpool.Pool
+	queries *sql.Queries
+}
+
+func NewService(pool *pgxpool.Pool) *Service {
+	return &Service{
+		pool:    pool,
+		queries: sql.New(pool),
+	}
+}
+
+// Create makes a new shared workspace owned by the user.
+func (s *Service) Create(ctx context.Context, userID int32, name string) (sql.WasmorphWorkspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxNameLength {
+		return sql.WasmorphWorkspace{}, fmt.Errorf("%w: workspace name must be between 1 and %d characters", ErrInvalid, maxNameLength)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return sql.WasmorphWorkspace{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.queries.WithTx(tx)
+	workspace, err := qtx.CreateWorkspace(ctx, name)
+	if err != nil {
+		return sql.WasmorphWorkspace{}, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	if _, err := qtx.SetWorkspaceMember(ctx, sql.SetWorkspaceMemberParams{
+		WorkspaceID: workspace.ID,
+		UserID:      userID,
+		Role:        string(RoleOwner),
+	}); err != nil {
+		return sql.WasmorphWorkspace{}, fmt.Errorf("failed to add workspace owner: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return sql.WasmorphWorkspace{}, fmt.Errorf("failed to commit workspace: %w", err)
+	}
+	return workspace, nil
+}
+
+// List returns the workspaces the user is a member of, with their role.
+func (s *Service) List(ctx context.Context, userID int32) ([]sql.ListWorkspacesByUserRow, error) {
+	workspaces, err := s.queries.ListWorkspacesByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	return workspaces, nil
+}
+
+func (s *Service) ListMembers(ctx context.Context, caller Caller) ([]sql.ListWorkspaceMembersRow, error) {
+	workspaceID, err := Authorize(ctx, s.queries, caller, RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.queries.ListWorkspaceMembers(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspace members: %w", err)
+	}
+	return members, nil
+}
+
+// SetMember adds the user to the caller's workspace or changes their role.
+// Only owners may do so.
+func (s *Service) SetMember(ctx context.Context, caller Caller, username string, role Role) (sql.WasmorphWorkspaceMember, error) {
+	var member sql.WasmorphWorkspaceMember
+	err := s.changeMembers(ctx, caller, username, false, func(qtx *sql.Queries, workspaceID, userID int32) error {
+		var err error
+		member, err = qtx.SetWorkspaceMember(ctx, sql.SetWorkspaceMemberParams{
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+			Role:        string(role),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save workspace member: %w", err)
+		}
+		return nil
+	})
+	return member, err
+}
+
+// RemoveMember takes the user out of the caller's workspace. Owners may
+// remove anyone; other members may only leave.
+func (s *Service) RemoveMember(ctx context.Context, caller Caller, username string) error {
+	return s.changeMembers(ctx, caller, username, true, func(qtx *sql.Queries, workspaceID, userID int32) error {
+		removed, err := qtx.RemoveWorkspaceMember(ctx, sql.RemoveWorkspaceMemberParams{
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to remove workspace member: %w", err)
+		}
+		if removed == 0 {
+			return fmt.Errorf("%w: %s is not a member of the workspace", ErrUserNotFound, username)
+		}
+		return nil
+	})
+}
+
+// changeMembers runs change on the member named username while holding a
+// lock on the workspace, and refuses changes that would leave the workspace
+// without an owner or take a personal workspace away from its user. Only
+// owners may change members, except that with allowSelf members may change
+// themselves.
+func (s *Service) changeMembers(ctx context.Context, caller Caller, username string, allowSelf bool, change func(qtx *sql.Queries, workspaceID, userID int32) error) error {
+	user, err := s.queries.GetUserByUsername(ctx, username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	required := RoleOwner
+	if allowSelf && user.ID == caller.UserID {
+		required = RoleViewer
+	}
+	workspaceID, err := Authorize(ctx, s.queries, caller, required)
+	if err != nil {
+		return err
+	}
+
+	workspace, err := s.queries.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to load workspace: %w", err)
+	}
+	if workspace.PersonalUserID.Valid && workspace.PersonalUserID.Int32 == user.ID {
+		return fmt.Errorf("%w: the owner of a personal workspace cannot be changed", ErrForbidden)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.queries.WithTx(tx)
+	if err := qtx.LockWorkspace(ctx, workspaceID); err != nil {
+		return fmt.Errorf("failed to lock workspace: %w", err)
+	}
+	if err := change(qtx, workspaceID, user.ID); err != nil {
+		return err
+	}
+	if err := publishMembershipChange(ctx, qtx, workspaceID, user.ID); err != nil {
+		return err
+	}
+
+	owners, err := qtx.CountWorkspaceOwners(ctx, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to count workspace owners: %w", err)
+	}
+	if owners == 0 {
+		return fmt.Errorf("%w: a workspace must keep at least one owner", ErrInvalid)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit workspace members: %w", err)
+	}
+	return nil
+}
+
+// publishMembershipChange announces a change to the user's membership through
+// q. Inside a transaction it is delivered only when the transaction commits.
+func publishMembershipChange(ctx context.Context, q *sql.Queries, workspaceID, userID int32) error {
+	payload, err := json.Marshal(MembershipChange{WorkspaceID: workspaceID, UserID: userID})
+	if err != nil {
+		return err
+	}
+	if err := q.NotifyMembershipChanged(ctx, string(payload)); err != nil {
+		return fmt.Errorf("failed to publish membership change: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Role is what a member may do in a workspace. Each role includes the
+// permissions of the roles below it.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleExecutor Role = "executor"
+	RoleEditor   Role = "editor"
+	RoleOwner    Role = "owner"
+)
+
+var roleRanks = map[Role]int{
+	RoleViewer:   1,
+	RoleExecutor: 2,
+	RoleEditor:   3,
+	RoleOwner:    4,
+}
+
+// MembershipChangesChannel is the Postgres channel on which membership
+// changes are announced, so that replicas drop the roles they cached.
+const MembershipChangesChannel = "wasmorph_members"
+
+// MembershipChange is the payload of a MembershipChangesChannel
+// notification.
+type MembershipChange struct {
+	WorkspaceID int32 `json:"workspace_id"`
+	UserID      int32 `json:"user_id"`
+}
+
+var (
+	ErrNotFound  = errors.New("workspace not found")
+	ErrForbidden = errors.New("forbidden")
+	// ErrUserNotFound means the user named in a member change does not
+	// exist, or is not a member when it must be.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInvalid means a request is malformed or would leave the workspace
+	// in an invalid state.
+	ErrInvalid = errors.New("invalid")
+)
+
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := roleRanks[role]; !ok {
+		return "", fmt.Errorf("%w: role must be one of owner, editor, executor or viewer", ErrInvalid)
+	}
+	return role, nil
+}
+
+// Allows reports whether a member with role r may do what requires role
+// required.
+func (r Role) Allows(required Role) bool {
+	return roleRanks[r] >= roleRanks[required]
+}
+
+// Require returns ErrForbidden unless role r allows what requires role
+// required.
+func (r Role) Require(required Role) error {
+	if !r.Allows(required) {
+		return fmt.Errorf("%w: requires the %s role", ErrForbidden, required)
+	}
+	return nil
+}
+
+// Caller is the user a service method acts for and the workspace it acts
+// in. A zero WorkspaceID selects the user's personal workspace.
+type Caller struct {
+	UserID      int32
+	WorkspaceID int32
+}
+
+// Authorize checks that the caller holds at least the required role in their
+// workspace and returns the workspace ID. Workspaces the caller is not a
+// member of are reported as not found.
+func Authorize(ctx context.Context, q *sql.Queries, caller Caller, required Role) (int32, error) {
+	workspaceID, role, err := Membership(ctx, q, caller)
+	if err != nil {
+		return 0, err
+	}
+	if err := role.Require(required); err != nil {
+		return 0, err
+	}
+	return workspaceID, nil
+}
+
+// Membership returns the caller's workspace ID and their role in it.
+// Workspaces the caller is not a member of are reported as not found.
+func Membership(ctx context.Context, q *sql.Queries, caller Caller) (int32, Role, error) {
+	workspaceID := caller.WorkspaceID
+	if workspaceID == 0 {
+		personal, err := q.GetPersonalWorkspaceID(ctx, pgtype.Int4{Int32: caller.UserID, Valid: true})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, "", ErrNotFound
+		}
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to find personal workspace: %w", err)
+		}
+		workspaceID = personal
+	}
+
+	role, err := q.GetWorkspaceRole(ctx, sql.GetWorkspaceRoleParams{
+		WorkspaceID: workspaceID,
+		UserID:      caller.UserID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, "", ErrNotFound
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to check workspace membership: %w", err)
+	}
+	return workspaceID, Role(role), nil
+}
@@ -0,0 +1,27 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleAllows(t *testing.T) {
+	assert.True(t, RoleOwner.Allows(RoleEditor))
+	assert.True(t, RoleEditor.Allows(RoleExecutor))
+	assert.True(t, RoleExecutor.Allows(RoleExecutor))
+	assert.False(t, RoleExecutor.Allows(RoleEditor))
+	assert.False(t, RoleViewer.Allows(RoleExecutor))
+	assert.False(t, Role("admin").Allows(RoleViewer))
+}
+
+func TestParseRole(t *testing.T) {
+	role, err := ParseRole("editor")
+	assert.NoError(t, err)
+	assert.Equal(t, RoleEditor, role)
+
+	_, err = ParseRole("admin")
+	assert.ErrorIs(t, err, ErrInvalid)
+	_, err = ParseRole("")
+	assert.ErrorIs(t, err, ErrInvalid)
+}
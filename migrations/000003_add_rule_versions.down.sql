@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS wasmorph.rule_versions;
+ALTER TABLE wasmorph.rules DROP COLUMN IF EXISTS version;
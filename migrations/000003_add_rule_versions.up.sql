@@ -0,0 +1,17 @@
+-- Every save of a rule is kept as an immutable, numbered version
+ALTER TABLE wasmorph.rules ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS wasmorph.rule_versions (
+    id SERIAL PRIMARY KEY,
+    rule_id INTEGER NOT NULL REFERENCES wasmorph.rules(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    source_code TEXT NOT NULL,
+    wasm_binary BYTEA NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE(rule_id, version)
+);
+
+-- Existing rules become version 1 of their history
+INSERT INTO wasmorph.rule_versions (rule_id, version, source_code, wasm_binary, created_at)
+SELECT id, version, source_code, wasm_binary, updated_at
+FROM wasmorph.rules;
@@ -0,0 +1,10 @@
+-- Movable named pointers (e.g. stable, canary) to rule versions
+CREATE TABLE IF NOT EXISTS wasmorph.rule_aliases (
+    rule_id INTEGER NOT NULL REFERENCES wasmorph.rules(id) ON DELETE CASCADE,
+    alias VARCHAR(64) NOT NULL,
+    version INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (rule_id, alias),
+    FOREIGN KEY (rule_id, version) REFERENCES wasmorph.rule_versions(rule_id, version) ON DELETE CASCADE
+);
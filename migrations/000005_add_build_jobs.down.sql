@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS wasmorph.idx_build_jobs_user_id;
+DROP TABLE IF EXISTS wasmorph.build_jobs;
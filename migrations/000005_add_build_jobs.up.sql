@@ -0,0 +1,15 @@
+-- Asynchronous rule compilation jobs
+CREATE TABLE IF NOT EXISTS wasmorph.build_jobs (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES wasmorph.users(id),
+    rule_name VARCHAR(255) NOT NULL,
+    source_code TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'succeeded', 'failed')),
+    error TEXT,
+    rule_version INTEGER,
+    created_at TIMESTAMP DEFAULT NOW(),
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX idx_build_jobs_user_id ON wasmorph.build_jobs(user_id);
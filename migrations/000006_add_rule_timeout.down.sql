@@ -0,0 +1 @@
+ALTER TABLE wasmorph.rules DROP COLUMN IF EXISTS timeout_ms;
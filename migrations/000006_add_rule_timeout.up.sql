@@ -0,0 +1,2 @@
+-- Upper bound for a single execution of the rule, in milliseconds
+ALTER TABLE wasmorph.rules ADD COLUMN timeout_ms INTEGER NOT NULL DEFAULT 5000;
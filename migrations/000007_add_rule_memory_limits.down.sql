@@ -0,0 +1,2 @@
+ALTER TABLE wasmorph.rules DROP COLUMN IF EXISTS max_output_bytes;
+ALTER TABLE wasmorph.rules DROP COLUMN IF EXISTS max_memory_pages;
@@ -0,0 +1,3 @@
+-- Memory cap in 64 KiB pages and the largest output a single execution may return
+ALTER TABLE wasmorph.rules ADD COLUMN max_memory_pages INTEGER NOT NULL DEFAULT 1024;
+ALTER TABLE wasmorph.rules ADD COLUMN max_output_bytes INTEGER NOT NULL DEFAULT 1048576;
@@ -0,0 +1,2 @@
+ALTER TABLE wasmorph.rules DROP COLUMN IF EXISTS max_instances;
+ALTER TABLE wasmorph.rules DROP COLUMN IF EXISTS min_instances;
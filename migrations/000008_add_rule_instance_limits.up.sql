@@ -0,0 +1,3 @@
+-- Size of the per-rule instance pool; max_instances = 0 means one per CPU
+ALTER TABLE wasmorph.rules ADD COLUMN min_instances INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE wasmorph.rules ADD COLUMN max_instances INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- Human-readable label, usage tracking and optional expiry for API keys
+ALTER TABLE wasmorph.api_keys ADD COLUMN label VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE wasmorph.api_keys ADD COLUMN last_used_at TIMESTAMP;
+ALTER TABLE wasmorph.api_keys ADD COLUMN expires_at TIMESTAMP;
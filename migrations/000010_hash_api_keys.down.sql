@@ -0,0 +1,9 @@
+-- Plaintext keys cannot be recovered, so every key stops working after this
+ALTER TABLE wasmorph.api_keys ADD COLUMN api_key VARCHAR(255);
+UPDATE wasmorph.api_keys SET api_key = key_hash;
+ALTER TABLE wasmorph.api_keys ALTER COLUMN api_key SET NOT NULL;
+ALTER TABLE wasmorph.api_keys ADD CONSTRAINT api_keys_api_key_key UNIQUE (api_key);
+CREATE INDEX idx_api_keys_api_key ON wasmorph.api_keys(api_key);
+
+ALTER TABLE wasmorph.api_keys DROP COLUMN key_prefix;
+ALTER TABLE wasmorph.api_keys DROP COLUMN key_hash;
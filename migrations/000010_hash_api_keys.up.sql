@@ -0,0 +1,15 @@
+-- API keys are stored as a SHA-256 hash; only a short prefix is kept to tell them apart
+ALTER TABLE wasmorph.api_keys ADD COLUMN key_hash VARCHAR(64);
+ALTER TABLE wasmorph.api_keys ADD COLUMN key_prefix VARCHAR(16);
+
+-- Existing keys keep working: hash them in place and show only their first characters
+UPDATE wasmorph.api_keys
+SET key_hash = encode(sha256(convert_to(api_key, 'UTF8')), 'hex'),
+    key_prefix = left(api_key, 4);
+
+ALTER TABLE wasmorph.api_keys ALTER COLUMN key_hash SET NOT NULL;
+ALTER TABLE wasmorph.api_keys ALTER COLUMN key_prefix SET NOT NULL;
+ALTER TABLE wasmorph.api_keys ADD CONSTRAINT api_keys_key_hash_key UNIQUE (key_hash);
+
+DROP INDEX IF EXISTS wasmorph.idx_api_keys_api_key;
+ALTER TABLE wasmorph.api_keys DROP COLUMN api_key;
@@ -0,0 +1,2 @@
+ALTER TABLE wasmorph.api_keys DROP COLUMN IF EXISTS rule_patterns;
+ALTER TABLE wasmorph.api_keys DROP COLUMN IF EXISTS scopes;
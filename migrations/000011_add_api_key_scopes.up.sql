@@ -0,0 +1,6 @@
+-- What an API key may do, and on which rules; no rule patterns means every rule
+ALTER TABLE wasmorph.api_keys ADD COLUMN scopes TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE wasmorph.api_keys ADD COLUMN rule_patterns TEXT[] NOT NULL DEFAULT '{}';
+
+-- Existing keys had full access and keep it
+UPDATE wasmorph.api_keys SET scopes = ARRAY['rules:read', 'rules:write', 'rules:execute', 'keys:manage'];
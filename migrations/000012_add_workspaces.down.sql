@@ -0,0 +1,12 @@
+-- Fails if an author has rules of the same name in several workspaces
+ALTER TABLE wasmorph.build_jobs DROP COLUMN IF EXISTS workspace_id;
+
+DROP INDEX IF EXISTS wasmorph.idx_rules_workspace_id;
+ALTER TABLE wasmorph.rules DROP CONSTRAINT IF EXISTS rules_name_workspace_id_key;
+ALTER TABLE wasmorph.rules DROP COLUMN IF EXISTS workspace_id;
+ALTER TABLE wasmorph.rules ADD CONSTRAINT rules_name_user_id_key UNIQUE (name, user_id);
+
+DROP TRIGGER IF EXISTS users_create_personal_workspace ON wasmorph.users;
+DROP FUNCTION IF EXISTS wasmorph.create_personal_workspace();
+DROP TABLE IF EXISTS wasmorph.workspace_members;
+DROP TABLE IF EXISTS wasmorph.workspaces;
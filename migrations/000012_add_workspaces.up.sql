@@ -0,0 +1,58 @@
+-- Workspaces own rules; users take part in them through a role
+CREATE TABLE IF NOT EXISTS wasmorph.workspaces (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    -- Set for the workspace every user gets on sign-up
+    personal_user_id INTEGER UNIQUE REFERENCES wasmorph.users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS wasmorph.workspace_members (
+    workspace_id INTEGER NOT NULL REFERENCES wasmorph.workspaces(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES wasmorph.users(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'editor', 'executor', 'viewer')),
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX idx_workspace_members_user_id ON wasmorph.workspace_members(user_id);
+
+CREATE OR REPLACE FUNCTION wasmorph.create_personal_workspace() RETURNS TRIGGER AS $$
+BEGIN
+    WITH workspace AS (
+        INSERT INTO wasmorph.workspaces (name, personal_user_id)
+        VALUES (NEW.username, NEW.id)
+        RETURNING id
+    )
+    INSERT INTO wasmorph.workspace_members (workspace_id, user_id, role)
+    SELECT id, NEW.id, 'owner' FROM workspace;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_create_personal_workspace
+AFTER INSERT ON wasmorph.users
+FOR EACH ROW EXECUTE FUNCTION wasmorph.create_personal_workspace();
+
+-- Existing users get their personal workspace, which takes over their rules
+INSERT INTO wasmorph.workspaces (name, personal_user_id)
+SELECT username, id FROM wasmorph.users;
+
+INSERT INTO wasmorph.workspace_members (workspace_id, user_id, role)
+SELECT id, personal_user_id, 'owner' FROM wasmorph.workspaces;
+
+-- rules.user_id is kept as the rule's author
+ALTER TABLE wasmorph.rules ADD COLUMN workspace_id INTEGER REFERENCES wasmorph.workspaces(id);
+UPDATE wasmorph.rules r SET workspace_id = w.id
+FROM wasmorph.workspaces w
+WHERE w.personal_user_id = r.user_id;
+ALTER TABLE wasmorph.rules ALTER COLUMN workspace_id SET NOT NULL;
+ALTER TABLE wasmorph.rules DROP CONSTRAINT rules_name_user_id_key;
+ALTER TABLE wasmorph.rules ADD CONSTRAINT rules_name_workspace_id_key UNIQUE (name, workspace_id);
+CREATE INDEX idx_rules_workspace_id ON wasmorph.rules(workspace_id);
+
+ALTER TABLE wasmorph.build_jobs ADD COLUMN workspace_id INTEGER REFERENCES wasmorph.workspaces(id);
+UPDATE wasmorph.build_jobs b SET workspace_id = w.id
+FROM wasmorph.workspaces w
+WHERE w.personal_user_id = b.user_id;
+ALTER TABLE wasmorph.build_jobs ALTER COLUMN workspace_id SET NOT NULL;
@@ -0,0 +1,15 @@
+-- Login sessions; access tokens name their session so that it can be revoked
+CREATE TABLE IF NOT EXISTS wasmorph.sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES wasmorph.users(id) ON DELETE CASCADE,
+    refresh_token_hash VARCHAR(64) NOT NULL UNIQUE,
+    -- The refresh token replaced by the last refresh; it being used again means it was stolen
+    previous_token_hash VARCHAR(64),
+    created_at TIMESTAMP DEFAULT NOW(),
+    refreshed_at TIMESTAMP DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_sessions_user_id ON wasmorph.sessions(user_id);
+CREATE INDEX idx_sessions_previous_token_hash ON wasmorph.sessions(previous_token_hash);
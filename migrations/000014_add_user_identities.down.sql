@@ -0,0 +1 @@
+DROP TABLE IF EXISTS wasmorph.user_identities;
@@ -0,0 +1,11 @@
+-- Accounts at an OpenID provider that log in as a wasmorph user
+CREATE TABLE IF NOT EXISTS wasmorph.user_identities (
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES wasmorph.users(id) ON DELETE CASCADE,
+    email VARCHAR(255),
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON wasmorph.user_identities(user_id);
@@ -0,0 +1 @@
+ALTER TABLE wasmorph.users DROP COLUMN IF EXISTS is_admin;
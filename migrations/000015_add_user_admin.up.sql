@@ -0,0 +1,2 @@
+-- Admins manage other users through the admin API
+ALTER TABLE wasmorph.users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
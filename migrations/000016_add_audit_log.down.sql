@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS wasmorph.audit_log;
+DROP FUNCTION IF EXISTS wasmorph.audit_log_append_only();
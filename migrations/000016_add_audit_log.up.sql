@@ -0,0 +1,28 @@
+-- Append-only record of who changed rules and credentials. There are no
+-- foreign keys so that entries outlive the users, keys and workspaces they name.
+CREATE TABLE IF NOT EXISTS wasmorph.audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    actor_user_id INTEGER,
+    actor_api_key_id INTEGER,
+    source_ip VARCHAR(64),
+    workspace_id INTEGER,
+    action VARCHAR(64) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    detail TEXT,
+    version_before INTEGER,
+    version_after INTEGER
+);
+
+CREATE INDEX idx_audit_log_workspace_id ON wasmorph.audit_log(workspace_id, id);
+CREATE INDEX idx_audit_log_actor_user_id ON wasmorph.audit_log(actor_user_id, id);
+
+CREATE OR REPLACE FUNCTION wasmorph.audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'wasmorph.audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+BEFORE UPDATE OR DELETE ON wasmorph.audit_log
+FOR EACH ROW EXECUTE FUNCTION wasmorph.audit_log_append_only();
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS wasmorph.idx_rules_source_search;
+DROP INDEX IF EXISTS wasmorph.idx_rules_workspace_updated;
+DROP INDEX IF EXISTS wasmorph.idx_rules_workspace_created;
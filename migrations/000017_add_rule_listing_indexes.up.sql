@@ -0,0 +1,5 @@
+-- Indexes for paging through a workspace's rules in each sort order, and for
+-- full-text search over their source
+CREATE INDEX idx_rules_workspace_created ON wasmorph.rules(workspace_id, created_at, id) WHERE is_active = true;
+CREATE INDEX idx_rules_workspace_updated ON wasmorph.rules(workspace_id, updated_at, id) WHERE is_active = true;
+CREATE INDEX idx_rules_source_search ON wasmorph.rules USING GIN (to_tsvector('simple', source_code)) WHERE is_active = true;
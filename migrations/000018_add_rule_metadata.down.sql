@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS wasmorph.idx_rules_labels;
+DROP INDEX IF EXISTS wasmorph.idx_rules_tags;
+
+ALTER TABLE wasmorph.rules DROP COLUMN IF EXISTS labels;
+ALTER TABLE wasmorph.rules DROP COLUMN IF EXISTS tags;
+ALTER TABLE wasmorph.rules DROP COLUMN IF EXISTS description;
@@ -0,0 +1,7 @@
+-- What a rule is for, and free-form tags and key/value labels to group rules by
+ALTER TABLE wasmorph.rules ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE wasmorph.rules ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE wasmorph.rules ADD COLUMN labels JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_rules_tags ON wasmorph.rules USING GIN (tags);
+CREATE INDEX idx_rules_labels ON wasmorph.rules USING GIN (labels);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS wasmorph.idx_rules_deleted;
+
+ALTER TABLE wasmorph.rules DROP COLUMN IF EXISTS deleted_at;
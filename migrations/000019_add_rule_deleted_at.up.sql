@@ -0,0 +1,6 @@
+-- When a rule was deleted, so that deleted rules can be listed, restored and
+-- purged once they are past retention
+ALTER TABLE wasmorph.rules ADD COLUMN deleted_at TIMESTAMP;
+UPDATE wasmorph.rules SET deleted_at = updated_at WHERE is_active = false;
+
+CREATE INDEX idx_rules_deleted ON wasmorph.rules(deleted_at, id) WHERE is_active = false;
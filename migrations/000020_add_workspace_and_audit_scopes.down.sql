@@ -0,0 +1,2 @@
+UPDATE wasmorph.api_keys
+SET scopes = array_remove(array_remove(scopes, 'workspaces:manage'), 'audit:read');
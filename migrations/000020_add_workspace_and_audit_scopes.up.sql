@@ -0,0 +1,5 @@
+-- Workspace management and the audit log used to need keys:manage; keys that
+-- had it keep that access
+UPDATE wasmorph.api_keys
+SET scopes = scopes || ARRAY['workspaces:manage', 'audit:read']
+WHERE 'keys:manage' = ANY(scopes);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS wasmorph.idx_build_jobs_unfinished;
+
+ALTER TABLE wasmorph.build_jobs DROP COLUMN IF EXISTS instance_id;
@@ -0,0 +1,5 @@
+-- The server process that queued a build, so that builds left unfinished by a
+-- process that stopped can be failed
+ALTER TABLE wasmorph.build_jobs ADD COLUMN instance_id BIGINT;
+
+CREATE INDEX idx_build_jobs_unfinished ON wasmorph.build_jobs(instance_id) WHERE status IN ('queued', 'running');
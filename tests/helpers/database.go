@@ -2,6 +2,7 @@ package helpers
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"os"
 
@@ -53,9 +54,32 @@ func (dc *DatabaseClient) AddAPIKey(apiKey, username string) error {
 	}
 
 	_, err = dc.db.Exec(`
-		INSERT INTO wasmorph.api_keys (api_key, user_id, is_active) 
-		VALUES ($1, $2, $3)
-		ON CONFLICT (api_key) DO NOTHING`,
+		INSERT INTO wasmorph.api_keys (key_hash, key_prefix, user_id, is_active, scopes)
+		VALUES (encode(sha256(convert_to($1, 'UTF8')), 'hex'), left($1, 4), $2, $3,
+			ARRAY['rules:read', 'rules:write', 'rules:execute', 'keys:manage', 'workspaces:manage', 'audit:read'])
+		ON CONFLICT (key_hash) DO NOTHING`,
+		apiKey, userID, true)
+	return err
+}
+
+// AddAdminAPIKey makes the user an admin and gives them an API key that may
+// use the admin API.
+func (dc *DatabaseClient) AddAdminAPIKey(apiKey, username string) error {
+	var userID int32
+	err := dc.db.QueryRow(`
+		UPDATE wasmorph.users SET is_admin = true
+		WHERE username = $1
+		RETURNING id`,
+		username).Scan(&userID)
+	if err != nil {
+		return fmt.Errorf("failed to find user %s: %w", username, err)
+	}
+
+	_, err = dc.db.Exec(`
+		INSERT INTO wasmorph.api_keys (key_hash, key_prefix, user_id, is_active, scopes)
+		VALUES (encode(sha256(convert_to($1, 'UTF8')), 'hex'), left($1, 4), $2, $3,
+			ARRAY['rules:read', 'rules:write', 'rules:execute', 'keys:manage', 'workspaces:manage', 'audit:read', 'users:manage'])
+		ON CONFLICT (key_hash) DO NOTHING`,
 		apiKey, userID, true)
 	return err
 }
@@ -69,8 +93,89 @@ func (dc *DatabaseClient) GetUserID(username string) (int32, error) {
 	return userID, err
 }
 
+// GetPersonalWorkspaceID returns the ID of the workspace created for the user
+// on sign-up.
+func (dc *DatabaseClient) GetPersonalWorkspaceID(username string) (int32, error) {
+	var workspaceID int32
+	err := dc.db.QueryRow(`
+		SELECT w.id FROM wasmorph.workspaces w
+		JOIN wasmorph.users u ON u.id = w.personal_user_id
+		WHERE u.username = $1`,
+		username).Scan(&workspaceID)
+	return workspaceID, err
+}
+
+// AddBuildJob records a build of the rule in the user's personal workspace
+// with the given status, as if queued by the server instance instanceID; an
+// invalid instanceID stands for a build recorded before instances were.
+func (dc *DatabaseClient) AddBuildJob(username, ruleName, status string, instanceID sql.NullInt64) (int, error) {
+	var buildID int
+	err := dc.db.QueryRow(`
+		INSERT INTO wasmorph.build_jobs (user_id, workspace_id, rule_name, source_code, status, instance_id)
+		SELECT u.id, w.id, $2, '', $3, $4
+		FROM wasmorph.users u
+		JOIN wasmorph.workspaces w ON w.personal_user_id = u.id
+		WHERE u.username = $1
+		RETURNING id`,
+		username, ruleName, status, instanceID).Scan(&buildID)
+	return buildID, err
+}
+
+// DeleteRuleAsOtherReplica deletes a rule from the user's personal workspace
+// the way another server sharing the database would: directly in the
+// database, followed by the rule change notification.
+func (dc *DatabaseClient) DeleteRuleAsOtherReplica(username, ruleName string) error {
+	workspaceID, err := dc.GetPersonalWorkspaceID(username)
+	if err != nil {
+		return err
+	}
+
+	_, err = dc.db.Exec(`
+		UPDATE wasmorph.rules SET is_active = false, deleted_at = NOW(), updated_at = NOW()
+		WHERE name = $1 AND workspace_id = $2`,
+		ruleName, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]any{"workspace_id": workspaceID, "name": ruleName})
+	if err != nil {
+		return err
+	}
+	_, err = dc.db.Exec("SELECT pg_notify('wasmorph_rules', $1)", string(payload))
+	return err
+}
+
+// RuleStored reports whether any row, active or deleted, is kept for the rule
+// in the user's personal workspace.
+func (dc *DatabaseClient) RuleStored(username, ruleName string) (bool, error) {
+	workspaceID, err := dc.GetPersonalWorkspaceID(username)
+	if err != nil {
+		return false, err
+	}
+
+	var stored bool
+	err = dc.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM wasmorph.rules WHERE name = $1 AND workspace_id = $2)`,
+		ruleName, workspaceID).Scan(&stored)
+	return stored, err
+}
+
 func (dc *DatabaseClient) Cleanup() error {
-	_, err := dc.db.Exec("DELETE FROM wasmorph.rules")
+	// The audit log refuses DELETE, but not TRUNCATE.
+	_, err := dc.db.Exec("TRUNCATE wasmorph.audit_log")
+	if err != nil {
+		return err
+	}
+	_, err = dc.db.Exec("DELETE FROM wasmorph.build_jobs")
+	if err != nil {
+		return err
+	}
+	_, err = dc.db.Exec("DELETE FROM wasmorph.rules")
+	if err != nil {
+		return err
+	}
+	_, err = dc.db.Exec("DELETE FROM wasmorph.workspaces")
 	if err != nil {
 		return err
 	}
@@ -82,10 +187,38 @@ func (dc *DatabaseClient) Cleanup() error {
 	return err
 }
 
+// ExpireAPIKey moves the expiry of the API key with the given ID into the past.
+func (dc *DatabaseClient) ExpireAPIKey(keyID int) error {
+	_, err := dc.db.Exec(`
+		UPDATE wasmorph.api_keys SET expires_at = NOW() - INTERVAL '1 minute'
+		WHERE id = $1`,
+		keyID)
+	return err
+}
+
+// APIKeyStoredInClear reports whether any column of the API key with the
+// given ID holds the key itself.
+func (dc *DatabaseClient) APIKeyStoredInClear(keyID int, apiKey string) (bool, error) {
+	var found bool
+	err := dc.db.QueryRow(`
+		SELECT position($2 IN k::text) > 0
+		FROM wasmorph.api_keys k
+		WHERE id = $1`,
+		keyID, apiKey).Scan(&found)
+	return found, err
+}
+
 func (dc *DatabaseClient) CleanupAll() error {
+	// The audit log refuses DELETE, but not TRUNCATE.
+	if _, err := dc.db.Exec("TRUNCATE wasmorph.audit_log"); err != nil {
+		return fmt.Errorf("failed to clean table wasmorph.audit_log: %w", err)
+	}
+
 	// Clean up all tables in the correct order (respecting foreign key constraints)
 	tables := []string{
+		"wasmorph.build_jobs",
 		"wasmorph.rules",
+		"wasmorph.workspaces",
 		"wasmorph.api_keys",
 		"wasmorph.users",
 	}
@@ -129,7 +262,7 @@ func (dc *DatabaseClient) VerifyUserAndAPIKey(username, apiKey string) error {
 	}
 
 	var apiKeyCount int
-	err = dc.db.QueryRow("SELECT COUNT(*) FROM wasmorph.api_keys WHERE api_key = $1", apiKey).Scan(&apiKeyCount)
+	err = dc.db.QueryRow("SELECT COUNT(*) FROM wasmorph.api_keys WHERE key_hash = encode(sha256(convert_to($1, 'UTF8')), 'hex')", apiKey).Scan(&apiKeyCount)
 	if err != nil {
 		return err
 	}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 )
 
@@ -47,6 +48,83 @@ func (c *HTTPClient) CreateRule(apiKey, name, code string) (*http.Response, erro
 	return c.client.Do(req)
 }
 
+// SaveRule posts the payload as is, for requests that carry more than a name
+// and code.
+func (c *HTTPClient) SaveRule(apiKey string, payload map[string]any) (*http.Response, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/rules", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) GetRule(apiKey, ruleName string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", c.baseURL+"/api/v1/rules/"+ruleName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+// GetRuleWithRequestID gets the rule, sending requestID as the request's
+// X-Request-Id.
+func (c *HTTPClient) GetRuleWithRequestID(apiKey, ruleName, requestID string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", c.baseURL+"/api/v1/rules/"+ruleName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("X-Request-Id", requestID)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) CreateRuleAsync(apiKey, name, code string) (*http.Response, error) {
+	payload := map[string]string{
+		"name": name,
+		"code": code,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/rules?async=true", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) GetBuild(apiKey string, buildID int) (*http.Response, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v1/builds/%d", c.baseURL, buildID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
 func (c *HTTPClient) ListRules(apiKey string) (*http.Response, error) {
 	req, err := http.NewRequest("GET", c.baseURL+"/api/v1/rules", nil)
 	if err != nil {
@@ -75,6 +153,23 @@ func (c *HTTPClient) ExecuteRule(apiKey, ruleName string, input map[string]any)
 	return c.client.Do(req)
 }
 
+func (c *HTTPClient) ExecuteRuleWithParams(apiKey, ruleName string, params url.Values, input map[string]any) (*http.Response, error) {
+	jsonData, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/rules/"+ruleName+"/execute?"+params.Encode(), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
 func (c *HTTPClient) DeleteRule(apiKey, ruleName string) (*http.Response, error) {
 	req, err := http.NewRequest("DELETE", c.baseURL+"/api/v1/rules/"+ruleName, nil)
 	if err != nil {
@@ -86,6 +181,386 @@ func (c *HTTPClient) DeleteRule(apiKey, ruleName string) (*http.Response, error)
 	return c.client.Do(req)
 }
 
+func (c *HTTPClient) RestoreRule(apiKey, ruleName string) (*http.Response, error) {
+	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/rules/"+ruleName+"/restore", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) PurgeRule(apiKey, ruleName string) (*http.Response, error) {
+	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/rules/"+ruleName+"/purge", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) ListRuleVersions(apiKey, ruleName string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", c.baseURL+"/api/v1/rules/"+ruleName+"/versions", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) RollbackRule(apiKey, ruleName string, version int) (*http.Response, error) {
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v1/rules/%s/rollback/%d", c.baseURL, ruleName, version), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) GetRuleLimits(apiKey, ruleName string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", c.baseURL+"/api/v1/rules/"+ruleName+"/limits", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) UpdateRuleLimits(apiKey, ruleName string, limits map[string]any) (*http.Response, error) {
+	jsonData, err := json.Marshal(limits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("PATCH", c.baseURL+"/api/v1/rules/"+ruleName+"/limits", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) ListRuleAliases(apiKey, ruleName string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", c.baseURL+"/api/v1/rules/"+ruleName+"/aliases", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) SetRuleAlias(apiKey, ruleName, alias string, version int) (*http.Response, error) {
+	jsonData, err := json.Marshal(map[string]int{"version": version})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("PUT", c.baseURL+"/api/v1/rules/"+ruleName+"/aliases/"+alias, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) DeleteRuleAlias(apiKey, ruleName, alias string) (*http.Response, error) {
+	req, err := http.NewRequest("DELETE", c.baseURL+"/api/v1/rules/"+ruleName+"/aliases/"+alias, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) CreateAPIKey(apiKey string, payload map[string]any) (*http.Response, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/api-keys", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) ListAPIKeys(apiKey string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", c.baseURL+"/api/v1/api-keys", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) RevokeAPIKey(apiKey string, keyID int) (*http.Response, error) {
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/api/v1/api-keys/%d", c.baseURL, keyID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) CreateWorkspace(apiKey, name string) (*http.Response, error) {
+	jsonData, err := json.Marshal(map[string]string{"name": name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/workspaces", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) ListWorkspaces(apiKey string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", c.baseURL+"/api/v1/workspaces", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) ListWorkspaceMembers(apiKey string, workspaceID int) (*http.Response, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v1/workspaces/%d/members", c.baseURL, workspaceID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) SetWorkspaceMember(apiKey string, workspaceID int, username, role string) (*http.Response, error) {
+	jsonData, err := json.Marshal(map[string]string{"role": role})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/api/v1/workspaces/%d/members/%s", c.baseURL, workspaceID, username), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) RemoveWorkspaceMember(apiKey string, workspaceID int, username string) (*http.Response, error) {
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/api/v1/workspaces/%d/members/%s", c.baseURL, workspaceID, username), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+// CreateRuleInWorkspace is CreateRule in the workspace with the given ID
+// instead of the personal workspace.
+func (c *HTTPClient) CreateRuleInWorkspace(apiKey string, workspaceID int, name, code string) (*http.Response, error) {
+	jsonData, err := json.Marshal(map[string]string{"name": name, "code": code})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/rules", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("X-Workspace-ID", fmt.Sprint(workspaceID))
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) ListRulesPage(apiKey string, params url.Values) (*http.Response, error) {
+	req, err := http.NewRequest("GET", c.baseURL+"/api/v1/rules?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) ListRulesInWorkspace(apiKey string, workspaceID int) (*http.Response, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v1/rules?workspace=%d", c.baseURL, workspaceID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) TransferRule(apiKey, ruleName string, payload map[string]any) (*http.Response, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/rules/"+ruleName+"/transfer", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+// UpdateRule sends payload to the rule with the given method, PUT or PATCH.
+// An empty ifMatch leaves out the If-Match header.
+func (c *HTTPClient) UpdateRule(apiKey, method, ruleName, ifMatch string, payload map[string]any) (*http.Response, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+"/api/v1/rules/"+ruleName, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) RenameRule(apiKey, ruleName, newName, ifMatch string) (*http.Response, error) {
+	jsonData, err := json.Marshal(map[string]string{"name": newName})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/rules/"+ruleName+"/rename", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) ListUsers(apiKey string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", c.baseURL+"/api/v1/admin/users", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) CreateUser(apiKey string, payload map[string]any) (*http.Response, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/admin/users", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) UpdateUser(apiKey string, userID int, payload map[string]any) (*http.Response, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("PATCH", fmt.Sprintf("%s/api/v1/admin/users/%d", c.baseURL, userID), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
+func (c *HTTPClient) ResetUserCredentials(apiKey string, userID int, password string) (*http.Response, error) {
+	jsonData, err := json.Marshal(map[string]string{"password": password})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v1/admin/users/%d/reset-credentials", c.baseURL, userID), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
+
 func (c *HTTPClient) Register(username, email, password string) (*http.Response, error) {
 	payload := fmt.Sprintf("username=%s&email=%s&password=%s", username, email, password)
 	req, err := http.NewRequest("POST", c.baseURL+"/api/v1/auth/register", bytes.NewBufferString(payload))
@@ -106,6 +581,35 @@ func (c *HTTPClient) Login(username, password string) (*http.Response, error) {
 	return c.client.Do(req)
 }
 
+// Me returns the user of the session whose cookies are given.
+func (c *HTTPClient) Me(cookies []*http.Cookie) (*http.Response, error) {
+	return c.withCookies("GET", "/api/v1/auth/me", cookies)
+}
+
+func (c *HTTPClient) Refresh(cookies []*http.Cookie) (*http.Response, error) {
+	return c.withCookies("POST", "/api/v1/auth/refresh", cookies)
+}
+
+func (c *HTTPClient) Logout(cookies []*http.Cookie, all bool) (*http.Response, error) {
+	path := "/api/v1/auth/logout"
+	if all {
+		path += "?all=true"
+	}
+	return c.withCookies("POST", path, cookies)
+}
+
+func (c *HTTPClient) withCookies(method, path string, cookies []*http.Cookie) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	return c.client.Do(req)
+}
+
 func (c *HTTPClient) HealthCheck() (*http.Response, error) {
 	req, err := http.NewRequest("GET", c.baseURL+"/health", nil)
 	if err != nil {
@@ -114,3 +618,14 @@ func (c *HTTPClient) HealthCheck() (*http.Response, error) {
 
 	return c.client.Do(req)
 }
+
+func (c *HTTPClient) ListAuditEvents(apiKey string, params url.Values) (*http.Response, error) {
+	req, err := http.NewRequest("GET", c.baseURL+"/api/v1/audit?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	return c.client.Do(req)
+}
@@ -0,0 +1,188 @@
+package rules
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Gmacem/wasmorph/tests/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type AdminTestSuite struct {
+	suite.Suite
+	dbClient    *helpers.DatabaseClient
+	httpClient  *helpers.HTTPClient
+	adminAPIKey string
+	userAPIKey  string
+	userID      int
+}
+
+type adminUserResponse struct {
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	IsActive    bool   `json:"is_active"`
+	IsAdmin     bool   `json:"is_admin"`
+	RuleCount   int    `json:"rule_count"`
+	APIKeyCount int    `json:"api_key_count"`
+}
+
+func (suite *AdminTestSuite) SetupSuite() {
+	var err error
+	suite.dbClient, err = helpers.NewDatabaseClient()
+	require.NoError(suite.T(), err)
+	suite.httpClient = helpers.NewHTTPClient()
+}
+
+func (suite *AdminTestSuite) TearDownSuite() {
+	if suite.dbClient != nil {
+		suite.dbClient.Close()
+	}
+}
+
+func (suite *AdminTestSuite) SetupTest() {
+	suite.dbClient.CleanupAll()
+
+	suite.adminAPIKey = "test-api-key-admin"
+	suite.userAPIKey = "test-api-key-admin-user"
+
+	require.NoError(suite.T(), suite.dbClient.AddUser("testadmin", "hashed-password"))
+	require.NoError(suite.T(), suite.dbClient.AddAdminAPIKey(suite.adminAPIKey, "testadmin"))
+	require.NoError(suite.T(), suite.dbClient.AddUser("testuser-admin", "hashed-password"))
+	require.NoError(suite.T(), suite.dbClient.AddAPIKey(suite.userAPIKey, "testuser-admin"))
+
+	userID, err := suite.dbClient.GetUserID("testuser-admin")
+	require.NoError(suite.T(), err)
+	suite.userID = int(userID)
+}
+
+func (suite *AdminTestSuite) listUsers() map[string]adminUserResponse {
+	resp, err := suite.httpClient.ListUsers(suite.adminAPIKey)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var users []adminUserResponse
+	require.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&users))
+
+	byName := make(map[string]adminUserResponse)
+	for _, user := range users {
+		byName[user.Username] = user
+	}
+	return byName
+}
+
+func (suite *AdminTestSuite) TestListUsersWithCounts() {
+	resp, err := suite.httpClient.CreateRule(suite.userAPIKey, "admin-counted-rule", transformProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	users := suite.listUsers()
+	user := users["testuser-admin"]
+	assert.Equal(suite.T(), suite.userID, user.ID)
+	assert.True(suite.T(), user.IsActive)
+	assert.False(suite.T(), user.IsAdmin)
+	assert.Equal(suite.T(), 1, user.RuleCount)
+	assert.Equal(suite.T(), 1, user.APIKeyCount)
+	assert.True(suite.T(), users["testadmin"].IsAdmin)
+}
+
+func (suite *AdminTestSuite) TestNonAdminIsRefused() {
+	resp, err := suite.httpClient.ListUsers(suite.userAPIKey)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+}
+
+func (suite *AdminTestSuite) TestCreateUser() {
+	resp, err := suite.httpClient.CreateUser(suite.adminAPIKey, map[string]any{
+		"username": "created-by-admin",
+		"email":    "created@example.com",
+		"password": "initial-password",
+	})
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	var user adminUserResponse
+	require.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&user))
+	assert.Equal(suite.T(), "created-by-admin", user.Username)
+	assert.Equal(suite.T(), "created@example.com", user.Email)
+	assert.True(suite.T(), user.IsActive)
+
+	resp, err = suite.httpClient.Login("created-by-admin", "initial-password")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.CreateUser(suite.adminAPIKey, map[string]any{
+		"username": "created-by-admin",
+		"password": "other-password",
+	})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusConflict, resp.StatusCode)
+}
+
+func (suite *AdminTestSuite) TestDeactivateAndReactivate() {
+	resp, err := suite.httpClient.UpdateUser(suite.adminAPIKey, suite.userID, map[string]any{"is_active": false})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.ListRules(suite.userAPIKey)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode, "API keys of deactivated users must be refused")
+	assert.False(suite.T(), suite.listUsers()["testuser-admin"].IsActive)
+
+	resp, err = suite.httpClient.UpdateUser(suite.adminAPIKey, suite.userID, map[string]any{"is_active": true})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.ListRules(suite.userAPIKey)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func (suite *AdminTestSuite) TestAdminCannotDeactivateThemselves() {
+	adminID, err := suite.dbClient.GetUserID("testadmin")
+	require.NoError(suite.T(), err)
+
+	resp, err := suite.httpClient.UpdateUser(suite.adminAPIKey, int(adminID), map[string]any{"is_active": false})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = suite.httpClient.UpdateUser(suite.adminAPIKey, 999999, map[string]any{"is_active": false})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *AdminTestSuite) TestResetCredentials() {
+	resp, err := suite.httpClient.ResetUserCredentials(suite.adminAPIKey, suite.userID, "new-password")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusNoContent, resp.StatusCode)
+
+	resp, err = suite.httpClient.ListRules(suite.userAPIKey)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode, "resetting credentials must revoke API keys")
+
+	resp, err = suite.httpClient.Login("testuser-admin", "new-password")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func TestAdminTestSuite(t *testing.T) {
+	suite.Run(t, new(AdminTestSuite))
+}
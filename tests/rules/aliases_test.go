@@ -0,0 +1,162 @@
+package rules
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Gmacem/wasmorph/tests/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type RuleAliasesTestSuite struct {
+	suite.Suite
+	dbClient   *helpers.DatabaseClient
+	httpClient *helpers.HTTPClient
+	apiKey     string
+	ruleName   string
+}
+
+func (suite *RuleAliasesTestSuite) SetupSuite() {
+	var err error
+	suite.dbClient, err = helpers.NewDatabaseClient()
+	require.NoError(suite.T(), err)
+	suite.httpClient = helpers.NewHTTPClient()
+}
+
+func (suite *RuleAliasesTestSuite) TearDownSuite() {
+	if suite.dbClient != nil {
+		suite.dbClient.Close()
+	}
+}
+
+func (suite *RuleAliasesTestSuite) SetupTest() {
+	suite.dbClient.CleanupAll()
+
+	suite.apiKey = "test-api-key-aliases"
+	suite.ruleName = "aliased-rule"
+	username := "testuser-aliases"
+
+	err := suite.dbClient.AddUser(username, "hashed-password")
+	require.NoError(suite.T(), err)
+
+	err = suite.dbClient.AddAPIKey(suite.apiKey, username)
+	require.NoError(suite.T(), err)
+
+	for _, code := range []string{versionOneProgram, versionTwoProgram} {
+		resp, err := suite.httpClient.CreateRule(suite.apiKey, suite.ruleName, code)
+		require.NoError(suite.T(), err)
+		resp.Body.Close()
+	}
+}
+
+func (suite *RuleAliasesTestSuite) execute(params url.Values) (int, string) {
+	resp, err := suite.httpClient.ExecuteRuleWithParams(suite.apiKey, suite.ruleName, params, map[string]any{})
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	require.NoError(suite.T(), err)
+
+	var response map[string]any
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return resp.StatusCode, string(bodyBytes)
+	}
+	result, _ := response["result"].(string)
+	return resp.StatusCode, result
+}
+
+func (suite *RuleAliasesTestSuite) setAlias(alias string, version int) {
+	resp, err := suite.httpClient.SetRuleAlias(suite.apiKey, suite.ruleName, alias, version)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func (suite *RuleAliasesTestSuite) TestExecutePinnedVersion() {
+	status, result := suite.execute(url.Values{"version": {"1"}})
+	assert.Equal(suite.T(), http.StatusOK, status)
+	assert.Equal(suite.T(), "v1", result)
+
+	status, result = suite.execute(url.Values{})
+	assert.Equal(suite.T(), http.StatusOK, status)
+	assert.Equal(suite.T(), "v2", result)
+}
+
+func (suite *RuleAliasesTestSuite) TestExecuteAlias() {
+	suite.setAlias("stable", 1)
+	suite.setAlias("canary", 2)
+
+	status, result := suite.execute(url.Values{"alias": {"stable"}})
+	assert.Equal(suite.T(), http.StatusOK, status)
+	assert.Equal(suite.T(), "v1", result)
+
+	status, result = suite.execute(url.Values{"alias": {"canary"}})
+	assert.Equal(suite.T(), http.StatusOK, status)
+	assert.Equal(suite.T(), "v2", result)
+
+	suite.setAlias("stable", 2)
+
+	status, result = suite.execute(url.Values{"alias": {"stable"}})
+	assert.Equal(suite.T(), http.StatusOK, status)
+	assert.Equal(suite.T(), "v2", result)
+}
+
+func (suite *RuleAliasesTestSuite) TestListAndDeleteAlias() {
+	suite.setAlias("stable", 1)
+
+	resp, err := suite.httpClient.ListRuleAliases(suite.apiKey, suite.ruleName)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var aliases []map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&aliases)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), aliases, 1)
+	assert.Equal(suite.T(), "stable", aliases[0]["alias"])
+	assert.Equal(suite.T(), float64(1), aliases[0]["version"])
+
+	deleteResp, err := suite.httpClient.DeleteRuleAlias(suite.apiKey, suite.ruleName, "stable")
+	require.NoError(suite.T(), err)
+	defer deleteResp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, deleteResp.StatusCode)
+
+	status, _ := suite.execute(url.Values{"alias": {"stable"}})
+	assert.Equal(suite.T(), http.StatusNotFound, status)
+}
+
+func (suite *RuleAliasesTestSuite) TestDeleteAliasOfDeletedRule() {
+	suite.setAlias("stable", 1)
+
+	resp, err := suite.httpClient.DeleteRule(suite.apiKey, suite.ruleName)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.DeleteRuleAlias(suite.apiKey, suite.ruleName, "stable")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode, "aliases of a deleted rule must be left for restore")
+}
+
+func (suite *RuleAliasesTestSuite) TestAliasToUnknownVersion() {
+	resp, err := suite.httpClient.SetRuleAlias(suite.apiKey, suite.ruleName, "stable", 42)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *RuleAliasesTestSuite) TestExecuteUnknownVersion() {
+	status, _ := suite.execute(url.Values{"version": {"42"}})
+	assert.Equal(suite.T(), http.StatusNotFound, status)
+}
+
+func TestRuleAliasesTestSuite(t *testing.T) {
+	suite.Run(t, new(RuleAliasesTestSuite))
+}
@@ -0,0 +1,317 @@
+package rules
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Gmacem/wasmorph/tests/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type APIKeysTestSuite struct {
+	suite.Suite
+	dbClient   *helpers.DatabaseClient
+	httpClient *helpers.HTTPClient
+	apiKey     string
+}
+
+type apiKeyResponse struct {
+	ID         int      `json:"id"`
+	Label      string   `json:"label"`
+	Key        string   `json:"key"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	LastUsedAt *string  `json:"last_used_at"`
+	ExpiresAt  *string  `json:"expires_at"`
+}
+
+func (suite *APIKeysTestSuite) SetupSuite() {
+	var err error
+	suite.dbClient, err = helpers.NewDatabaseClient()
+	require.NoError(suite.T(), err)
+	suite.httpClient = helpers.NewHTTPClient()
+}
+
+func (suite *APIKeysTestSuite) TearDownSuite() {
+	if suite.dbClient != nil {
+		suite.dbClient.Close()
+	}
+}
+
+func (suite *APIKeysTestSuite) SetupTest() {
+	suite.dbClient.CleanupAll()
+
+	suite.apiKey = "test-api-key-keys"
+	username := "testuser-keys"
+
+	err := suite.dbClient.AddUser(username, "hashed-password")
+	require.NoError(suite.T(), err)
+
+	err = suite.dbClient.AddAPIKey(suite.apiKey, username)
+	require.NoError(suite.T(), err)
+}
+
+func (suite *APIKeysTestSuite) createKey(payload map[string]any) apiKeyResponse {
+	resp, err := suite.httpClient.CreateAPIKey(suite.apiKey, payload)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	var key apiKeyResponse
+	err = json.NewDecoder(resp.Body).Decode(&key)
+	require.NoError(suite.T(), err)
+	return key
+}
+
+func (suite *APIKeysTestSuite) listKeys() []apiKeyResponse {
+	resp, err := suite.httpClient.ListAPIKeys(suite.apiKey)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var keys []apiKeyResponse
+	err = json.NewDecoder(resp.Body).Decode(&keys)
+	require.NoError(suite.T(), err)
+	return keys
+}
+
+func (suite *APIKeysTestSuite) TestCreateAndUseKey() {
+	key := suite.createKey(map[string]any{"label": "billing"})
+	assert.NotEmpty(suite.T(), key.Key)
+	assert.True(suite.T(), strings.HasPrefix(key.Key, key.Prefix+"_"), "key %q should start with its prefix %q", key.Key, key.Prefix)
+	assert.Equal(suite.T(), "billing", key.Label)
+	assert.Nil(suite.T(), key.ExpiresAt)
+
+	resp, err := suite.httpClient.ListRules(key.Key)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	for _, listed := range suite.listKeys() {
+		assert.Empty(suite.T(), listed.Key, "listed keys must not contain the secret")
+		if listed.ID == key.ID {
+			assert.Equal(suite.T(), key.Prefix, listed.Prefix)
+			assert.Equal(suite.T(), "billing", listed.Label)
+			assert.NotNil(suite.T(), listed.LastUsedAt)
+		}
+	}
+}
+
+func (suite *APIKeysTestSuite) TestKeyStoredHashed() {
+	key := suite.createKey(map[string]any{"label": "hashed"})
+
+	inClear, err := suite.dbClient.APIKeyStoredInClear(key.ID, key.Key)
+	require.NoError(suite.T(), err)
+	assert.False(suite.T(), inClear)
+}
+
+func (suite *APIKeysTestSuite) TestRevokeKey() {
+	key := suite.createKey(map[string]any{"label": "temporary"})
+
+	resp, err := suite.httpClient.RevokeAPIKey(suite.apiKey, key.ID)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusNoContent, resp.StatusCode)
+
+	resp, err = suite.httpClient.ListRules(key.Key)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode)
+
+	for _, listed := range suite.listKeys() {
+		assert.NotEqual(suite.T(), key.ID, listed.ID)
+	}
+
+	resp, err = suite.httpClient.RevokeAPIKey(suite.apiKey, key.ID)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *APIKeysTestSuite) TestCannotRevokeOtherUsersKey() {
+	err := suite.dbClient.AddUser("other-user", "hashed-password")
+	require.NoError(suite.T(), err)
+	err = suite.dbClient.AddAPIKey("other-user-key", "other-user")
+	require.NoError(suite.T(), err)
+
+	key := suite.createKey(map[string]any{"label": "mine"})
+
+	resp, err := suite.httpClient.RevokeAPIKey("other-user-key", key.ID)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+
+	resp, err = suite.httpClient.ListRules(key.Key)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func (suite *APIKeysTestSuite) TestExpiredKeyRejected() {
+	key := suite.createKey(map[string]any{
+		"label":      "expiring",
+		"expires_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+	})
+	assert.NotNil(suite.T(), key.ExpiresAt)
+
+	resp, err := suite.httpClient.ListRules(key.Key)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	err = suite.dbClient.ExpireAPIKey(key.ID)
+	require.NoError(suite.T(), err)
+
+	resp, err = suite.httpClient.ListRules(key.Key)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode)
+}
+
+func (suite *APIKeysTestSuite) TestCreateKeyExpiryInPast() {
+	resp, err := suite.httpClient.CreateAPIKey(suite.apiKey, map[string]any{
+		"expires_at": time.Now().Add(-time.Hour).Format(time.RFC3339),
+	})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+}
+
+func (suite *APIKeysTestSuite) createRule(name string) {
+	resp, err := suite.httpClient.CreateRule(suite.apiKey, name, versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+}
+
+func (suite *APIKeysTestSuite) TestDefaultScopes() {
+	key := suite.createKey(map[string]any{"label": "default"})
+	assert.ElementsMatch(suite.T(), []string{"rules:read", "rules:write", "rules:execute"}, key.Scopes)
+
+	resp, err := suite.httpClient.ListAPIKeys(key.Key)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode, "keys must not manage keys unless granted keys:manage")
+}
+
+func (suite *APIKeysTestSuite) TestExecuteOnlyKey() {
+	suite.createRule("billing-eu")
+	suite.createRule("shipping")
+
+	key := suite.createKey(map[string]any{
+		"label":         "billing-executor",
+		"scopes":        []string{"rules:execute"},
+		"rule_patterns": []string{"billing-*"},
+	})
+
+	resp, err := suite.httpClient.ExecuteRule(key.Key, "billing-eu", map[string]any{})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.ExecuteRule(key.Key, "shipping", map[string]any{})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+
+	resp, err = suite.httpClient.CreateRule(key.Key, "billing-us", versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+
+	resp, err = suite.httpClient.ListRules(key.Key)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+
+	resp, err = suite.httpClient.DeleteRule(key.Key, "billing-eu")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+}
+
+func (suite *APIKeysTestSuite) TestKeysManageKeyCannotManageWorkspaces() {
+	key := suite.createKey(map[string]any{
+		"label":  "key-manager",
+		"scopes": []string{"keys:manage"},
+	})
+
+	resp, err := suite.httpClient.CreateWorkspace(key.Key, "team")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+
+	resp, err = suite.httpClient.ListAuditEvents(key.Key, nil)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+
+	key = suite.createKey(map[string]any{
+		"label":  "workspace-manager",
+		"scopes": []string{"workspaces:manage", "audit:read"},
+	})
+
+	resp, err = suite.httpClient.CreateWorkspace(key.Key, "team")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	resp, err = suite.httpClient.ListAuditEvents(key.Key, nil)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func (suite *APIKeysTestSuite) TestRulePatternsLimitListing() {
+	suite.createRule("billing-eu")
+	suite.createRule("shipping")
+
+	key := suite.createKey(map[string]any{
+		"scopes":        []string{"rules:read", "rules:write"},
+		"rule_patterns": []string{"billing-*"},
+	})
+
+	resp, err := suite.httpClient.ListRules(key.Key)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var rules []map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&rules)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), rules, 1)
+	assert.Equal(suite.T(), "billing-eu", rules[0]["name"])
+
+	createResp, err := suite.httpClient.CreateRule(key.Key, "billing-us", versionOneProgram)
+	require.NoError(suite.T(), err)
+	createResp.Body.Close()
+	assert.Equal(suite.T(), http.StatusCreated, createResp.StatusCode)
+
+	createResp, err = suite.httpClient.CreateRule(key.Key, "shipping-us", versionOneProgram)
+	require.NoError(suite.T(), err)
+	createResp.Body.Close()
+	assert.Equal(suite.T(), http.StatusForbidden, createResp.StatusCode)
+}
+
+func (suite *APIKeysTestSuite) TestCreateKeyInvalidScopes() {
+	invalid := []map[string]any{
+		{"scopes": []string{}},
+		{"scopes": []string{"rules:admin"}},
+		{"rule_patterns": []string{"[billing"}},
+	}
+	for _, payload := range invalid {
+		resp, err := suite.httpClient.CreateAPIKey(suite.apiKey, payload)
+		require.NoError(suite.T(), err)
+		resp.Body.Close()
+		assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode, "%v", payload)
+	}
+}
+
+func TestAPIKeysTestSuite(t *testing.T) {
+	suite.Run(t, new(APIKeysTestSuite))
+}
@@ -0,0 +1,200 @@
+package rules
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/Gmacem/wasmorph/tests/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type AuditTestSuite struct {
+	suite.Suite
+	dbClient   *helpers.DatabaseClient
+	httpClient *helpers.HTTPClient
+	apiKey     string
+	otherKey   string
+}
+
+type auditEventResponse struct {
+	ID            int     `json:"id"`
+	ActorUserID   *int    `json:"actor_user_id"`
+	ActorUsername *string `json:"actor_username"`
+	ActorAPIKeyID *int    `json:"actor_api_key_id"`
+	SourceIP      *string `json:"source_ip"`
+	WorkspaceID   *int    `json:"workspace_id"`
+	Action        string  `json:"action"`
+	Target        string  `json:"target"`
+	Detail        *string `json:"detail"`
+	VersionBefore *int    `json:"version_before"`
+	VersionAfter  *int    `json:"version_after"`
+}
+
+func (suite *AuditTestSuite) SetupSuite() {
+	var err error
+	suite.dbClient, err = helpers.NewDatabaseClient()
+	require.NoError(suite.T(), err)
+	suite.httpClient = helpers.NewHTTPClient()
+}
+
+func (suite *AuditTestSuite) TearDownSuite() {
+	if suite.dbClient != nil {
+		suite.dbClient.Close()
+	}
+}
+
+func (suite *AuditTestSuite) SetupTest() {
+	suite.dbClient.CleanupAll()
+
+	suite.apiKey = "test-api-key-audit"
+	suite.otherKey = "test-api-key-audit-other"
+
+	require.NoError(suite.T(), suite.dbClient.AddUser("testuser-audit", "hashed-password"))
+	require.NoError(suite.T(), suite.dbClient.AddAPIKey(suite.apiKey, "testuser-audit"))
+	require.NoError(suite.T(), suite.dbClient.AddUser("testuser-audit-other", "hashed-password"))
+	require.NoError(suite.T(), suite.dbClient.AddAPIKey(suite.otherKey, "testuser-audit-other"))
+}
+
+func (suite *AuditTestSuite) listEvents(apiKey string, params url.Values) []auditEventResponse {
+	resp, err := suite.httpClient.ListAuditEvents(apiKey, params)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var events []auditEventResponse
+	require.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&events))
+	return events
+}
+
+func (suite *AuditTestSuite) TestRuleChangesAreAudited() {
+	for _, code := range []string{versionOneProgram, versionTwoProgram} {
+		resp, err := suite.httpClient.CreateRule(suite.apiKey, "audited-rule", code)
+		require.NoError(suite.T(), err)
+		resp.Body.Close()
+		require.Contains(suite.T(), []int{http.StatusCreated, http.StatusOK}, resp.StatusCode)
+	}
+	resp, err := suite.httpClient.DeleteRule(suite.apiKey, "audited-rule")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	events := suite.listEvents(suite.apiKey, url.Values{"target": {"audited-rule"}})
+	require.Len(suite.T(), events, 3)
+
+	workspaceID, err := suite.dbClient.GetPersonalWorkspaceID("testuser-audit")
+	require.NoError(suite.T(), err)
+
+	deleted, updated, created := events[0], events[1], events[2]
+	assert.Equal(suite.T(), "rule.delete", deleted.Action)
+	assert.Equal(suite.T(), 2, *deleted.VersionBefore)
+	assert.Nil(suite.T(), deleted.VersionAfter)
+
+	assert.Equal(suite.T(), "rule.update", updated.Action)
+	assert.Equal(suite.T(), 1, *updated.VersionBefore)
+	assert.Equal(suite.T(), 2, *updated.VersionAfter)
+
+	assert.Equal(suite.T(), "rule.create", created.Action)
+	assert.Nil(suite.T(), created.VersionBefore)
+	assert.Equal(suite.T(), 1, *created.VersionAfter)
+
+	for _, event := range events {
+		assert.Equal(suite.T(), "testuser-audit", *event.ActorUsername)
+		assert.NotNil(suite.T(), event.ActorAPIKeyID)
+		assert.NotEmpty(suite.T(), *event.SourceIP)
+		assert.Equal(suite.T(), int(workspaceID), *event.WorkspaceID)
+	}
+
+	page := suite.listEvents(suite.apiKey, url.Values{
+		"target": {"audited-rule"},
+		"before": {strconv.Itoa(updated.ID)},
+	})
+	require.Len(suite.T(), page, 1)
+	assert.Equal(suite.T(), created.ID, page[0].ID)
+}
+
+func (suite *AuditTestSuite) TestDeniedExecutionIsAudited() {
+	resp, err := suite.httpClient.CreateAPIKey(suite.apiKey, map[string]any{
+		"label":         "billing-executor",
+		"scopes":        []string{"rules:execute"},
+		"rule_patterns": []string{"billing-*"},
+	})
+	require.NoError(suite.T(), err)
+	var key apiKeyResponse
+	require.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&key))
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	resp, err = suite.httpClient.ExecuteRule(key.Key, "shipping", map[string]any{})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+
+	events := suite.listEvents(suite.apiKey, url.Values{"action": {"rule.execute_denied"}})
+	require.Len(suite.T(), events, 1)
+	assert.Equal(suite.T(), "shipping", events[0].Target)
+	assert.Equal(suite.T(), key.ID, *events[0].ActorAPIKeyID)
+
+	events = suite.listEvents(suite.apiKey, url.Values{"action": {"api_key.create"}})
+	require.Len(suite.T(), events, 1)
+	assert.Equal(suite.T(), strconv.Itoa(key.ID), events[0].Target)
+}
+
+func (suite *AuditTestSuite) TestExecutionInForeignWorkspaceIsAudited() {
+	resp, err := suite.httpClient.CreateRule(suite.otherKey, "other-rule", versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+	otherWorkspaceID, err := suite.dbClient.GetPersonalWorkspaceID("testuser-audit-other")
+	require.NoError(suite.T(), err)
+
+	params := url.Values{"workspace": {strconv.Itoa(int(otherWorkspaceID))}}
+	resp, err = suite.httpClient.ExecuteRuleWithParams(suite.apiKey, "other-rule", params, map[string]any{})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusNotFound, resp.StatusCode, "foreign workspaces are hidden")
+
+	resp, err = suite.httpClient.ExecuteRule(suite.apiKey, "missing-rule", map[string]any{})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+
+	events := suite.listEvents(suite.apiKey, url.Values{"action": {"rule.execute_denied"}})
+	require.Len(suite.T(), events, 1, "a missing rule is not a denial")
+	assert.Equal(suite.T(), "other-rule", events[0].Target)
+}
+
+func (suite *AuditTestSuite) TestOtherUsersEventsAreHidden() {
+	resp, err := suite.httpClient.CreateRule(suite.otherKey, "other-rule", versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	assert.Empty(suite.T(), suite.listEvents(suite.apiKey, url.Values{"target": {"other-rule"}}))
+	assert.Len(suite.T(), suite.listEvents(suite.otherKey, url.Values{"target": {"other-rule"}}), 1)
+
+	require.NoError(suite.T(), suite.dbClient.AddUser("testadmin-audit", "hashed-password"))
+	require.NoError(suite.T(), suite.dbClient.AddAdminAPIKey("test-api-key-audit-admin", "testadmin-audit"))
+	assert.Len(suite.T(), suite.listEvents("test-api-key-audit-admin", url.Values{"target": {"other-rule"}}), 1)
+}
+
+func (suite *AuditTestSuite) TestInvalidFilter() {
+	for _, params := range []url.Values{
+		{"since": {"yesterday"}},
+		{"workspace_id": {"abc"}},
+		{"limit": {"-1"}},
+	} {
+		resp, err := suite.httpClient.ListAuditEvents(suite.apiKey, params)
+		require.NoError(suite.T(), err)
+		resp.Body.Close()
+		assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode, params.Encode())
+	}
+}
+
+func TestAuditTestSuite(t *testing.T) {
+	suite.Run(t, new(AuditTestSuite))
+}
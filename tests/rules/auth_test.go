@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/Gmacem/wasmorph/tests/helpers"
@@ -95,6 +96,7 @@ func (suite *AuthTestSuite) TestUserRegistrationAndLogin() {
 	require.NoError(suite.T(), err)
 	assert.Equal(suite.T(), newUsername, user.Username)
 	assert.Equal(suite.T(), newEmail, user.Email)
+	assert.NotEqual(suite.T(), newPassword, user.PasswordHash, "password must not be stored in plaintext")
 
 	loginResp, err := suite.httpClient.Login(newUsername, newPassword)
 	require.NoError(suite.T(), err)
@@ -126,6 +128,103 @@ func (suite *AuthTestSuite) TestLoginWithInvalidCredentials() {
 	assert.Equal(suite.T(), http.StatusUnauthorized, wrongUsernameResp.StatusCode)
 }
 
+func (suite *AuthTestSuite) TestLoginRehashesPlaintextPassword() {
+	suite.dbClient.CleanupAll()
+
+	err := suite.dbClient.AddUser("legacyuser", "legacy_password")
+	require.NoError(suite.T(), err)
+
+	resp, err := suite.httpClient.Login("legacyuser", "wrong_password")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode)
+
+	user, err := suite.dbClient.GetUserByUsername("legacyuser")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "legacy_password", user.PasswordHash, "failed login must not rehash")
+
+	resp, err = suite.httpClient.Login("legacyuser", "legacy_password")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	user, err = suite.dbClient.GetUserByUsername("legacyuser")
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), strings.HasPrefix(user.PasswordHash, "$2"), "password should be rehashed with bcrypt")
+
+	resp, err = suite.httpClient.Login("legacyuser", "legacy_password")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+// login starts a session and returns its cookies.
+func (suite *AuthTestSuite) login(username, password string) []*http.Cookie {
+	resp, err := suite.httpClient.Login(username, password)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	return resp.Cookies()
+}
+
+func (suite *AuthTestSuite) meStatus(cookies []*http.Cookie) int {
+	resp, err := suite.httpClient.Me(cookies)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func (suite *AuthTestSuite) TestRefreshRotatesToken() {
+	resp, err := suite.httpClient.Register("refreshuser", "refresh@example.com", "password123")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	cookies := suite.login("refreshuser", "password123")
+	assert.Equal(suite.T(), http.StatusOK, suite.meStatus(cookies))
+
+	resp, err = suite.httpClient.Refresh(cookies)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	refreshed := resp.Cookies()
+	assert.Equal(suite.T(), http.StatusOK, suite.meStatus(refreshed))
+
+	resp, err = suite.httpClient.Refresh(cookies)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode, "a refresh token must only be used once")
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.meStatus(refreshed), "reusing a refresh token must end the session")
+}
+
+func (suite *AuthTestSuite) TestLogoutRevokesSession() {
+	resp, err := suite.httpClient.Register("logoutuser", "logout@example.com", "password123")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	cookies := suite.login("logoutuser", "password123")
+	other := suite.login("logoutuser", "password123")
+
+	resp, err = suite.httpClient.Logout(cookies, false)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusNoContent, resp.StatusCode)
+
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.meStatus(cookies), "the access token must stop working")
+	resp, err = suite.httpClient.Refresh(cookies)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(suite.T(), http.StatusOK, suite.meStatus(other), "other sessions must stay active")
+
+	resp, err = suite.httpClient.Logout(other, true)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusNoContent, resp.StatusCode)
+	assert.Equal(suite.T(), http.StatusUnauthorized, suite.meStatus(other))
+}
+
 func TestAuthTestSuite(t *testing.T) {
 	suite.Run(t, new(AuthTestSuite))
 }
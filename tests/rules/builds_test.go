@@ -0,0 +1,167 @@
+package rules
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Gmacem/wasmorph/internal/wasm"
+	"github.com/Gmacem/wasmorph/tests/helpers"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type BuildsTestSuite struct {
+	suite.Suite
+	dbClient   *helpers.DatabaseClient
+	httpClient *helpers.HTTPClient
+	apiKey     string
+}
+
+func (suite *BuildsTestSuite) SetupSuite() {
+	var err error
+	suite.dbClient, err = helpers.NewDatabaseClient()
+	require.NoError(suite.T(), err)
+	suite.httpClient = helpers.NewHTTPClient()
+}
+
+func (suite *BuildsTestSuite) TearDownSuite() {
+	if suite.dbClient != nil {
+		suite.dbClient.Close()
+	}
+}
+
+func (suite *BuildsTestSuite) SetupTest() {
+	suite.dbClient.CleanupAll()
+
+	suite.apiKey = "test-api-key-builds"
+	username := "testuser-builds"
+
+	err := suite.dbClient.AddUser(username, "hashed-password")
+	require.NoError(suite.T(), err)
+
+	err = suite.dbClient.AddAPIKey(suite.apiKey, username)
+	require.NoError(suite.T(), err)
+}
+
+func (suite *BuildsTestSuite) submit(name, code string) int {
+	resp, err := suite.httpClient.CreateRuleAsync(suite.apiKey, name, code)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusAccepted, resp.StatusCode)
+
+	var response map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "queued", response["status"])
+
+	return int(response["build_id"].(float64))
+}
+
+func (suite *BuildsTestSuite) getBuild(buildID int) map[string]any {
+	resp, err := suite.httpClient.GetBuild(suite.apiKey, buildID)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var build map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&build)
+	require.NoError(suite.T(), err)
+	return build
+}
+
+func (suite *BuildsTestSuite) waitForBuild(buildID int) map[string]any {
+	deadline := time.Now().Add(60 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := suite.httpClient.GetBuild(suite.apiKey, buildID)
+		require.NoError(suite.T(), err)
+
+		var build map[string]any
+		err = json.NewDecoder(resp.Body).Decode(&build)
+		resp.Body.Close()
+		require.NoError(suite.T(), err)
+		require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+		if status := build["status"]; status == "succeeded" || status == "failed" {
+			return build
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	suite.T().Fatalf("build %d did not finish in time", buildID)
+	return nil
+}
+
+func (suite *BuildsTestSuite) TestAsyncBuildSucceeds() {
+	buildID := suite.submit("async-rule", versionOneProgram)
+
+	build := suite.waitForBuild(buildID)
+	assert.Equal(suite.T(), "succeeded", build["status"])
+	assert.Equal(suite.T(), float64(1), build["rule_version"])
+
+	resp, err := suite.httpClient.ExecuteRule(suite.apiKey, "async-rule", map[string]any{})
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func (suite *BuildsTestSuite) TestAsyncBuildFails() {
+	buildID := suite.submit("broken-rule", `func Transform(in []byte) []byte {
+	return undefinedFunction(in)
+}`)
+
+	build := suite.waitForBuild(buildID)
+	assert.Equal(suite.T(), "failed", build["status"])
+	assert.NotEmpty(suite.T(), build["error"])
+	assert.Nil(suite.T(), build["rule_version"])
+}
+
+func (suite *BuildsTestSuite) TestAbandonedBuildsFail() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A replica that is still running holds the lock on its instance ID.
+	const liveInstance, stoppedInstance = 424242, 434343
+	lockConn, err := pgx.Connect(ctx, suite.dbClient.GetDatabaseURL())
+	require.NoError(suite.T(), err)
+	defer lockConn.Close(context.Background())
+	_, err = lockConn.Exec(ctx, "SELECT pg_advisory_lock($1::bigint)", liveInstance)
+	require.NoError(suite.T(), err)
+
+	username := "testuser-builds"
+	running, err := suite.dbClient.AddBuildJob(username, "running-rule", "running", sql.NullInt64{Int64: stoppedInstance, Valid: true})
+	require.NoError(suite.T(), err)
+	legacy, err := suite.dbClient.AddBuildJob(username, "legacy-rule", "queued", sql.NullInt64{})
+	require.NoError(suite.T(), err)
+	live, err := suite.dbClient.AddBuildJob(username, "live-rule", "queued", sql.NullInt64{Int64: liveInstance, Valid: true})
+	require.NoError(suite.T(), err)
+
+	pool, err := pgxpool.New(ctx, suite.dbClient.GetDatabaseURL())
+	require.NoError(suite.T(), err)
+	defer pool.Close()
+	require.NoError(suite.T(), wasm.NewService(pool, nil, nil).FailAbandonedBuilds(ctx))
+
+	for _, buildID := range []int{running, legacy} {
+		build := suite.getBuild(buildID)
+		assert.Equal(suite.T(), "failed", build["status"])
+		assert.Contains(suite.T(), build["error"], "server restarted")
+	}
+	assert.Equal(suite.T(), "queued", suite.getBuild(live)["status"], "builds of running replicas must be left alone")
+}
+
+func (suite *BuildsTestSuite) TestUnknownBuild() {
+	resp, err := suite.httpClient.GetBuild(suite.apiKey, 999999)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func TestBuildsTestSuite(t *testing.T) {
+	suite.Run(t, new(BuildsTestSuite))
+}
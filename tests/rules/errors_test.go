@@ -0,0 +1,136 @@
+package rules
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Gmacem/wasmorph/tests/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ErrorResponseTestSuite struct {
+	suite.Suite
+	dbClient   *helpers.DatabaseClient
+	httpClient *helpers.HTTPClient
+	apiKey     string
+}
+
+type errorResponse struct {
+	Error       string `json:"error"`
+	Code        string `json:"code"`
+	RequestID   string `json:"request_id"`
+	Diagnostics []struct {
+		Line    int    `json:"line"`
+		Column  int    `json:"column"`
+		Message string `json:"message"`
+	} `json:"diagnostics"`
+}
+
+func (suite *ErrorResponseTestSuite) SetupSuite() {
+	var err error
+	suite.dbClient, err = helpers.NewDatabaseClient()
+	require.NoError(suite.T(), err)
+	suite.httpClient = helpers.NewHTTPClient()
+}
+
+func (suite *ErrorResponseTestSuite) TearDownSuite() {
+	if suite.dbClient != nil {
+		suite.dbClient.Close()
+	}
+}
+
+func (suite *ErrorResponseTestSuite) SetupTest() {
+	suite.dbClient.CleanupAll()
+
+	suite.apiKey = "test-api-key-errors"
+	require.NoError(suite.T(), suite.dbClient.AddUser("testuser-errors", "hashed-password"))
+	require.NoError(suite.T(), suite.dbClient.AddAPIKey(suite.apiKey, "testuser-errors"))
+}
+
+func (suite *ErrorResponseTestSuite) decode(resp *http.Response) errorResponse {
+	defer resp.Body.Close()
+	var body errorResponse
+	require.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&body))
+	assert.NotEmpty(suite.T(), body.Error)
+	assert.Equal(suite.T(), resp.Header.Get("X-Request-Id"), body.RequestID)
+	return body
+}
+
+func (suite *ErrorResponseTestSuite) TestNotFound() {
+	resp, err := suite.httpClient.GetRuleWithRequestID(suite.apiKey, "missing-rule", "trace-42")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+
+	body := suite.decode(resp)
+	assert.Equal(suite.T(), "not_found", body.Code)
+	assert.Equal(suite.T(), "trace-42", body.RequestID, "a client's request ID must be kept")
+}
+
+func (suite *ErrorResponseTestSuite) TestCompileErrorDiagnostics() {
+	resp, err := suite.httpClient.CreateRule(suite.apiKey, "broken-rule", `func Transform(in []byte) []byte {
+	return undefinedFunction(in)
+}`)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, resp.StatusCode)
+
+	body := suite.decode(resp)
+	assert.Equal(suite.T(), "compile_error", body.Code)
+	assert.NotEmpty(suite.T(), body.RequestID)
+	require.NotEmpty(suite.T(), body.Diagnostics)
+	assert.Equal(suite.T(), 2, body.Diagnostics[0].Line)
+	assert.Contains(suite.T(), body.Diagnostics[0].Message, "undefinedFunction")
+}
+
+func (suite *ErrorResponseTestSuite) TestValidationError() {
+	resp, err := suite.httpClient.ListRulesPage(suite.apiKey, url.Values{"cursor": {"garbage"}})
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(suite.T(), "validation_error", suite.decode(resp).Code)
+}
+
+func (suite *ErrorResponseTestSuite) TestExecutionTrap() {
+	resp, err := suite.httpClient.CreateRule(suite.apiKey, "hungry-rule", memoryHungryProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	resp, err = suite.httpClient.UpdateRuleLimits(suite.apiKey, "hungry-rule", map[string]any{"max_memory_pages": 64})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.ExecuteRule(suite.apiKey, "hungry-rule", map[string]any{})
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(suite.T(), "execution_trap", suite.decode(resp).Code)
+}
+
+func (suite *ErrorResponseTestSuite) TestAuthErrors() {
+	resp, err := suite.httpClient.GetRule("invalid-key", "any-rule")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(suite.T(), "unauthorized", suite.decode(resp).Code)
+
+	resp, err = suite.httpClient.CreateAPIKey(suite.apiKey, map[string]any{
+		"label":  "reader",
+		"scopes": []string{"rules:read"},
+	})
+	require.NoError(suite.T(), err)
+	var key apiKeyResponse
+	require.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&key))
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	resp, err = suite.httpClient.CreateRule(key.Key, "any-rule", versionOneProgram)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+	assert.Equal(suite.T(), "forbidden", suite.decode(resp).Code)
+}
+
+func TestErrorResponseTestSuite(t *testing.T) {
+	suite.Run(t, new(ErrorResponseTestSuite))
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/Gmacem/wasmorph/tests/helpers"
 	"github.com/stretchr/testify/assert"
@@ -142,7 +144,81 @@ func (suite *ExecuteRulesTestSuite) TestExecuteRuleNotFound() {
 	require.NoError(suite.T(), err)
 	defer resp.Body.Close()
 
-	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *ExecuteRulesTestSuite) execute(params url.Values) (int, any) {
+	resp, err := suite.httpClient.ExecuteRuleWithParams(suite.apiKey, suite.testRuleName, params, map[string]any{})
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+
+	var response map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	require.NoError(suite.T(), err)
+	return resp.StatusCode, response["result"]
+}
+
+func (suite *ExecuteRulesTestSuite) saveRule(code string) {
+	resp, err := suite.httpClient.CreateRule(suite.apiKey, suite.testRuleName, code)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Contains(suite.T(), []int{http.StatusCreated, http.StatusOK}, resp.StatusCode)
+}
+
+func (suite *ExecuteRulesTestSuite) TestUpdateVisibleOnNextExecute() {
+	suite.saveRule(versionOneProgram)
+
+	status, result := suite.execute(nil)
+	require.Equal(suite.T(), http.StatusOK, status)
+	assert.Equal(suite.T(), "v1", result)
+
+	suite.saveRule(versionTwoProgram)
+
+	status, result = suite.execute(nil)
+	require.Equal(suite.T(), http.StatusOK, status)
+	assert.Equal(suite.T(), "v2", result)
+
+	suite.saveRule(versionOneProgram)
+
+	status, result = suite.execute(nil)
+	require.Equal(suite.T(), http.StatusOK, status)
+	assert.Equal(suite.T(), "v1", result)
+}
+
+func (suite *ExecuteRulesTestSuite) TestDeletedRuleNotExecutable() {
+	suite.saveRule(versionOneProgram)
+
+	// Warm the cache for both the current and the pinned version.
+	status, _ := suite.execute(nil)
+	require.Equal(suite.T(), http.StatusOK, status)
+	status, _ = suite.execute(url.Values{"version": {"1"}})
+	require.Equal(suite.T(), http.StatusOK, status)
+
+	resp, err := suite.httpClient.DeleteRule(suite.apiKey, suite.testRuleName)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	status, _ = suite.execute(nil)
+	assert.Equal(suite.T(), http.StatusNotFound, status)
+	status, _ = suite.execute(url.Values{"version": {"1"}})
+	assert.Equal(suite.T(), http.StatusNotFound, status)
+}
+
+func (suite *ExecuteRulesTestSuite) TestDeleteOnOtherReplicaEvictsCache() {
+	suite.saveRule(versionOneProgram)
+
+	status, _ := suite.execute(url.Values{"version": {"1"}})
+	require.Equal(suite.T(), http.StatusOK, status)
+
+	err := suite.dbClient.DeleteRuleAsOtherReplica(suite.testUserID, suite.testRuleName)
+	require.NoError(suite.T(), err)
+
+	// The pinned version is served from cache until the notification arrives.
+	assert.Eventually(suite.T(), func() bool {
+		status, _ := suite.execute(url.Values{"version": {"1"}})
+		return status == http.StatusNotFound
+	}, 2*time.Second, 20*time.Millisecond)
 }
 
 func TestExecuteRulesTestSuite(t *testing.T) {
@@ -0,0 +1,237 @@
+package rules
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Gmacem/wasmorph/tests/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+const infiniteLoopProgram = `func Transform(input []byte) []byte {
+	for {
+	}
+}`
+
+const memoryHungryProgram = `func Transform(input []byte) []byte {
+	var chunks [][]byte
+	for {
+		chunks = append(chunks, make([]byte, 1<<20))
+	}
+}`
+
+const largeOutputProgram = `func Transform(input []byte) []byte {
+	output := make([]byte, 4096)
+	for i := range output {
+		output[i] = 'x'
+	}
+	return output
+}`
+
+type RuleLimitsTestSuite struct {
+	suite.Suite
+	dbClient   *helpers.DatabaseClient
+	httpClient *helpers.HTTPClient
+	apiKey     string
+}
+
+func (suite *RuleLimitsTestSuite) SetupSuite() {
+	var err error
+	suite.dbClient, err = helpers.NewDatabaseClient()
+	require.NoError(suite.T(), err)
+	suite.httpClient = helpers.NewHTTPClient()
+}
+
+func (suite *RuleLimitsTestSuite) TearDownSuite() {
+	if suite.dbClient != nil {
+		suite.dbClient.Close()
+	}
+}
+
+func (suite *RuleLimitsTestSuite) SetupTest() {
+	suite.dbClient.CleanupAll()
+
+	suite.apiKey = "test-api-key-limits"
+	username := "testuser-limits"
+
+	err := suite.dbClient.AddUser(username, "hashed-password")
+	require.NoError(suite.T(), err)
+
+	err = suite.dbClient.AddAPIKey(suite.apiKey, username)
+	require.NoError(suite.T(), err)
+}
+
+func (suite *RuleLimitsTestSuite) createRule(name, code string) {
+	resp, err := suite.httpClient.CreateRule(suite.apiKey, name, code)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+}
+
+func (suite *RuleLimitsTestSuite) TestDefaultLimits() {
+	suite.createRule("limited-rule", versionOneProgram)
+
+	resp, err := suite.httpClient.GetRuleLimits(suite.apiKey, "limited-rule")
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var limits map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&limits)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), float64(5000), limits["timeout_ms"])
+	assert.Equal(suite.T(), float64(1024), limits["max_memory_pages"])
+	assert.Equal(suite.T(), float64(1048576), limits["max_output_bytes"])
+	assert.Equal(suite.T(), float64(1), limits["min_instances"])
+	assert.Equal(suite.T(), float64(0), limits["max_instances"])
+}
+
+func (suite *RuleLimitsTestSuite) TestUpdateLimits() {
+	suite.createRule("limited-rule", versionOneProgram)
+
+	resp, err := suite.httpClient.UpdateRuleLimits(suite.apiKey, "limited-rule", map[string]any{"timeout_ms": 250})
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var limits map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&limits)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), float64(250), limits["timeout_ms"])
+	assert.Equal(suite.T(), float64(1024), limits["max_memory_pages"], "limits missing from the request are kept")
+}
+
+func (suite *RuleLimitsTestSuite) TestUpdateLimitsInvalid() {
+	suite.createRule("limited-rule", versionOneProgram)
+
+	invalid := []map[string]any{
+		{"timeout_ms": 0},
+		{"timeout_ms": -1},
+		{"timeout_ms": 10 * 60 * 1000},
+		{"max_memory_pages": 1},
+		{"max_memory_pages": 100000},
+		{"max_output_bytes": 0},
+		{"min_instances": 0},
+		{"max_instances": -1},
+		{"min_instances": 4, "max_instances": 2},
+	}
+	for _, limits := range invalid {
+		resp, err := suite.httpClient.UpdateRuleLimits(suite.apiKey, "limited-rule", limits)
+		require.NoError(suite.T(), err)
+		resp.Body.Close()
+		assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode, "%v", limits)
+	}
+}
+
+func (suite *RuleLimitsTestSuite) TestUpdateLimitsRuleNotFound() {
+	resp, err := suite.httpClient.UpdateRuleLimits(suite.apiKey, "missing-rule", map[string]any{"timeout_ms": 250})
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *RuleLimitsTestSuite) TestExecuteTimeout() {
+	suite.createRule("looping-rule", infiniteLoopProgram)
+
+	resp, err := suite.httpClient.UpdateRuleLimits(suite.apiKey, "looping-rule", map[string]any{"timeout_ms": 200})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	// A second call must time out again rather than wait on the stuck one.
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		resp, err := suite.httpClient.ExecuteRule(suite.apiKey, "looping-rule", map[string]any{})
+		require.NoError(suite.T(), err)
+		resp.Body.Close()
+
+		assert.Equal(suite.T(), http.StatusGatewayTimeout, resp.StatusCode)
+		assert.Less(suite.T(), time.Since(start), 5*time.Second)
+	}
+
+	suite.createRule("healthy-rule", versionOneProgram)
+	resp, err = suite.httpClient.ExecuteRule(suite.apiKey, "healthy-rule", map[string]any{})
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func (suite *RuleLimitsTestSuite) TestExecuteMemoryLimitExceeded() {
+	suite.createRule("hungry-rule", memoryHungryProgram)
+
+	resp, err := suite.httpClient.UpdateRuleLimits(suite.apiKey, "hungry-rule", map[string]any{"max_memory_pages": 64})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.ExecuteRule(suite.apiKey, "hungry-rule", map[string]any{})
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, resp.StatusCode)
+
+	var body map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	require.NoError(suite.T(), err)
+	assert.Contains(suite.T(), body["error"], "memory limit exceeded")
+	assert.Equal(suite.T(), "memory_limit_exceeded", body["code"])
+}
+
+func (suite *RuleLimitsTestSuite) TestExecuteOutputLimitExceeded() {
+	suite.createRule("large-output-rule", largeOutputProgram)
+
+	resp, err := suite.httpClient.ExecuteRule(suite.apiKey, "large-output-rule", map[string]any{})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.UpdateRuleLimits(suite.apiKey, "large-output-rule", map[string]any{"max_output_bytes": 1024})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.ExecuteRule(suite.apiKey, "large-output-rule", map[string]any{})
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+func (suite *RuleLimitsTestSuite) TestExecuteRunsInParallel() {
+	suite.createRule("looping-rule", infiniteLoopProgram)
+
+	resp, err := suite.httpClient.UpdateRuleLimits(suite.apiKey, "looping-rule", map[string]any{
+		"timeout_ms":    500,
+		"max_instances": 4,
+	})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	// Four stuck calls on four instances finish together instead of one
+	// after another.
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := suite.httpClient.ExecuteRule(suite.apiKey, "looping-rule", map[string]any{})
+			if assert.NoError(suite.T(), err) {
+				resp.Body.Close()
+				assert.Equal(suite.T(), http.StatusGatewayTimeout, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Less(suite.T(), time.Since(start), 1500*time.Millisecond)
+}
+
+func TestRuleLimitsTestSuite(t *testing.T) {
+	suite.Run(t, new(RuleLimitsTestSuite))
+}
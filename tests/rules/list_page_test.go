@@ -0,0 +1,191 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Gmacem/wasmorph/internal/sql"
+	"github.com/Gmacem/wasmorph/internal/wasm"
+	"github.com/Gmacem/wasmorph/internal/workspace"
+	"github.com/Gmacem/wasmorph/tests/helpers"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ListRulesPageTestSuite struct {
+	suite.Suite
+	dbClient   *helpers.DatabaseClient
+	httpClient *helpers.HTTPClient
+	queries    *sql.Queries
+	conn       *pgx.Conn
+	apiKey     string
+}
+
+type listedRule struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func (suite *ListRulesPageTestSuite) SetupSuite() {
+	var err error
+	suite.dbClient, err = helpers.NewDatabaseClient()
+	require.NoError(suite.T(), err)
+	suite.httpClient = helpers.NewHTTPClient()
+
+	suite.conn, err = pgx.Connect(context.Background(), suite.dbClient.GetDatabaseURL())
+	require.NoError(suite.T(), err)
+	suite.queries = sql.New(suite.conn)
+}
+
+func (suite *ListRulesPageTestSuite) TearDownSuite() {
+	if suite.conn != nil {
+		suite.conn.Close(context.Background())
+	}
+	if suite.dbClient != nil {
+		suite.dbClient.Close()
+	}
+}
+
+func (suite *ListRulesPageTestSuite) SetupTest() {
+	suite.dbClient.CleanupAll()
+
+	suite.apiKey = "test-api-key-list-page"
+	require.NoError(suite.T(), suite.dbClient.AddUser("testuser-list-page", "hashed-password"))
+	require.NoError(suite.T(), suite.dbClient.AddAPIKey(suite.apiKey, "testuser-list-page"))
+}
+
+// addRule stores a rule directly, so that listings can be tested without
+// compiling.
+func (suite *ListRulesPageTestSuite) addRule(name, sourceCode string) {
+	userID, err := suite.dbClient.GetUserID("testuser-list-page")
+	require.NoError(suite.T(), err)
+	workspaceID, err := suite.dbClient.GetPersonalWorkspaceID("testuser-list-page")
+	require.NoError(suite.T(), err)
+
+	_, err = suite.queries.CreateRule(context.Background(), sql.CreateRuleParams{
+		Name:        name,
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		SourceCode:  sourceCode,
+		WasmBinary:  []byte{0x01},
+		IsActive:    pgtype.Bool{Bool: true, Valid: true},
+	})
+	require.NoError(suite.T(), err)
+}
+
+func (suite *ListRulesPageTestSuite) listPage(params url.Values) ([]string, string) {
+	resp, err := suite.httpClient.ListRulesPage(suite.apiKey, params)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var rules []listedRule
+	require.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&rules))
+	names := make([]string, len(rules))
+	for i, rule := range rules {
+		names[i] = rule.Name
+	}
+	return names, resp.Header.Get("X-Next-Cursor")
+}
+
+func (suite *ListRulesPageTestSuite) TestPagesCoverEveryRuleOnce() {
+	var want []string
+	for i := 0; i < 7; i++ {
+		name := fmt.Sprintf("paged-rule-%d", i)
+		suite.addRule(name, transformProgram)
+		want = append(want, name)
+	}
+
+	for _, sort := range []string{"created_at", "updated_at", "name"} {
+		var got []string
+		params := url.Values{"limit": {"3"}, "sort": {sort}}
+		for pages := 0; ; pages++ {
+			require.Less(suite.T(), pages, 3, "listing sorted by %s must end", sort)
+			names, cursor := suite.listPage(params)
+			got = append(got, names...)
+			if cursor == "" {
+				break
+			}
+			params.Set("cursor", cursor)
+		}
+		assert.ElementsMatch(suite.T(), want, got, sort)
+		if sort == "name" {
+			assert.Equal(suite.T(), want, got)
+		}
+	}
+}
+
+func (suite *ListRulesPageTestSuite) TestSearch() {
+	suite.addRule("billing-eu", `func Transform(input []byte) []byte { return invoice(input) }`)
+	suite.addRule("billing-us", transformProgram)
+	suite.addRule("shipping", `func Transform(input []byte) []byte { return invoice(input) }`)
+
+	names, _ := suite.listPage(url.Values{"q": {"BILLING"}, "sort": {"name"}})
+	assert.Equal(suite.T(), []string{"billing-eu", "billing-us"}, names)
+
+	names, _ = suite.listPage(url.Values{"source": {"invoice"}, "sort": {"name"}})
+	assert.Equal(suite.T(), []string{"billing-eu", "shipping"}, names)
+
+	names, _ = suite.listPage(url.Values{"q": {"%"}})
+	assert.Empty(suite.T(), names, "wildcards in q must match literally")
+
+	names, _ = suite.listPage(url.Values{"updated_since": {"2999-01-01T00:00:00Z"}})
+	assert.Empty(suite.T(), names)
+}
+
+func (suite *ListRulesPageTestSuite) TestUpdatedSinceAwayFromUTC() {
+	suite.addRule("stale", transformProgram)
+	suite.addRule("fresh", transformProgram)
+
+	// The update times are written and the rules listed at UTC+05:30.
+	ctx := context.Background()
+	config, err := pgxpool.ParseConfig(suite.dbClient.GetDatabaseURL())
+	require.NoError(suite.T(), err)
+	config.ConnConfig.RuntimeParams["timezone"] = "Asia/Kolkata"
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(suite.T(), err)
+	defer pool.Close()
+
+	_, err = pool.Exec(ctx, `UPDATE wasmorph.rules SET updated_at = NOW() - CASE name
+		WHEN 'stale' THEN interval '2 hours' ELSE interval '0' END
+		WHERE name IN ('stale', 'fresh')`)
+	require.NoError(suite.T(), err)
+
+	userID, err := suite.dbClient.GetUserID("testuser-list-page")
+	require.NoError(suite.T(), err)
+	workspaceID, err := suite.dbClient.GetPersonalWorkspaceID("testuser-list-page")
+	require.NoError(suite.T(), err)
+	page, err := wasm.NewService(pool, nil, nil).ListRules(ctx,
+		workspace.Caller{UserID: userID, WorkspaceID: workspaceID},
+		wasm.RuleQuery{UpdatedSince: time.Now().Add(-time.Hour)})
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), page.Rules, 1)
+	assert.Equal(suite.T(), "fresh", page.Rules[0].Name)
+}
+
+func (suite *ListRulesPageTestSuite) TestInvalidParameters() {
+	for _, params := range []url.Values{
+		{"limit": {"0"}},
+		{"sort": {"size"}},
+		{"cursor": {"garbage"}},
+		{"updated_since": {"yesterday"}},
+	} {
+		resp, err := suite.httpClient.ListRulesPage(suite.apiKey, params)
+		require.NoError(suite.T(), err)
+		resp.Body.Close()
+		assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode, params.Encode())
+	}
+}
+
+func TestListRulesPageTestSuite(t *testing.T) {
+	suite.Run(t, new(ListRulesPageTestSuite))
+}
@@ -55,10 +55,10 @@ func (suite *ListRulesTestSuite) SetupTest() {
 }
 
 func (suite *ListRulesTestSuite) TestListRulesEmpty() {
-	userID, err := suite.dbClient.GetUserID("user1")
+	workspaceID, err := suite.dbClient.GetPersonalWorkspaceID("user1")
 	require.NoError(suite.T(), err)
 
-	rules, err := suite.queries.ListRulesByUser(context.Background(), userID)
+	rules, err := suite.queries.ListRulesByWorkspace(context.Background(), workspaceID)
 	require.NoError(suite.T(), err)
 	assert.Len(suite.T(), rules, 0)
 }
@@ -66,18 +66,21 @@ func (suite *ListRulesTestSuite) TestListRulesEmpty() {
 func (suite *ListRulesTestSuite) TestListRulesSingle() {
 	userID, err := suite.dbClient.GetUserID("user1")
 	require.NoError(suite.T(), err)
+	workspaceID, err := suite.dbClient.GetPersonalWorkspaceID("user1")
+	require.NoError(suite.T(), err)
 	ruleName := "single-rule"
 
 	_, err = suite.queries.CreateRule(context.Background(), sql.CreateRuleParams{
-		Name:       ruleName,
-		UserID:     userID,
-		SourceCode: transformProgram,
-		WasmBinary: []byte{0x01, 0x02, 0x03},
-		IsActive:   pgtype.Bool{Bool: true, Valid: true},
+		Name:        ruleName,
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		SourceCode:  transformProgram,
+		WasmBinary:  []byte{0x01, 0x02, 0x03},
+		IsActive:    pgtype.Bool{Bool: true, Valid: true},
 	})
 	require.NoError(suite.T(), err)
 
-	rules, err := suite.queries.ListRulesByUser(context.Background(), userID)
+	rules, err := suite.queries.ListRulesByWorkspace(context.Background(), workspaceID)
 	require.NoError(suite.T(), err)
 
 	assert.Len(suite.T(), rules, 1)
@@ -89,20 +92,23 @@ func (suite *ListRulesTestSuite) TestListRulesSingle() {
 func (suite *ListRulesTestSuite) TestListRulesMultiple() {
 	userID, err := suite.dbClient.GetUserID("user1")
 	require.NoError(suite.T(), err)
+	workspaceID, err := suite.dbClient.GetPersonalWorkspaceID("user1")
+	require.NoError(suite.T(), err)
 	ruleNames := []string{"rule1", "rule2", "rule3"}
 
 	for i, ruleName := range ruleNames {
 		_, err := suite.queries.CreateRule(context.Background(), sql.CreateRuleParams{
-			Name:       ruleName,
-			UserID:     userID,
-			SourceCode: transformProgram,
-			WasmBinary: []byte{byte(i + 1), byte(i + 2), byte(i + 3)},
-			IsActive:   pgtype.Bool{Bool: true, Valid: true},
+			Name:        ruleName,
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+			SourceCode:  transformProgram,
+			WasmBinary:  []byte{byte(i + 1), byte(i + 2), byte(i + 3)},
+			IsActive:    pgtype.Bool{Bool: true, Valid: true},
 		})
 		require.NoError(suite.T(), err)
 	}
 
-	rules, err := suite.queries.ListRulesByUser(context.Background(), userID)
+	rules, err := suite.queries.ListRulesByWorkspace(context.Background(), workspaceID)
 	require.NoError(suite.T(), err)
 
 	assert.Len(suite.T(), rules, 3)
@@ -124,39 +130,46 @@ func (suite *ListRulesTestSuite) TestListRulesUserIsolation() {
 	require.NoError(suite.T(), err)
 	user2ID, err := suite.dbClient.GetUserID("user2")
 	require.NoError(suite.T(), err)
+	workspace1ID, err := suite.dbClient.GetPersonalWorkspaceID("user1")
+	require.NoError(suite.T(), err)
+	workspace2ID, err := suite.dbClient.GetPersonalWorkspaceID("user2")
+	require.NoError(suite.T(), err)
 
 	_, err = suite.queries.CreateRule(context.Background(), sql.CreateRuleParams{
-		Name:       "user1-rule1",
-		UserID:     user1ID,
-		SourceCode: transformProgram,
-		WasmBinary: []byte{0x01, 0x02, 0x03},
-		IsActive:   pgtype.Bool{Bool: true, Valid: true},
+		Name:        "user1-rule1",
+		WorkspaceID: workspace1ID,
+		UserID:      user1ID,
+		SourceCode:  transformProgram,
+		WasmBinary:  []byte{0x01, 0x02, 0x03},
+		IsActive:    pgtype.Bool{Bool: true, Valid: true},
 	})
 	require.NoError(suite.T(), err)
 
 	_, err = suite.queries.CreateRule(context.Background(), sql.CreateRuleParams{
-		Name:       "user1-rule2",
-		UserID:     user1ID,
-		SourceCode: transformProgram,
-		WasmBinary: []byte{0x04, 0x05, 0x06},
-		IsActive:   pgtype.Bool{Bool: true, Valid: true},
+		Name:        "user1-rule2",
+		WorkspaceID: workspace1ID,
+		UserID:      user1ID,
+		SourceCode:  transformProgram,
+		WasmBinary:  []byte{0x04, 0x05, 0x06},
+		IsActive:    pgtype.Bool{Bool: true, Valid: true},
 	})
 	require.NoError(suite.T(), err)
 
 	_, err = suite.queries.CreateRule(context.Background(), sql.CreateRuleParams{
-		Name:       "user2-rule1",
-		UserID:     user2ID,
-		SourceCode: transformProgram,
-		WasmBinary: []byte{0x07, 0x08, 0x09},
-		IsActive:   pgtype.Bool{Bool: true, Valid: true},
+		Name:        "user2-rule1",
+		WorkspaceID: workspace2ID,
+		UserID:      user2ID,
+		SourceCode:  transformProgram,
+		WasmBinary:  []byte{0x07, 0x08, 0x09},
+		IsActive:    pgtype.Bool{Bool: true, Valid: true},
 	})
 	require.NoError(suite.T(), err)
 
-	user1Rules, err := suite.queries.ListRulesByUser(context.Background(), user1ID)
+	user1Rules, err := suite.queries.ListRulesByWorkspace(context.Background(), workspace1ID)
 	require.NoError(suite.T(), err)
 	assert.Len(suite.T(), user1Rules, 2)
 
-	user2Rules, err := suite.queries.ListRulesByUser(context.Background(), user2ID)
+	user2Rules, err := suite.queries.ListRulesByWorkspace(context.Background(), workspace2ID)
 	require.NoError(suite.T(), err)
 	assert.Len(suite.T(), user2Rules, 1)
 
@@ -180,20 +193,23 @@ func (suite *ListRulesTestSuite) TestListRulesUserIsolation() {
 func (suite *ListRulesTestSuite) TestListRulesOrderedByCreatedAt() {
 	userID, err := suite.dbClient.GetUserID("user1")
 	require.NoError(suite.T(), err)
+	workspaceID, err := suite.dbClient.GetPersonalWorkspaceID("user1")
+	require.NoError(suite.T(), err)
 	ruleNames := []string{"first-rule", "second-rule", "third-rule"}
 
 	for i, ruleName := range ruleNames {
 		_, err := suite.queries.CreateRule(context.Background(), sql.CreateRuleParams{
-			Name:       ruleName,
-			UserID:     userID,
-			SourceCode: transformProgram,
-			WasmBinary: []byte{byte(i + 1), byte(i + 2), byte(i + 3)},
-			IsActive:   pgtype.Bool{Bool: true, Valid: true},
+			Name:        ruleName,
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+			SourceCode:  transformProgram,
+			WasmBinary:  []byte{byte(i + 1), byte(i + 2), byte(i + 3)},
+			IsActive:    pgtype.Bool{Bool: true, Valid: true},
 		})
 		require.NoError(suite.T(), err)
 	}
 
-	rules, err := suite.queries.ListRulesByUser(context.Background(), userID)
+	rules, err := suite.queries.ListRulesByWorkspace(context.Background(), workspaceID)
 	require.NoError(suite.T(), err)
 
 	assert.Len(suite.T(), rules, 3)
@@ -210,17 +226,20 @@ func (suite *ListRulesTestSuite) TestListRulesOrderedByCreatedAt() {
 func (suite *ListRulesTestSuite) TestListRulesOnlyActive() {
 	userID, err := suite.dbClient.GetUserID("user1")
 	require.NoError(suite.T(), err)
+	workspaceID, err := suite.dbClient.GetPersonalWorkspaceID("user1")
+	require.NoError(suite.T(), err)
 
 	_, err = suite.queries.CreateRule(context.Background(), sql.CreateRuleParams{
-		Name:       "active-rule",
-		UserID:     userID,
-		SourceCode: transformProgram,
-		WasmBinary: []byte{0x01, 0x02, 0x03},
-		IsActive:   pgtype.Bool{Bool: true, Valid: true},
+		Name:        "active-rule",
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		SourceCode:  transformProgram,
+		WasmBinary:  []byte{0x01, 0x02, 0x03},
+		IsActive:    pgtype.Bool{Bool: true, Valid: true},
 	})
 	require.NoError(suite.T(), err)
 
-	rules, err := suite.queries.ListRulesByUser(context.Background(), userID)
+	rules, err := suite.queries.ListRulesByWorkspace(context.Background(), workspaceID)
 	require.NoError(suite.T(), err)
 
 	assert.Len(suite.T(), rules, 1)
@@ -0,0 +1,154 @@
+package rules
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Gmacem/wasmorph/tests/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type MetadataTestSuite struct {
+	suite.Suite
+	dbClient   *helpers.DatabaseClient
+	httpClient *helpers.HTTPClient
+	apiKey     string
+}
+
+type ruleMetadataResponse struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Tags        []string          `json:"tags"`
+	Labels      map[string]string `json:"labels"`
+}
+
+func (suite *MetadataTestSuite) SetupSuite() {
+	var err error
+	suite.dbClient, err = helpers.NewDatabaseClient()
+	require.NoError(suite.T(), err)
+	suite.httpClient = helpers.NewHTTPClient()
+}
+
+func (suite *MetadataTestSuite) TearDownSuite() {
+	if suite.dbClient != nil {
+		suite.dbClient.Close()
+	}
+}
+
+func (suite *MetadataTestSuite) SetupTest() {
+	suite.dbClient.CleanupAll()
+
+	suite.apiKey = "test-api-key-metadata"
+	require.NoError(suite.T(), suite.dbClient.AddUser("testuser-metadata", "hashed-password"))
+	require.NoError(suite.T(), suite.dbClient.AddAPIKey(suite.apiKey, "testuser-metadata"))
+}
+
+func (suite *MetadataTestSuite) saveRule(payload map[string]any) {
+	resp, err := suite.httpClient.SaveRule(suite.apiKey, payload)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Contains(suite.T(), []int{http.StatusCreated, http.StatusOK}, resp.StatusCode)
+}
+
+func (suite *MetadataTestSuite) getRule(name string) ruleMetadataResponse {
+	resp, err := suite.httpClient.GetRule(suite.apiKey, name)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var rule ruleMetadataResponse
+	require.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&rule))
+	return rule
+}
+
+func (suite *MetadataTestSuite) listNames(params url.Values) []string {
+	resp, err := suite.httpClient.ListRulesPage(suite.apiKey, params)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var rules []ruleMetadataResponse
+	require.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&rules))
+	names := make([]string, len(rules))
+	for i, rule := range rules {
+		names[i] = rule.Name
+	}
+	return names
+}
+
+func (suite *MetadataTestSuite) TestMetadataIsKeptUntilReplaced() {
+	suite.saveRule(map[string]any{
+		"name":        "priced-rule",
+		"code":        versionOneProgram,
+		"description": "Computes list prices",
+		"tags":        []string{"pricing", "eu"},
+		"labels":      map[string]string{"team": "billing"},
+	})
+
+	rule := suite.getRule("priced-rule")
+	assert.Equal(suite.T(), "Computes list prices", rule.Description)
+	assert.Equal(suite.T(), []string{"pricing", "eu"}, rule.Tags)
+	assert.Equal(suite.T(), map[string]string{"team": "billing"}, rule.Labels)
+
+	suite.saveRule(map[string]any{"name": "priced-rule", "code": versionTwoProgram})
+	rule = suite.getRule("priced-rule")
+	assert.Equal(suite.T(), "Computes list prices", rule.Description, "omitted metadata must be kept")
+	assert.Equal(suite.T(), []string{"pricing", "eu"}, rule.Tags)
+
+	suite.saveRule(map[string]any{"name": "priced-rule", "code": versionTwoProgram, "tags": []string{}})
+	rule = suite.getRule("priced-rule")
+	assert.Empty(suite.T(), rule.Tags)
+	assert.Equal(suite.T(), map[string]string{"team": "billing"}, rule.Labels)
+}
+
+func (suite *MetadataTestSuite) TestListFiltersOnTagsAndLabels() {
+	suite.saveRule(map[string]any{
+		"name":   "billing-prices",
+		"code":   versionOneProgram,
+		"tags":   []string{"pricing"},
+		"labels": map[string]string{"team": "billing"},
+	})
+	suite.saveRule(map[string]any{
+		"name":   "shipping-prices",
+		"code":   versionOneProgram,
+		"tags":   []string{"pricing"},
+		"labels": map[string]string{"team": "shipping"},
+	})
+	suite.saveRule(map[string]any{"name": "untagged", "code": versionOneProgram})
+
+	params := url.Values{"sort": {"name"}}
+	params.Set("tag", "pricing")
+	assert.Equal(suite.T(), []string{"billing-prices", "shipping-prices"}, suite.listNames(params))
+
+	params.Set("label", "team=billing")
+	assert.Equal(suite.T(), []string{"billing-prices"}, suite.listNames(params))
+
+	params.Set("tag", "missing")
+	assert.Empty(suite.T(), suite.listNames(params))
+}
+
+func (suite *MetadataTestSuite) TestInvalidMetadata() {
+	for _, payload := range []map[string]any{
+		{"name": "bad-tag", "code": versionOneProgram, "tags": []string{"has space"}},
+		{"name": "duplicate-tag", "code": versionOneProgram, "tags": []string{"a", "a"}},
+		{"name": "bad-label", "code": versionOneProgram, "labels": map[string]string{"": "value"}},
+	} {
+		resp, err := suite.httpClient.SaveRule(suite.apiKey, payload)
+		require.NoError(suite.T(), err)
+		resp.Body.Close()
+		assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode, payload["name"])
+	}
+
+	resp, err := suite.httpClient.ListRulesPage(suite.apiKey, url.Values{"label": {"team"}})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestMetadataTestSuite(t *testing.T) {
+	suite.Run(t, new(MetadataTestSuite))
+}
@@ -0,0 +1,194 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Gmacem/wasmorph/internal/wasm"
+	"github.com/Gmacem/wasmorph/tests/helpers"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type RestoreRuleTestSuite struct {
+	suite.Suite
+	dbClient   *helpers.DatabaseClient
+	httpClient *helpers.HTTPClient
+	apiKey     string
+}
+
+func (suite *RestoreRuleTestSuite) SetupSuite() {
+	var err error
+	suite.dbClient, err = helpers.NewDatabaseClient()
+	require.NoError(suite.T(), err)
+	suite.httpClient = helpers.NewHTTPClient()
+}
+
+func (suite *RestoreRuleTestSuite) TearDownSuite() {
+	if suite.dbClient != nil {
+		suite.dbClient.Close()
+	}
+}
+
+func (suite *RestoreRuleTestSuite) SetupTest() {
+	suite.dbClient.CleanupAll()
+
+	suite.apiKey = "test-api-key-restore"
+	require.NoError(suite.T(), suite.dbClient.AddUser("testuser-restore", "hashed-password"))
+	require.NoError(suite.T(), suite.dbClient.AddAPIKey(suite.apiKey, "testuser-restore"))
+}
+
+func (suite *RestoreRuleTestSuite) saveRule(name, code string) {
+	resp, err := suite.httpClient.CreateRule(suite.apiKey, name, code)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Contains(suite.T(), []int{http.StatusCreated, http.StatusOK}, resp.StatusCode)
+}
+
+func (suite *RestoreRuleTestSuite) deleteRule(name string) {
+	resp, err := suite.httpClient.DeleteRule(suite.apiKey, name)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func (suite *RestoreRuleTestSuite) listDeleted() []string {
+	resp, err := suite.httpClient.ListRulesPage(suite.apiKey, url.Values{"deleted": {"true"}})
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var rules []struct {
+		Name      string  `json:"name"`
+		DeletedAt *string `json:"deleted_at"`
+	}
+	require.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&rules))
+	names := make([]string, len(rules))
+	for i, rule := range rules {
+		assert.NotNil(suite.T(), rule.DeletedAt, rule.Name)
+		names[i] = rule.Name
+	}
+	return names
+}
+
+func (suite *RestoreRuleTestSuite) TestRestore() {
+	suite.saveRule("restored-rule", versionOneProgram)
+	suite.saveRule("restored-rule", versionTwoProgram)
+	suite.saveRule("kept-rule", versionOneProgram)
+	suite.deleteRule("restored-rule")
+
+	assert.Equal(suite.T(), []string{"restored-rule"}, suite.listDeleted())
+
+	resp, err := suite.httpClient.RestoreRule(suite.apiKey, "restored-rule")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	assert.Empty(suite.T(), suite.listDeleted())
+
+	resp, err = suite.httpClient.ExecuteRule(suite.apiKey, "restored-rule", map[string]any{"input": "x"})
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	var result struct {
+		Result string `json:"result"`
+	}
+	require.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(suite.T(), "v2", result.Result, "a restored rule must run the code it was deleted with")
+
+	resp, err = suite.httpClient.RestoreRule(suite.apiKey, "kept-rule")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode, "only deleted rules can be restored")
+}
+
+func (suite *RestoreRuleTestSuite) TestPurge() {
+	suite.saveRule("purged-rule", versionOneProgram)
+
+	resp, err := suite.httpClient.PurgeRule(suite.apiKey, "purged-rule")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode, "active rules must be deleted before purging")
+
+	suite.deleteRule("purged-rule")
+	resp, err = suite.httpClient.PurgeRule(suite.apiKey, "purged-rule")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	stored, err := suite.dbClient.RuleStored("testuser-restore", "purged-rule")
+	require.NoError(suite.T(), err)
+	assert.False(suite.T(), stored)
+
+	resp, err = suite.httpClient.RestoreRule(suite.apiKey, "purged-rule")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func (suite *RestoreRuleTestSuite) TestCreateOverDeletedRuleConflicts() {
+	suite.saveRule("reused-name", versionOneProgram)
+	suite.saveRule("reused-name", versionTwoProgram)
+	suite.deleteRule("reused-name")
+
+	resp, err := suite.httpClient.CreateRule(suite.apiKey, "reused-name", versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusConflict, resp.StatusCode, "a deleted rule must be restored or purged before its name is reused")
+	assert.Equal(suite.T(), []string{"reused-name"}, suite.listDeleted())
+
+	resp, err = suite.httpClient.PurgeRule(suite.apiKey, "reused-name")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.CreateRule(suite.apiKey, "reused-name", versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	resp, err = suite.httpClient.ListRuleVersions(suite.apiKey, "reused-name")
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	var versions []map[string]any
+	require.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&versions))
+	assert.Len(suite.T(), versions, 1, "the new rule must not inherit the purged rule's versions")
+}
+
+func (suite *RestoreRuleTestSuite) TestRetentionPurgesExpiredRules() {
+	suite.saveRule("expired-rule", versionOneProgram)
+	suite.saveRule("recent-rule", versionOneProgram)
+	suite.deleteRule("expired-rule")
+	suite.deleteRule("recent-rule")
+
+	// Sessions away from UTC must agree with each other on the cutoff: the
+	// deletion times are written and the purge runs at UTC+05:30.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config, err := pgxpool.ParseConfig(suite.dbClient.GetDatabaseURL())
+	require.NoError(suite.T(), err)
+	config.ConnConfig.RuntimeParams["timezone"] = "Asia/Kolkata"
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(suite.T(), err)
+	defer pool.Close()
+
+	_, err = pool.Exec(ctx, `UPDATE wasmorph.rules SET deleted_at = NOW() - CASE name
+		WHEN 'expired-rule' THEN interval '2 hours' ELSE interval '10 minutes' END
+		WHERE name IN ('expired-rule', 'recent-rule')`)
+	require.NoError(suite.T(), err)
+
+	go wasm.NewService(pool, nil, nil).PurgeExpiredRules(ctx, time.Hour)
+	require.Eventually(suite.T(), func() bool {
+		return len(suite.listDeleted()) == 1
+	}, 10*time.Second, 100*time.Millisecond)
+	assert.Equal(suite.T(), []string{"recent-rule"}, suite.listDeleted())
+}
+
+func TestRestoreRuleTestSuite(t *testing.T) {
+	suite.Run(t, new(RestoreRuleTestSuite))
+}
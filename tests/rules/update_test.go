@@ -0,0 +1,199 @@
+package rules
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Gmacem/wasmorph/tests/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type UpdateRuleTestSuite struct {
+	suite.Suite
+	dbClient   *helpers.DatabaseClient
+	httpClient *helpers.HTTPClient
+	apiKey     string
+}
+
+type updatedRule struct {
+	Name        string `json:"name"`
+	Version     int    `json:"version"`
+	SourceCode  string `json:"source_code"`
+	Description string `json:"description"`
+}
+
+func (suite *UpdateRuleTestSuite) SetupSuite() {
+	var err error
+	suite.dbClient, err = helpers.NewDatabaseClient()
+	require.NoError(suite.T(), err)
+	suite.httpClient = helpers.NewHTTPClient()
+}
+
+func (suite *UpdateRuleTestSuite) TearDownSuite() {
+	if suite.dbClient != nil {
+		suite.dbClient.Close()
+	}
+}
+
+func (suite *UpdateRuleTestSuite) SetupTest() {
+	suite.dbClient.CleanupAll()
+
+	suite.apiKey = "test-api-key-update"
+	require.NoError(suite.T(), suite.dbClient.AddUser("testuser-update", "hashed-password"))
+	require.NoError(suite.T(), suite.dbClient.AddAPIKey(suite.apiKey, "testuser-update"))
+}
+
+// createRule creates the rule and returns its ETag.
+func (suite *UpdateRuleTestSuite) createRule(name string) string {
+	resp, err := suite.httpClient.CreateRule(suite.apiKey, name, versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+	return resp.Header.Get("ETag")
+}
+
+func (suite *UpdateRuleTestSuite) getRule(name string) (updatedRule, string) {
+	resp, err := suite.httpClient.GetRule(suite.apiKey, name)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var rule updatedRule
+	require.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&rule))
+	return rule, resp.Header.Get("ETag")
+}
+
+func (suite *UpdateRuleTestSuite) TestCreateReportsWhetherRuleIsNew() {
+	suite.createRule("status-rule")
+
+	resp, err := suite.httpClient.CreateRule(suite.apiKey, "status-rule", versionTwoProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.DeleteRule(suite.apiKey, "status-rule")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	resp, err = suite.httpClient.PurgeRule(suite.apiKey, "status-rule")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+
+	suite.createRule("status-rule")
+}
+
+func (suite *UpdateRuleTestSuite) TestPutWithIfMatch() {
+	etag := suite.createRule("put-rule")
+	_, got := suite.getRule("put-rule")
+	assert.Equal(suite.T(), `"1"`, got)
+	assert.Equal(suite.T(), etag, got)
+
+	resp, err := suite.httpClient.UpdateRule(suite.apiKey, http.MethodPut, "put-rule", etag, map[string]any{"code": versionTwoProgram})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	assert.Equal(suite.T(), `"2"`, resp.Header.Get("ETag"))
+
+	rule, _ := suite.getRule("put-rule")
+	assert.Equal(suite.T(), 2, rule.Version)
+	assert.Equal(suite.T(), versionTwoProgram, rule.SourceCode)
+
+	resp, err = suite.httpClient.UpdateRule(suite.apiKey, http.MethodPut, "put-rule", etag, map[string]any{"code": versionOneProgram})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusPreconditionFailed, resp.StatusCode, "a stale ETag must not overwrite the rule")
+
+	resp, err = suite.httpClient.UpdateRule(suite.apiKey, http.MethodPut, "put-rule", "", map[string]any{"code": versionOneProgram})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusPreconditionRequired, resp.StatusCode)
+
+	resp, err = suite.httpClient.UpdateRule(suite.apiKey, http.MethodPut, "put-rule", "*", map[string]any{"code": versionOneProgram})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.UpdateRule(suite.apiKey, http.MethodPut, "missing-rule", "*", map[string]any{"code": versionOneProgram})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode, "PUT must not create rules")
+}
+
+func (suite *UpdateRuleTestSuite) TestPatchKeepsCode() {
+	suite.createRule("patch-rule")
+
+	resp, err := suite.httpClient.UpdateRule(suite.apiKey, http.MethodPatch, "patch-rule", "", map[string]any{"description": "Says v1"})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	rule, _ := suite.getRule("patch-rule")
+	assert.Equal(suite.T(), "Says v1", rule.Description)
+	assert.Equal(suite.T(), versionOneProgram, rule.SourceCode)
+	assert.Equal(suite.T(), 1, rule.Version, "a metadata change must not make a new version")
+
+	resp, err = suite.httpClient.UpdateRule(suite.apiKey, http.MethodPatch, "patch-rule", "", map[string]any{})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode, "an empty patch must be rejected")
+
+	resp, err = suite.httpClient.UpdateRule(suite.apiKey, http.MethodPut, "patch-rule", "*", map[string]any{"code": versionOneProgram})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	assert.Equal(suite.T(), `"1"`, resp.Header.Get("ETag"), "unchanged code must not make a new version")
+
+	resp, err = suite.httpClient.ListRuleVersions(suite.apiKey, "patch-rule")
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	var versions []map[string]any
+	require.NoError(suite.T(), json.NewDecoder(resp.Body).Decode(&versions))
+	assert.Len(suite.T(), versions, 1)
+}
+
+func (suite *UpdateRuleTestSuite) TestRename() {
+	etag := suite.createRule("old-name")
+	suite.createRule("taken-name")
+
+	resp, err := suite.httpClient.RenameRule(suite.apiKey, "old-name", "taken-name", "")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusConflict, resp.StatusCode)
+
+	resp, err = suite.httpClient.DeleteRule(suite.apiKey, "taken-name")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	resp, err = suite.httpClient.RenameRule(suite.apiKey, "old-name", "taken-name", "")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusConflict, resp.StatusCode, "renaming must not overwrite a deleted rule")
+
+	resp, err = suite.httpClient.RenameRule(suite.apiKey, "old-name", "new-name", `"7"`)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, err = suite.httpClient.RenameRule(suite.apiKey, "old-name", "new-name", etag)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	rule, _ := suite.getRule("new-name")
+	assert.Equal(suite.T(), 1, rule.Version, "renaming must keep the rule's versions")
+
+	resp, err = suite.httpClient.GetRule(suite.apiKey, "old-name")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.NotEqual(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.ExecuteRule(suite.apiKey, "new-name", map[string]any{"input": "x"})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func TestUpdateRuleTestSuite(t *testing.T) {
+	suite.Run(t, new(UpdateRuleTestSuite))
+}
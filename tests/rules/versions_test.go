@@ -0,0 +1,131 @@
+package rules
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/Gmacem/wasmorph/tests/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	versionOneProgram = `func Transform(in []byte) []byte {
+	return []byte("v1")
+}`
+	versionTwoProgram = `func Transform(in []byte) []byte {
+	return []byte("v2")
+}`
+)
+
+type RuleVersionsTestSuite struct {
+	suite.Suite
+	dbClient   *helpers.DatabaseClient
+	httpClient *helpers.HTTPClient
+	apiKey     string
+	ruleName   string
+}
+
+func (suite *RuleVersionsTestSuite) SetupSuite() {
+	var err error
+	suite.dbClient, err = helpers.NewDatabaseClient()
+	require.NoError(suite.T(), err)
+	suite.httpClient = helpers.NewHTTPClient()
+}
+
+func (suite *RuleVersionsTestSuite) TearDownSuite() {
+	if suite.dbClient != nil {
+		suite.dbClient.Close()
+	}
+}
+
+func (suite *RuleVersionsTestSuite) SetupTest() {
+	suite.dbClient.CleanupAll()
+
+	suite.apiKey = "test-api-key-versions"
+	suite.ruleName = "versioned-rule"
+	username := "testuser-versions"
+
+	err := suite.dbClient.AddUser(username, "hashed-password")
+	require.NoError(suite.T(), err)
+
+	err = suite.dbClient.AddAPIKey(suite.apiKey, username)
+	require.NoError(suite.T(), err)
+}
+
+func (suite *RuleVersionsTestSuite) saveRule(code string) {
+	resp, err := suite.httpClient.CreateRule(suite.apiKey, suite.ruleName, code)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		suite.T().Fatalf("failed to save rule: status %d, body: %s", resp.StatusCode, string(bodyBytes))
+	}
+}
+
+func (suite *RuleVersionsTestSuite) listVersions() []map[string]any {
+	resp, err := suite.httpClient.ListRuleVersions(suite.apiKey, suite.ruleName)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var versions []map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&versions)
+	require.NoError(suite.T(), err)
+	return versions
+}
+
+func (suite *RuleVersionsTestSuite) TestEverySaveCreatesVersion() {
+	suite.saveRule(versionOneProgram)
+	suite.saveRule(versionTwoProgram)
+
+	versions := suite.listVersions()
+	require.Len(suite.T(), versions, 2)
+	assert.Equal(suite.T(), float64(2), versions[0]["version"])
+	assert.Equal(suite.T(), float64(1), versions[1]["version"])
+}
+
+func (suite *RuleVersionsTestSuite) TestRollback() {
+	suite.saveRule(versionOneProgram)
+	suite.saveRule(versionTwoProgram)
+
+	resp, err := suite.httpClient.RollbackRule(suite.apiKey, suite.ruleName, 1)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var rollback map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&rollback)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), float64(3), rollback["version"])
+
+	assert.Len(suite.T(), suite.listVersions(), 3)
+
+	execResp, err := suite.httpClient.ExecuteRule(suite.apiKey, suite.ruleName, map[string]any{})
+	require.NoError(suite.T(), err)
+	defer execResp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, execResp.StatusCode)
+
+	var result map[string]any
+	err = json.NewDecoder(execResp.Body).Decode(&result)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "v1", result["result"])
+}
+
+func (suite *RuleVersionsTestSuite) TestRollbackUnknownVersion() {
+	suite.saveRule(versionOneProgram)
+
+	resp, err := suite.httpClient.RollbackRule(suite.apiKey, suite.ruleName, 42)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+}
+
+func TestRuleVersionsTestSuite(t *testing.T) {
+	suite.Run(t, new(RuleVersionsTestSuite))
+}
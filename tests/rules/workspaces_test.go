@@ -0,0 +1,315 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Gmacem/wasmorph/tests/helpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type WorkspacesTestSuite struct {
+	suite.Suite
+	dbClient   *helpers.DatabaseClient
+	httpClient *helpers.HTTPClient
+	ownerKey   string
+	memberKey  string
+}
+
+type workspaceResponse struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+func (suite *WorkspacesTestSuite) SetupSuite() {
+	var err error
+	suite.dbClient, err = helpers.NewDatabaseClient()
+	require.NoError(suite.T(), err)
+	suite.httpClient = helpers.NewHTTPClient()
+}
+
+func (suite *WorkspacesTestSuite) TearDownSuite() {
+	if suite.dbClient != nil {
+		suite.dbClient.Close()
+	}
+}
+
+func (suite *WorkspacesTestSuite) SetupTest() {
+	suite.dbClient.CleanupAll()
+
+	suite.ownerKey = "test-api-key-ws-owner"
+	suite.memberKey = "test-api-key-ws-member"
+
+	for username, apiKey := range map[string]string{"ws-owner": suite.ownerKey, "ws-member": suite.memberKey} {
+		err := suite.dbClient.AddUser(username, "hashed-password")
+		require.NoError(suite.T(), err)
+		err = suite.dbClient.AddAPIKey(apiKey, username)
+		require.NoError(suite.T(), err)
+	}
+}
+
+func (suite *WorkspacesTestSuite) createWorkspace(name string) int {
+	resp, err := suite.httpClient.CreateWorkspace(suite.ownerKey, name)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	var workspace workspaceResponse
+	err = json.NewDecoder(resp.Body).Decode(&workspace)
+	require.NoError(suite.T(), err)
+	return workspace.ID
+}
+
+func (suite *WorkspacesTestSuite) setMember(workspaceID int, username, role string) {
+	resp, err := suite.httpClient.SetWorkspaceMember(suite.ownerKey, workspaceID, username, role)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func (suite *WorkspacesTestSuite) ruleNames(apiKey string, workspaceID int) []string {
+	resp, err := suite.httpClient.ListRulesInWorkspace(apiKey, workspaceID)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var rules []map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&rules)
+	require.NoError(suite.T(), err)
+
+	names := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		names = append(names, rule["name"].(string))
+	}
+	return names
+}
+
+func (suite *WorkspacesTestSuite) TestPersonalWorkspace() {
+	resp, err := suite.httpClient.ListWorkspaces(suite.ownerKey)
+	require.NoError(suite.T(), err)
+	defer resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	var workspaces []workspaceResponse
+	err = json.NewDecoder(resp.Body).Decode(&workspaces)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), workspaces, 1)
+	assert.Equal(suite.T(), "owner", workspaces[0].Role)
+
+	personalID, err := suite.dbClient.GetPersonalWorkspaceID("ws-owner")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int(personalID), workspaces[0].ID)
+}
+
+func (suite *WorkspacesTestSuite) TestRolesLimitMembers() {
+	workspaceID := suite.createWorkspace("billing")
+
+	resp, err := suite.httpClient.CreateRuleInWorkspace(suite.ownerKey, workspaceID, "shared-rule", versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	resp, err = suite.httpClient.ListRulesInWorkspace(suite.memberKey, workspaceID)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode, "non-members must not see the workspace")
+
+	suite.setMember(workspaceID, "ws-member", "executor")
+
+	params := url.Values{"workspace": {fmt.Sprint(workspaceID)}}
+	resp, err = suite.httpClient.ExecuteRuleWithParams(suite.memberKey, "shared-rule", params, map[string]any{})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.CreateRuleInWorkspace(suite.memberKey, workspaceID, "member-rule", versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+
+	suite.setMember(workspaceID, "ws-member", "editor")
+
+	resp, err = suite.httpClient.CreateRuleInWorkspace(suite.memberKey, workspaceID, "member-rule", versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	assert.ElementsMatch(suite.T(), []string{"shared-rule", "member-rule"}, suite.ruleNames(suite.ownerKey, workspaceID))
+}
+
+func (suite *WorkspacesTestSuite) TestRemovedMemberCannotExecute() {
+	workspaceID := suite.createWorkspace("billing")
+	resp, err := suite.httpClient.CreateRuleInWorkspace(suite.ownerKey, workspaceID, "shared-rule", versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+	suite.setMember(workspaceID, "ws-member", "executor")
+
+	execute := func() int {
+		params := url.Values{"workspace": {fmt.Sprint(workspaceID)}}
+		resp, err := suite.httpClient.ExecuteRuleWithParams(suite.memberKey, "shared-rule", params, map[string]any{})
+		require.NoError(suite.T(), err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(suite.T(), http.StatusOK, execute())
+
+	resp, err = suite.httpClient.RemoveWorkspaceMember(suite.ownerKey, workspaceID, "ws-member")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusNoContent, resp.StatusCode)
+
+	// Cached roles are dropped once the change notification arrives.
+	assert.Eventually(suite.T(), func() bool {
+		return execute() == http.StatusNotFound
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func (suite *WorkspacesTestSuite) TestMemberCannotPromoteThemselves() {
+	workspaceID := suite.createWorkspace("billing")
+	suite.setMember(workspaceID, "ws-member", "viewer")
+
+	resp, err := suite.httpClient.SetWorkspaceMember(suite.memberKey, workspaceID, "ws-member", "owner")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+
+	resp, err = suite.httpClient.RemoveWorkspaceMember(suite.memberKey, workspaceID, "ws-member")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusNoContent, resp.StatusCode, "members may leave a workspace")
+}
+
+func (suite *WorkspacesTestSuite) TestLastOwnerCannotLeave() {
+	workspaceID := suite.createWorkspace("billing")
+
+	resp, err := suite.httpClient.RemoveWorkspaceMember(suite.ownerKey, workspaceID, "ws-owner")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+
+	personalID, err := suite.dbClient.GetPersonalWorkspaceID("ws-owner")
+	require.NoError(suite.T(), err)
+	resp, err = suite.httpClient.SetWorkspaceMember(suite.ownerKey, int(personalID), "ws-owner", "viewer")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+}
+
+func (suite *WorkspacesTestSuite) TestUnknownMember() {
+	workspaceID := suite.createWorkspace("billing")
+
+	resp, err := suite.httpClient.SetWorkspaceMember(suite.ownerKey, workspaceID, "nobody", "viewer")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode)
+
+	resp, err = suite.httpClient.RemoveWorkspaceMember(suite.ownerKey, workspaceID, "ws-member")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusNotFound, resp.StatusCode, "removing a user who is not a member")
+
+	resp, err = suite.httpClient.SetWorkspaceMember(suite.ownerKey, workspaceID, "ws-member", "admin")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusBadRequest, resp.StatusCode)
+}
+
+func (suite *WorkspacesTestSuite) TestTransferRuleToWorkspace() {
+	workspaceID := suite.createWorkspace("billing")
+	personalID, err := suite.dbClient.GetPersonalWorkspaceID("ws-owner")
+	require.NoError(suite.T(), err)
+
+	resp, err := suite.httpClient.CreateRule(suite.ownerKey, "moving-rule", versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	resp, err = suite.httpClient.TransferRule(suite.ownerKey, "moving-rule", map[string]any{"workspace_id": workspaceID})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	assert.Empty(suite.T(), suite.ruleNames(suite.ownerKey, int(personalID)))
+	assert.Equal(suite.T(), []string{"moving-rule"}, suite.ruleNames(suite.ownerKey, workspaceID))
+
+	resp, err = suite.httpClient.ExecuteRule(suite.ownerKey, "moving-rule", map[string]any{})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.NotEqual(suite.T(), http.StatusOK, resp.StatusCode, "the rule must no longer run from the personal workspace")
+
+	params := url.Values{"workspace": {fmt.Sprint(workspaceID)}}
+	resp, err = suite.httpClient.ExecuteRuleWithParams(suite.ownerKey, "moving-rule", params, map[string]any{})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func (suite *WorkspacesTestSuite) TestTransferRuleToUser() {
+	resp, err := suite.httpClient.CreateRule(suite.ownerKey, "gift-rule", versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	resp, err = suite.httpClient.TransferRule(suite.ownerKey, "gift-rule", map[string]any{"username": "ws-member"})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.ExecuteRule(suite.memberKey, "gift-rule", map[string]any{})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func (suite *WorkspacesTestSuite) TestTransferOntoDeletedRule() {
+	resp, err := suite.httpClient.CreateRule(suite.memberKey, "gift-rule", versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+	resp, err = suite.httpClient.DeleteRule(suite.memberKey, "gift-rule")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+
+	resp, err = suite.httpClient.CreateRule(suite.ownerKey, "gift-rule", versionTwoProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	resp, err = suite.httpClient.TransferRule(suite.ownerKey, "gift-rule", map[string]any{"username": "ws-member"})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusConflict, resp.StatusCode, "a transfer must not overwrite a deleted rule")
+
+	resp, err = suite.httpClient.RestoreRule(suite.memberKey, "gift-rule")
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+}
+
+func (suite *WorkspacesTestSuite) TestTransferRequiresEditorInTarget() {
+	workspaceID := suite.createWorkspace("billing")
+	suite.setMember(workspaceID, "ws-member", "viewer")
+
+	resp, err := suite.httpClient.CreateRule(suite.memberKey, "member-rule", versionOneProgram)
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	require.Equal(suite.T(), http.StatusCreated, resp.StatusCode)
+
+	resp, err = suite.httpClient.TransferRule(suite.memberKey, "member-rule", map[string]any{"workspace_id": workspaceID})
+	require.NoError(suite.T(), err)
+	resp.Body.Close()
+	assert.Equal(suite.T(), http.StatusForbidden, resp.StatusCode)
+}
+
+func TestWorkspacesTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkspacesTestSuite))
+}